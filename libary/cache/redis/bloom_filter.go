@@ -1,24 +1,55 @@
 package redis
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/go-redis/redis"
 	"github.com/longpi1/gopkg/libary/log"
 	cuckoo "github.com/seiflotfy/cuckoofilter"
 )
 
 type BloomFilter struct {
-	client *redis.Client
-	filter *cuckoo.Filter
-	key    string
+	client   *redis.Client
+	lock     sync.Mutex // 保护 filter 和 previous
+	filter   *cuckoo.Filter
+	previous *cuckoo.Filter // 上一代过滤器，仅在设置了 WithRotation 时使用
+	key      string
+	size     uint
+
+	rotation  time.Duration // 轮换周期，为0时不轮换
+	rotatedAt time.Time     // 上次轮换的时间
+	now       func() time.Time
+}
+
+// BloomFilterOption BloomFilter 的选项
+type BloomFilterOption func(rb *BloomFilter)
+
+// WithRotation 使用新旧两代过滤器，每隔 interval 轮换一次：当前过滤器变为上一代，新建一个空的当前过滤器，
+// 原来的上一代被丢弃。Exists 同时检查两代，因此元素在加入后的 interval 到 2*interval 之间过期，
+// 适用于底层数据会过期、过滤器不应无限增长的场景
+func WithRotation(interval time.Duration) BloomFilterOption {
+	return func(rb *BloomFilter) {
+		if interval > 0 {
+			rb.rotation = interval
+		}
+	}
 }
 
-func NewRedisBloomFilter(client *redis.Client, key string, size uint, hashes int) (*BloomFilter, error) {
+func NewRedisBloomFilter(client *redis.Client, key string, size uint, hashes int, opts ...BloomFilterOption) (*BloomFilter, error) {
 	bf := cuckoo.NewFilter(size)
 	rb := &BloomFilter{
 		client: client,
 		filter: bf,
 		key:    key,
+		size:   size,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(rb)
 	}
+	rb.rotatedAt = rb.now()
 
 	err := rb.load()
 	if err != nil {
@@ -28,18 +59,98 @@ func NewRedisBloomFilter(client *redis.Client, key string, size uint, hashes int
 	return rb, nil
 }
 
+// Add 将元素加入内存过滤器的当前一代，元素已存在或过滤器已满时返回false
+func (rb *BloomFilter) Add(data []byte) bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.rotate()
+	return rb.filter.InsertUnique(data)
+}
+
+// Exists 判断元素是否可能存在，设置了 WithRotation 时同时检查当前和上一代过滤器
+func (rb *BloomFilter) Exists(data []byte) bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.rotate()
+	if rb.filter.Lookup(data) {
+		return true
+	}
+	return rb.previous != nil && rb.previous.Lookup(data)
+}
+
+// Count 返回内存过滤器中的元素数量，设置了 WithRotation 时包含上一代的元素
+func (rb *BloomFilter) Count() uint {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.rotate()
+	count := rb.filter.Count()
+	if rb.previous != nil {
+		count += rb.previous.Count()
+	}
+	return count
+}
+
+// Reset 清空内存过滤器并删除 redis 中的 hash
+func (rb *BloomFilter) Reset(ctx context.Context) error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	if err := rb.client.WithContext(ctx).Del(rb.key).Err(); err != nil {
+		return err
+	}
+	rb.filter.Reset()
+	rb.previous = nil
+	return nil
+}
+
+// Reload 清空内存过滤器后重新从 redis 的 hash 中加载
+func (rb *BloomFilter) Reload(ctx context.Context) error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	data, err := rb.client.WithContext(ctx).HGetAll(rb.key).Result()
+	if err != nil {
+		return err
+	}
+	rb.filter.Reset()
+	rb.previous = nil
+	rb.rotatedAt = rb.now()
+	rb.insert(data)
+	return nil
+}
+
 func (rb *BloomFilter) load() error {
 	data, err := rb.client.HGetAll(rb.key).Result()
 	if err != nil {
 		return err
 	}
 
+	rb.insert(data)
+	return nil
+}
+
+// rotate 轮换周期到达时轮换过滤器，调用方需持有 lock
+func (rb *BloomFilter) rotate() {
+	if rb.rotation <= 0 {
+		return
+	}
+	elapsed := rb.now().Sub(rb.rotatedAt)
+	if elapsed < rb.rotation {
+		return
+	}
+	if elapsed >= 2*rb.rotation {
+		// 超过两个周期未轮换，两代中的元素都已过期
+		rb.previous = nil
+	} else {
+		rb.previous = rb.filter
+	}
+	rb.filter = cuckoo.NewFilter(rb.size)
+	rb.rotatedAt = rb.now()
+}
+
+func (rb *BloomFilter) insert(data map[string]string) {
 	for key, _ := range data {
 		flag := rb.filter.InsertUnique([]byte(key))
 		if !flag {
 			log.Error("插入失败： %v", key)
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilterResetAndReload(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	mr.HSet("bf", "a", "1")
+	mr.HSet("bf", "b", "1")
+	bf, err := NewRedisBloomFilter(client, "bf", 1024, 0)
+	is.NoError(err)
+	is.Equal(uint(2), bf.Count())
+
+	// reload picks up the entries written to redis since the last load
+	mr.HSet("bf", "c", "1")
+	is.NoError(bf.Reload(ctx))
+	is.Equal(uint(3), bf.Count())
+
+	is.NoError(bf.Reset(ctx))
+	is.Equal(uint(0), bf.Count())
+	is.False(mr.Exists("bf"))
+
+	is.NoError(bf.Reload(ctx))
+	is.Equal(uint(0), bf.Count())
+}
+
+func TestBloomFilterRotation(t *testing.T) {
+	is := assert.New(t)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	bf, err := NewRedisBloomFilter(client, "bf", 1024, 0, WithRotation(time.Minute))
+	is.NoError(err)
+	now := time.Unix(1700000000, 0)
+	bf.now = func() time.Time { return now }
+	bf.rotatedAt = now
+
+	is.True(bf.Add([]byte("old")))
+	is.False(bf.Add([]byte("old")))
+	is.True(bf.Exists([]byte("old")))
+
+	// after one rotation the item is still found in the previous generation
+	now = now.Add(time.Minute)
+	is.True(bf.Add([]byte("new")))
+	is.True(bf.Exists([]byte("old")))
+	is.True(bf.Exists([]byte("new")))
+	is.Equal(uint(2), bf.Count())
+
+	// after the second rotation the old item is dropped
+	now = now.Add(time.Minute)
+	is.False(bf.Exists([]byte("old")))
+	is.True(bf.Exists([]byte("new")))
+	is.Equal(uint(1), bf.Count())
+
+	// both generations are stale after two idle intervals
+	now = now.Add(2 * time.Minute)
+	is.False(bf.Exists([]byte("new")))
+	is.Equal(uint(0), bf.Count())
+}
@@ -0,0 +1,87 @@
+//go:build integration
+// +build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/longpi1/gopkg/libary/conf"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// newIntegrationCache connects to a live redis (with the redis-stack modules) on :6379
+func newIntegrationCache(t *testing.T) Cache {
+	client := redis.NewClient(&redis.Options{
+		Addr: ":6379",
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	_ = client.FlushDB(context.Background()).Err()
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewRedisCache(&conf.RedisConfig{ExpirationSeconds: 60}, client)
+}
+
+func TestCacheSortedSet(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	cache := newIntegrationCache(t)
+
+	is.NoError(cache.ZAdd(ctx, "leaderboard", 30, "carol"))
+	is.NoError(cache.ZAdd(ctx, "leaderboard", 10, "alice"))
+	is.NoError(cache.ZAdd(ctx, "leaderboard", 20, "bob"))
+	is.NoError(cache.ZAdd(ctx, "leaderboard", 40, "dave"))
+
+	members, err := cache.ZRangeByScore(ctx, "leaderboard", 0, 100, 0)
+	is.NoError(err)
+	is.Equal([]string{"alice", "bob", "carol", "dave"}, members)
+
+	members, err = cache.ZRangeByScore(ctx, "leaderboard", 15, 100, 2)
+	is.NoError(err)
+	is.Equal([]string{"bob", "carol"}, members)
+
+	rank, ok, err := cache.ZRank(ctx, "leaderboard", "carol")
+	is.NoError(err)
+	is.True(ok)
+	is.Equal(int64(2), rank)
+
+	// update the score moves the member
+	is.NoError(cache.ZAdd(ctx, "leaderboard", 5, "carol"))
+	rank, ok, err = cache.ZRank(ctx, "leaderboard", "carol")
+	is.NoError(err)
+	is.True(ok)
+	is.Equal(int64(0), rank)
+
+	_, ok, err = cache.ZRank(ctx, "leaderboard", "eve")
+	is.NoError(err)
+	is.False(ok)
+}
+
+func TestCacheCuckooFilter(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	cache := newIntegrationCache(t)
+
+	count, err := cache.CFCount(ctx, "cf", "alice")
+	is.NoError(err)
+	is.Equal(int64(0), count)
+
+	// CFInsert creates the filter
+	is.NoError(cache.CFInsert(ctx, "cf", "alice", "bob", "alice"))
+	count, err = cache.CFCount(ctx, "cf", "alice")
+	is.NoError(err)
+	is.Equal(int64(2), count)
+	exist, err := cache.CFExist(ctx, "cf", "bob")
+	is.NoError(err)
+	is.True(exist)
+
+	is.NoError(cache.CFDel(ctx, "cf", "alice"))
+	count, err = cache.CFCount(ctx, "cf", "alice")
+	is.NoError(err)
+	is.Equal(int64(1), count)
+}
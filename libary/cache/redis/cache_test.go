@@ -0,0 +1,591 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/longpi1/gopkg/libary/conf"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCache(t *testing.T) (*miniredis.Miniredis, Cache) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return mr, NewRedisCache(&conf.RedisConfig{ExpirationSeconds: 60}, client)
+}
+
+func TestCacheScan(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+
+	for i := 0; i < 300; i++ {
+		is.NoError(mr.Set(fmt.Sprintf("user:%d", i), "v"))
+	}
+	for i := 0; i < 50; i++ {
+		is.NoError(mr.Set(fmt.Sprintf("order:%d", i), "v"))
+	}
+
+	it, err := cache.Scan(ctx, "user:*", 20)
+	is.NoError(err)
+	seen := make(map[string]struct{})
+	for {
+		key, ok, err := it.Next(ctx)
+		is.NoError(err)
+		if !ok {
+			break
+		}
+		seen[key] = struct{}{}
+	}
+	is.Len(seen, 300)
+	is.Contains(seen, "user:0")
+	is.NotContains(seen, "order:0")
+
+	// exhausted iterator keeps reporting the end
+	_, ok, err := it.Next(ctx)
+	is.NoError(err)
+	is.False(ok)
+}
+
+func TestCacheHash(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	_, cache := newTestCache(t)
+
+	type session struct {
+		UserID int64  `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	is.NoError(cache.HSet(ctx, "session:1", "profile", session{UserID: 7, Role: "admin"}))
+	is.NoError(cache.HSet(ctx, "session:1", "visits", 3))
+
+	var got session
+	ok, err := cache.HGet(ctx, "session:1", "profile", &got)
+	is.NoError(err)
+	is.True(ok)
+	is.Equal(session{UserID: 7, Role: "admin"}, got)
+
+	// missing field and missing key
+	var missing session
+	ok, err = cache.HGet(ctx, "session:1", "unknown", &missing)
+	is.NoError(err)
+	is.False(ok)
+	ok, err = cache.HGet(ctx, "session:2", "profile", &missing)
+	is.NoError(err)
+	is.False(ok)
+
+	all, err := cache.HGetAll(ctx, "session:1")
+	is.NoError(err)
+	is.Equal(map[string]string{
+		"profile": `{"user_id":7,"role":"admin"}`,
+		"visits":  "3",
+	}, all)
+
+	all, err = cache.HGetAll(ctx, "session:2")
+	is.NoError(err)
+	is.Empty(all)
+}
+
+func TestCacheSetNX(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+
+	var wg sync.WaitGroup
+	var won int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := cache.SetNX(ctx, "idempotency:1", i, time.Minute)
+			is.NoError(err)
+			if ok {
+				atomic.AddInt32(&won, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	is.Equal(int32(1), atomic.LoadInt32(&won))
+	is.Equal(time.Minute, mr.TTL("idempotency:1"))
+
+	// the key can be set again once it expires
+	mr.FastForward(time.Minute)
+	ok, err := cache.SetNX(ctx, "idempotency:1", "again", time.Minute)
+	is.NoError(err)
+	is.True(ok)
+}
+
+func TestCacheCompareAndDelete(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	_, cache := newTestCache(t)
+
+	is.NoError(cache.Set(ctx, "lock", "owner-a"))
+
+	deleted, err := cache.CompareAndDelete(ctx, "lock", "owner-b")
+	is.NoError(err)
+	is.False(deleted)
+	exist, err := cache.Exist(ctx, "lock")
+	is.NoError(err)
+	is.True(exist)
+
+	deleted, err = cache.CompareAndDelete(ctx, "lock", "owner-a")
+	is.NoError(err)
+	is.True(deleted)
+	exist, err = cache.Exist(ctx, "lock")
+	is.NoError(err)
+	is.False(exist)
+
+	deleted, err = cache.CompareAndDelete(ctx, "lock", "owner-a")
+	is.NoError(err)
+	is.False(deleted)
+}
+
+func TestCacheExecPipeLineGet(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	_, cache := newTestCache(t)
+
+	is.NoError(cache.Set(ctx, "a", 1))
+	is.NoError(cache.Set(ctx, "b", "bee"))
+
+	var a int
+	var b, c string
+	var missing string
+	cmds := []Cmd{
+		{OpType: SET, Payload: SetPayload{Key: "c", Val: "sea"}},
+		{OpType: GET, Payload: GetPayload{Key: "a", Dst: &a}},
+		{OpType: GET, Payload: GetPayload{Key: "b", Dst: &b}},
+		{OpType: GET, Payload: GetPayload{Key: "missing", Dst: &missing}},
+		{OpType: GET, Payload: GetPayload{Key: "c", Dst: &c}},
+	}
+	is.NoError(cache.ExecPipeLine(ctx, &cmds))
+	is.Equal(1, a)
+	is.Equal("bee", b)
+	is.Equal("sea", c)
+	is.Empty(missing)
+
+	ok, err := cache.Get(ctx, "c", &c)
+	is.NoError(err)
+	is.True(ok)
+}
+
+func TestCacheExecPipeLineIncrByX(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+	// EVALSHA in a pipeline does not fall back to EVAL, load the script first
+	is.NoError(incrByX.Load(ctx, redis.NewClient(&redis.Options{Addr: mr.Addr()})).Err())
+
+	is.NoError(cache.Set(ctx, "counter", 1))
+	cmds := []Cmd{{OpType: INCRBYX, Payload: IncrByXPayload{Key: "counter", Val: 2}}}
+	is.NoError(cache.ExecPipeLine(ctx, &cmds))
+	var counter int
+	_, err := cache.Get(ctx, "counter", &counter)
+	is.NoError(err)
+	is.Equal(3, counter)
+
+	// INCRBYX on a missing key fails, even next to a GET of a missing key which does not
+	var missing string
+	cmds = []Cmd{
+		{OpType: GET, Payload: GetPayload{Key: "missing", Dst: &missing}},
+		{OpType: INCRBYX, Payload: IncrByXPayload{Key: "missing", Val: 1}},
+	}
+	is.ErrorIs(cache.ExecPipeLine(ctx, &cmds), ErrKeyNotFound)
+	is.False(mr.Exists("missing"))
+}
+
+func TestInstrument(t *testing.T) {
+	is := assert.New(t)
+	originTracing, originMetrics := instrumentTracing, instrumentMetrics
+	defer func() {
+		instrumentTracing, instrumentMetrics = originTracing, originMetrics
+	}()
+
+	var tracing, metrics int
+	var tracingErr error
+	instrumentTracing = func(rdb redis.UniversalClient, opts ...redisotel.TracingOption) error {
+		tracing++
+		return tracingErr
+	}
+	instrumentMetrics = func(rdb redis.UniversalClient, opts ...redisotel.MetricsOption) error {
+		metrics++
+		return nil
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer client.Close()
+
+	is.NoError(instrument(client, &conf.RedisConfig{}))
+	is.Equal(1, tracing)
+	is.Equal(0, metrics)
+
+	is.NoError(instrument(client, &conf.RedisConfig{EnableMetrics: true}))
+	is.Equal(2, tracing)
+	is.Equal(1, metrics)
+
+	// instrumentation errors are returned instead of being discarded
+	tracingErr = errors.New("tracing failed")
+	err := instrument(client, &conf.RedisConfig{EnableMetrics: true})
+	is.ErrorIs(err, tracingErr)
+	is.Equal(1, metrics)
+}
+
+func TestGetRedisClientValidate(t *testing.T) {
+	_, err := GetRedisClient(&conf.RedisConfig{})
+	assert.ErrorIs(t, err, conf.ErrRedisAddressEmpty)
+}
+
+func TestCachePSubscribe(t *testing.T) {
+	is := assert.New(t)
+	_, cache := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := cache.PSubscribe(ctx, "order.*")
+	is.NoError(err)
+	is.NoError(cache.Publish(context.Background(), "user.created", "ignored"))
+	is.NoError(cache.Publish(context.Background(), "order.created", map[string]int{"id": 1}))
+
+	select {
+	case msg := <-messages:
+		is.Equal(Message{Topic: "order.created", Pattern: "order.*", Payload: `{"id":1}`}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	// the channel is closed once the context is cancelled
+	cancel()
+	select {
+	case _, ok := <-messages:
+		is.False(ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+func TestCacheRunScript(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	_, cache := newTestCache(t)
+
+	// increments the key by ARGV[1] and caps it at ARGV[2]
+	const capIncr = `
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v > tonumber(ARGV[2]) then
+	redis.call('SET', KEYS[1], ARGV[2])
+	return tonumber(ARGV[2])
+end
+return v
+`
+	res, err := cache.RunScript(ctx, capIncr, []string{"counter"}, 3, 5)
+	is.NoError(err)
+	is.Equal(int64(3), res)
+	res, err = cache.RunScript(ctx, capIncr, []string{"counter"}, 3, 5)
+	is.NoError(err)
+	is.Equal(int64(5), res)
+
+	res, err = cache.RunScript(ctx, `return redis.call('GET', KEYS[1])`, []string{"missing"})
+	is.NoError(err)
+	is.Nil(res)
+
+	_, err = cache.RunScript(ctx, `return redis.call('NOPE')`, nil)
+	is.Error(err)
+}
+
+func TestCacheGetSet(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+
+	var old int
+	existed, err := cache.GetSet(ctx, "counter", 5, &old)
+	is.NoError(err)
+	is.False(existed)
+
+	existed, err = cache.GetSet(ctx, "counter", 0, &old)
+	is.NoError(err)
+	is.True(existed)
+	is.Equal(5, old)
+
+	var current int
+	ok, err := cache.Get(ctx, "counter", &current)
+	is.NoError(err)
+	is.True(ok)
+	is.Equal(0, current)
+	// the standard expiration is applied to the new value
+	is.Greater(mr.TTL("counter"), time.Duration(0))
+}
+
+func TestCacheLocalFallback(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	lru := NewLRUCache(10)
+	cache := NewRedisCache(&conf.RedisConfig{ExpirationSeconds: 60}, client, WithLocalFallback(lru))
+
+	is.NoError(cache.Set(ctx, "written", "w"))
+	is.NoError(mr.Set("read", `"r"`))
+	var dst string
+	ok, err := cache.Get(ctx, "read", &dst)
+	is.NoError(err)
+	is.True(ok)
+	is.Equal(2, lru.Len())
+
+	// redis goes away, the values seen before are served from the fallback
+	mr.Close()
+	ok, err = cache.Get(ctx, "written", &dst)
+	is.NoError(err)
+	is.True(ok)
+	is.Equal("w", dst)
+	ok, err = cache.Get(ctx, "read", &dst)
+	is.NoError(err)
+	is.True(ok)
+	is.Equal("r", dst)
+	is.Equal(uint64(2), cache.(*CacheImpl).FallbackHits())
+
+	// keys never seen still report the connection error
+	_, err = cache.Get(ctx, "unknown", &dst)
+	is.ErrorIs(err, ErrConnFailure)
+}
+
+func TestCacheLocalFallbackInvalidation(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	lru := NewLRUCache(10)
+	cache := NewRedisCache(&conf.RedisConfig{ExpirationSeconds: 60}, client, WithLocalFallback(lru))
+
+	is.NoError(cache.Set(ctx, "getset", 1))
+	is.NoError(cache.Set(ctx, "pipeline", 1))
+	var old int
+	_, err := cache.GetSet(ctx, "getset", 2, &old)
+	is.NoError(err)
+	is.NoError(cache.ExecPipeLine(ctx, &[]Cmd{
+		{OpType: SET, Payload: SetPayload{Key: "pipeline", Val: 2}},
+	}))
+
+	// redis goes away, the values written before the last write are not served
+	mr.Close()
+	var dst int
+	_, err = cache.Get(ctx, "getset", &dst)
+	is.ErrorIs(err, ErrConnFailure)
+	_, err = cache.Get(ctx, "pipeline", &dst)
+	is.ErrorIs(err, ErrConnFailure)
+
+	// a failed write is not served either
+	is.Error(cache.Set(ctx, "failed", 3))
+	_, err = cache.Get(ctx, "failed", &dst)
+	is.ErrorIs(err, ErrConnFailure)
+	is.Equal(uint64(0), cache.(*CacheImpl).FallbackHits())
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	is := assert.New(t)
+	lru := NewLRUCache(2)
+	lru.Add("a", "1")
+	lru.Add("b", "2")
+	_, _ = lru.Get("a")
+	lru.Add("c", "3")
+
+	// b is the least recently used entry
+	_, ok := lru.Get("b")
+	is.False(ok)
+	val, ok := lru.Get("a")
+	is.True(ok)
+	is.Equal("1", val)
+	lru.Remove("a")
+	is.Equal(1, lru.Len())
+}
+
+func TestCacheExpirationJitter(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	cache := NewRedisCache(&conf.RedisConfig{ExpirationSeconds: 60, ExpirationJitterSeconds: 30}, client)
+
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		is.NoError(cache.Set(ctx, key, i))
+		ttl := mr.TTL(key)
+		is.GreaterOrEqual(ttl, 60*time.Second)
+		is.Less(ttl, 90*time.Second)
+		seen[ttl] = struct{}{}
+	}
+	// the jitter spreads the expirations over the whole window
+	is.Greater(len(seen), 10)
+
+	cmds := []Cmd{{OpType: SET, Payload: SetPayload{Key: "pipeline", Val: 1}}}
+	is.NoError(cache.ExecPipeLine(ctx, &cmds))
+	is.GreaterOrEqual(mr.TTL("pipeline"), 60*time.Second)
+	is.Less(mr.TTL("pipeline"), 90*time.Second)
+}
+
+func TestCloseRedis(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	// miniredis does not support the READONLY command of the cluster client
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	Client = client
+	is.NoError(client.Set(ctx, "key", "value", 0).Err())
+
+	is.NoError(CloseRedis())
+	is.Nil(Client)
+	is.ErrorIs(client.Ping(ctx).Err(), redis.ErrClosed)
+	// closing twice is a no-op
+	is.NoError(CloseRedis())
+}
+
+func TestGetRedisClientConcurrent(t *testing.T) {
+	is := assert.New(t)
+	origin := newClusterClient
+	defer func() {
+		newClusterClient = origin
+	}()
+
+	mr := miniredis.RunT(t)
+	var created int32
+	// miniredis does not support the READONLY command of the cluster client
+	newClusterClient = func(opt *redis.ClusterOptions) redis.UniversalClient {
+		atomic.AddInt32(&created, 1)
+		return redis.NewClient(&redis.Options{Addr: opt.Addrs[0]})
+	}
+	defer CloseRedis()
+
+	config := &conf.RedisConfig{Address: mr.Addr()}
+	clients := make([]redis.UniversalClient, 50)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := GetRedisClient(config)
+			is.NoError(err)
+			clients[i] = client
+		}()
+	}
+	wg.Wait()
+
+	is.Equal(int32(1), atomic.LoadInt32(&created))
+	for _, client := range clients {
+		is.Same(clients[0], client)
+	}
+}
+
+func TestGetRedisClientOptions(t *testing.T) {
+	is := assert.New(t)
+	origin := newClusterClient
+	defer func() {
+		newClusterClient = origin
+	}()
+
+	mr := miniredis.RunT(t)
+	var opts *redis.ClusterOptions
+	newClusterClient = func(opt *redis.ClusterOptions) redis.UniversalClient {
+		opts = opt
+		return redis.NewClient(&redis.Options{Addr: opt.Addrs[0]})
+	}
+	defer CloseRedis()
+
+	_, err := GetRedisClient(&conf.RedisConfig{Address: mr.Addr(), ReadTimeout: 200 * time.Millisecond})
+	is.NoError(err)
+	is.Equal(conf.DefaultRedisDialTimeout, opts.DialTimeout)
+	is.Equal(200*time.Millisecond, opts.ReadTimeout)
+	is.Equal(conf.DefaultRedisWriteTimeout, opts.WriteTimeout)
+}
+
+func TestCacheWithLock(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+
+	// the critical sections never overlap
+	var inside, overlapped, runs int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cache.WithLock(ctx, "lock:job", func() error {
+				if atomic.AddInt32(&inside, 1) > 1 {
+					atomic.StoreInt32(&overlapped, 1)
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&inside, -1)
+				atomic.AddInt32(&runs, 1)
+				return nil
+			})
+			is.NoError(err)
+		}()
+	}
+	wg.Wait()
+	is.Equal(int32(5), atomic.LoadInt32(&runs))
+	is.Equal(int32(0), atomic.LoadInt32(&overlapped))
+	is.False(mr.Exists("lock:job"))
+
+	// the acquisition gives up when ctx is done
+	held := cache.GetMutex("lock:held")
+	is.NoError(held.Lock())
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := cache.WithLock(timeoutCtx, "lock:held", func() error {
+		ran = true
+		return nil
+	})
+	is.Error(err)
+	is.False(ran)
+
+	// without a deadline it waits for the mutex to be released
+	time.AfterFunc(100*time.Millisecond, func() {
+		_, _ = held.Unlock()
+	})
+	is.NoError(cache.WithLock(ctx, "lock:held", func() error {
+		ran = true
+		return nil
+	}))
+	is.True(ran)
+
+	// the error of fn is returned and the mutex is released
+	errJob := errors.New("job failed")
+	is.ErrorIs(cache.WithLock(ctx, "lock:job", func() error { return errJob }), errJob)
+	is.False(mr.Exists("lock:job"))
+
+	// the mutex is released when fn panics
+	is.Panics(func() {
+		_ = cache.WithLock(ctx, "lock:job", func() error { panic("boom") })
+	})
+	is.False(mr.Exists("lock:job"))
+
+	// the mutex expired while fn was running
+	err = cache.WithLock(ctx, "lock:job", func() error {
+		mr.Del("lock:job")
+		return nil
+	})
+	is.ErrorIs(err, ErrRedisUnlockFail)
+}
@@ -2,13 +2,21 @@ package redis
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redsync/redsync/v4"
 	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
 	"github.com/longpi1/gopkg/libary/conf"
+	"github.com/longpi1/gopkg/libary/log"
 	"github.com/longpi1/gopkg/libary/utils"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
@@ -16,10 +24,19 @@ import (
 
 var (
 	Client redis.UniversalClient
+	// clientLock guards the creation and closing of Client
+	clientLock sync.Mutex
+	// newClusterClient is replaceable in tests
+	newClusterClient = func(opt *redis.ClusterOptions) redis.UniversalClient {
+		return redis.NewClusterClient(opt)
+	}
+	// instrumentTracing and instrumentMetrics are replaceable in tests
+	instrumentTracing = redisotel.InstrumentTracing
+	instrumentMetrics = redisotel.InstrumentMetrics
 	//ErrRedisUnlockFail is redis unlock fail error
 	ErrRedisUnlockFail = errors.New("redis unlock fail")
 	// ErrRedisCmdNotFound is redis command not found error
-	ErrRedisCmdNotFound = errors.New("redis command not found; supports only SET and DELETE")
+	ErrRedisCmdNotFound = errors.New("redis command not found; supports only SET, DELETE, INCRBYX and GET")
 )
 
 // Cache is the interface of redis cache
@@ -27,6 +44,7 @@ type Cache interface {
 	Get(ctx context.Context, key string, dst interface{}) (bool, error)
 	Exist(ctx context.Context, key string) (bool, error)
 	Set(ctx context.Context, key string, val interface{}) error
+	GetSet(ctx context.Context, key string, newVal interface{}, dst interface{}) (bool, error)
 	BFReserve(ctx context.Context, key string, errorRate float64, capacity int64) error
 	BFInsert(ctx context.Context, key string, errorRate float64, capacity int64, items ...interface{}) error
 	BFAdd(ctx context.Context, key string, item interface{}) error
@@ -35,13 +53,27 @@ type Cache interface {
 	CFAdd(ctx context.Context, key string, item interface{}) error
 	CFExist(ctx context.Context, key string, item interface{}) (bool, error)
 	CFDel(ctx context.Context, key string, item interface{}) error
+	CFCount(ctx context.Context, key string, item interface{}) (int64, error)
+	CFInsert(ctx context.Context, key string, items ...interface{}) error
 	IncrBy(ctx context.Context, key string, val int64) error
 	Delete(ctx context.Context, key string) error
 	GetMutex(mutexname string) *redsync.Mutex
+	WithLock(ctx context.Context, name string, fn func() error) error
 	ExecPipeLine(ctx context.Context, cmds *[]Cmd) error
 	Publish(ctx context.Context, topic string, payload interface{}) error
+	PSubscribe(ctx context.Context, patterns ...string) (<-chan Message, error)
 	TopKAdd(ctx context.Context, topic string, payload interface{}) error
 	TopKQuery(ctx context.Context, topic string, payload interface{}) ([]bool, error)
+	Scan(ctx context.Context, match string, count int64) (Iterator, error)
+	HSet(ctx context.Context, key, field string, val interface{}) error
+	HGet(ctx context.Context, key, field string, dst interface{}) (bool, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	ZRangeByScore(ctx context.Context, key string, min, max float64, limit int64) ([]string, error)
+	ZRank(ctx context.Context, key, member string) (int64, bool, error)
+	SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error)
+	CompareAndDelete(ctx context.Context, key string, expected interface{}) (bool, error)
+	RunScript(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
 }
 
 // CacheImpl is the redis cache client type
@@ -49,6 +81,12 @@ type CacheImpl struct {
 	client     redis.UniversalClient
 	rs         *redsync.Redsync
 	expiration int
+	jitter     int      // window in seconds added randomly to the expiration
+	scripts    sync.Map // sha1 of the script source -> *redis.Script
+
+	fallback     *LRUCache // serves Get when redis can not be reached, nil if disabled
+	fallbackHits uint64
+	logger       log.Logger
 }
 
 // OpType is the redis operation type
@@ -61,6 +99,8 @@ const (
 	DELETE
 	// INCRBYX represents incrBy if exists operation
 	INCRBYX
+	// GET represents get operation
+	GET
 )
 
 // RedisPayload is a abstract interface for payload type
@@ -88,6 +128,13 @@ type IncrByXPayload struct {
 	Val int64
 }
 
+// GetPayload is the payload type of get method, Dst is left untouched if the key does not exist
+type GetPayload struct {
+	RedisPayload
+	Key string
+	Dst interface{}
+}
+
 // Payload implements abstract interface
 func (SetPayload) Payload() {}
 
@@ -97,6 +144,9 @@ func (DeletePayload) Payload() {}
 // Payload implements abstract interface
 func (IncrByXPayload) Payload() {}
 
+// Payload implements abstract interface
+func (GetPayload) Payload() {}
+
 // Cmd represents an operation and its payload
 type Cmd struct {
 	OpType  OpType
@@ -111,56 +161,143 @@ type PipelineCmd struct {
 
 // GetRedisClient 获取一个 Redis 客户端
 func GetRedisClient(config *conf.RedisConfig) (redis.UniversalClient, error) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	// Validate fills defaults into config, which may be shared by concurrent callers
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	if Client == nil {
-		Client = redis.NewClusterClient(&redis.ClusterOptions{
+		client := newClusterClient(&redis.ClusterOptions{
 			Addrs:         utils.GetServerAdders(config.Address),
 			Password:      config.Password,
 			PoolSize:      config.PoolSize,
 			MaxRetries:    config.MaxRetries,
+			DialTimeout:   config.DialTimeout,
+			ReadTimeout:   config.ReadTimeout,
+			WriteTimeout:  config.WriteTimeout,
 			ReadOnly:      true,
 			RouteRandomly: true,
 		})
 		ctx := context.Background()
-		_, err := Client.Ping(ctx).Result()
+		_, err := client.Ping(ctx).Result()
 		if err != nil {
+			_ = client.Close()
 			return nil, err
 		}
-		_ = redisotel.InstrumentTracing(Client)
+		if err = instrument(client, config); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		Client = client
 	}
 
 	return Client, nil
 }
 
+// CloseRedis closes the client created by GetRedisClient, the next GetRedisClient creates a new one
+func CloseRedis() error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if Client == nil {
+		return nil
+	}
+	err := Client.Close()
+	Client = nil
+	return err
+}
+
+// instrument enables OpenTelemetry tracing, and metrics if configured, on the client
+func instrument(client redis.UniversalClient, config *conf.RedisConfig) error {
+	if err := instrumentTracing(client); err != nil {
+		return fmt.Errorf("instrument redis tracing: %w", err)
+	}
+	if config.EnableMetrics {
+		if err := instrumentMetrics(client); err != nil {
+			return fmt.Errorf("instrument redis metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// CacheOption configures the redis cache
+type CacheOption func(rc *CacheImpl)
+
+// WithLocalFallback serves Get from the local LRU when redis can not be reached.
+// The LRU is populated by successful reads and written through by Set.
+func WithLocalFallback(lru *LRUCache) CacheOption {
+	return func(rc *CacheImpl) {
+		rc.fallback = lru
+	}
+}
+
+// WithLogger sets the logger reporting the fallback hits, nothing is logged by default
+func WithLogger(logger log.Logger) CacheOption {
+	return func(rc *CacheImpl) {
+		if logger != nil {
+			rc.logger = logger
+		}
+	}
+}
+
 // NewRedisCache is the factory of redis cache
-func NewRedisCache(config *conf.RedisConfig, client redis.UniversalClient) Cache {
+func NewRedisCache(config *conf.RedisConfig, client redis.UniversalClient, opts ...CacheOption) Cache {
 	pool := goredis.NewPool(client)
 	rs := redsync.New(pool)
 
-	return &CacheImpl{
+	rc := &CacheImpl{
 		client:     client,
 		rs:         rs,
 		expiration: config.ExpirationSeconds,
+		jitter:     config.ExpirationJitterSeconds,
+		logger:     log.NopLogger,
+	}
+	if rc.jitter == 0 {
+		rc.jitter = conf.DefaultRedisExpirationJitterSeconds
 	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	return rc
 }
 
 // Get returns true if the key already exists and set dst to the corresponding value
 func (rc *CacheImpl) Get(ctx context.Context, key string, dst interface{}) (bool, error) {
 	val, err := rc.client.Get(ctx, key).Result()
 	if errors.Is(err, redis.Nil) {
+		if rc.fallback != nil {
+			rc.fallback.Remove(key)
+		}
 		return false, nil
 	} else if err != nil {
-		return false, err
-	} else {
-		_ = json.Unmarshal([]byte(val), dst)
+		err = wrapError(err)
+		if rc.fallback == nil || !errors.Is(err, ErrConnFailure) {
+			return false, err
+		}
+		cached, ok := rc.fallback.Get(key)
+		if !ok {
+			return false, err
+		}
+		atomic.AddUint64(&rc.fallbackHits, 1)
+		rc.logger.Warnf("redis: serving key %s from the local fallback: %v", key, err)
+		val = cached
+	} else if rc.fallback != nil {
+		rc.fallback.Add(key, val)
 	}
+	_ = json.Unmarshal([]byte(val), dst)
 	return true, nil
 }
 
+// FallbackHits returns the number of Get served from the local fallback
+func (rc *CacheImpl) FallbackHits() uint64 {
+	return atomic.LoadUint64(&rc.fallbackHits)
+}
+
 // Exist checks whether a key exists
 func (rc *CacheImpl) Exist(ctx context.Context, key string) (bool, error) {
 	numExistKey, err := rc.client.Exists(ctx, key).Result()
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 	exist := numExistKey == 1
 	return exist, nil
@@ -172,15 +309,155 @@ func (rc *CacheImpl) Set(ctx context.Context, key string, val interface{}) error
 	if err != nil {
 		return err
 	}
-	if err := rc.client.Set(ctx, key, strVal, utils.GetRandomExpiration(rc.expiration)).Err(); err != nil {
-		return err
+	if err := rc.client.Set(ctx, key, strVal, utils.GetJitteredExpiration(rc.expiration, rc.jitter)).Err(); err != nil {
+		// redis may or may not have stored the value, the fallback must not serve the old one either
+		rc.invalidate(key)
+		return wrapError(err)
+	}
+	if rc.fallback != nil {
+		rc.fallback.Add(key, string(strVal))
 	}
 	return nil
 }
 
+// GetSet atomically sets the key to newVal like Set does and returns true with dst set to the previous value
+// if the key existed. It relies on SET with the GET option, which requires redis 6.2 or later.
+func (rc *CacheImpl) GetSet(ctx context.Context, key string, newVal interface{}, dst interface{}) (bool, error) {
+	strVal, err := json.Marshal(newVal)
+	if err != nil {
+		return false, err
+	}
+	rc.invalidate(key)
+	val, err := rc.client.SetArgs(ctx, key, strVal, redis.SetArgs{
+		TTL: utils.GetJitteredExpiration(rc.expiration, rc.jitter),
+		Get: true,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		return false, wrapError(err)
+	}
+	if err := json.Unmarshal([]byte(val), dst); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// HSet sets a field of the hash stored at key, the value is marshaled as json like Set does
+func (rc *CacheImpl) HSet(ctx context.Context, key, field string, val interface{}) error {
+	strVal, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	rc.invalidate(key)
+	return wrapError(rc.client.HSet(ctx, key, field, strVal).Err())
+}
+
+// HGet returns true if the field exists in the hash and set dst to the corresponding value
+func (rc *CacheImpl) HGet(ctx context.Context, key, field string, dst interface{}) (bool, error) {
+	val, err := rc.client.HGet(ctx, key, field).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		return false, wrapError(err)
+	}
+	if err := json.Unmarshal([]byte(val), dst); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// HGetAll returns all fields of the hash with their raw json values, an empty map is returned if key does not exist
+func (rc *CacheImpl) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	fields, err := rc.client.HGetAll(ctx, key).Result()
+	return fields, wrapError(err)
+}
+
+// ZAdd adds a member with the given score to the sorted set, the score is updated if the member exists
+func (rc *CacheImpl) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return wrapError(rc.client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err())
+}
+
+// ZRangeByScore returns the members with score in [min, max] ordered by score, limit <= 0 means no limit
+func (rc *CacheImpl) ZRangeByScore(ctx context.Context, key string, min, max float64, limit int64) ([]string, error) {
+	opt := &redis.ZRangeBy{
+		Min: strconv.FormatFloat(min, 'f', -1, 64),
+		Max: strconv.FormatFloat(max, 'f', -1, 64),
+	}
+	if limit > 0 {
+		opt.Count = limit
+	}
+	members, err := rc.client.ZRangeByScore(ctx, key, opt).Result()
+	return members, wrapError(err)
+}
+
+// ZRank returns the rank of the member ordered from low to high score, false is returned if the member does not exist
+func (rc *CacheImpl) ZRank(ctx context.Context, key, member string) (int64, bool, error) {
+	rank, err := rc.client.ZRank(ctx, key, member).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, wrapError(err)
+	}
+	return rank, true, nil
+}
+
+// SetNX sets a key-value pair only if the key does not exist, returns true if the key was newly set
+func (rc *CacheImpl) SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error) {
+	strVal, err := json.Marshal(val)
+	if err != nil {
+		return false, err
+	}
+	rc.invalidate(key)
+	ok, err := rc.client.SetNX(ctx, key, strVal, ttl).Result()
+	return ok, wrapError(err)
+}
+
+var compareAndDelete = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// CompareAndDelete atomically deletes the key only if its value equals expected, returns true if the key was deleted
+func (rc *CacheImpl) CompareAndDelete(ctx context.Context, key string, expected interface{}) (bool, error) {
+	strVal, err := json.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+	rc.invalidate(key)
+	deleted, err := compareAndDelete.Run(ctx, rc.client, []string{key}, strVal).Int()
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return deleted == 1, nil
+}
+
+// RunScript runs the lua script with EVALSHA, falling back to EVAL when the server does not have it cached yet.
+// Scripts are compiled once and cached by the SHA1 of their source.
+func (rc *CacheImpl) RunScript(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+	cached, ok := rc.scripts.Load(sha)
+	if !ok {
+		cached, _ = rc.scripts.LoadOrStore(sha, redis.NewScript(script))
+	}
+	// the script may write any of its keys
+	for _, key := range keys {
+		rc.invalidate(key)
+	}
+	res, err := cached.(*redis.Script).Run(ctx, rc.client, keys, args...).Result()
+	if errors.Is(err, redis.Nil) {
+		// a script returning nil is not a failure
+		return nil, nil
+	}
+	return res, wrapError(err)
+}
+
 func (rc *CacheImpl) BFReserve(ctx context.Context, key string, errorRate float64, capacity int64) error {
 	if err := rc.client.Do(ctx, "bf.reserve", key, errorRate, capacity).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
@@ -189,14 +466,14 @@ func (rc *CacheImpl) BFInsert(ctx context.Context, key string, errorRate float64
 	args := []interface{}{"bf.insert", key, "capacity", capacity, "error", errorRate, "items"}
 	args = append(args, items...)
 	if err := rc.client.Do(ctx, args...).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
 
 func (rc *CacheImpl) BFAdd(ctx context.Context, key string, item interface{}) error {
 	if err := rc.client.Do(ctx, "bf.add", key, item).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
@@ -204,21 +481,21 @@ func (rc *CacheImpl) BFAdd(ctx context.Context, key string, item interface{}) er
 func (rc *CacheImpl) BFExist(ctx context.Context, key string, item interface{}) (bool, error) {
 	res, err := rc.client.Do(ctx, "bf.exists", key, item).Int()
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 	return res == 1, nil
 }
 
 func (rc *CacheImpl) CFReserve(ctx context.Context, key string, capacity int64, bucketSize, maxIterations int) error {
 	if err := rc.client.Do(ctx, "cf.reserve", key, capacity, "BUCKETSIZE", bucketSize, "MAXITERATIONS", maxIterations).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
 
 func (rc *CacheImpl) CFAdd(ctx context.Context, key string, item interface{}) error {
 	if err := rc.client.Do(ctx, "cf.add", key, item).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
@@ -226,32 +503,85 @@ func (rc *CacheImpl) CFAdd(ctx context.Context, key string, item interface{}) er
 func (rc *CacheImpl) CFExist(ctx context.Context, key string, item interface{}) (bool, error) {
 	res, err := rc.client.Do(ctx, "cf.exists", key, item).Int()
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 	return res == 1, nil
 }
 
 func (rc *CacheImpl) CFDel(ctx context.Context, key string, item interface{}) error {
 	if err := rc.client.Do(ctx, "cf.del", key, item).Err(); err != nil {
-		return err
+		return wrapError(err)
+	}
+	return nil
+}
+
+// CFCount returns the number of times the item may be in the cuckoo filter, 0 if the filter does not exist
+func (rc *CacheImpl) CFCount(ctx context.Context, key string, item interface{}) (int64, error) {
+	res, err := rc.client.Do(ctx, "cf.count", key, item).Int64()
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	return res, nil
+}
+
+// CFInsert adds the items to the cuckoo filter, the filter is created with the default capacity if it does not exist
+func (rc *CacheImpl) CFInsert(ctx context.Context, key string, items ...interface{}) error {
+	args := []interface{}{"cf.insert", key, "items"}
+	args = append(args, items...)
+	if err := rc.client.Do(ctx, args...).Err(); err != nil {
+		return wrapError(err)
 	}
 	return nil
 }
 
 func (rc *CacheImpl) IncrBy(ctx context.Context, key string, val int64) error {
-	return rc.client.IncrBy(ctx, key, val).Err()
+	rc.invalidate(key)
+	return wrapError(rc.client.IncrBy(ctx, key, val).Err())
 }
 
 // Delete deletes a key
 func (rc *CacheImpl) Delete(ctx context.Context, key string) error {
+	rc.invalidate(key)
 	if err := rc.client.Del(ctx, key).Err(); err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
 
+// invalidate removes the key from the local fallback, every write path calls it
+// so that Get never serves a value older than the last write during an outage
+func (rc *CacheImpl) invalidate(key string) {
+	if rc.fallback != nil {
+		rc.fallback.Remove(key)
+	}
+}
+
+const mutexExpiry = 5 * time.Second
+
 func (rc *CacheImpl) GetMutex(mutexname string) *redsync.Mutex {
-	return rc.rs.NewMutex(mutexname, redsync.WithExpiry(5*time.Second))
+	return rc.rs.NewMutex(mutexname, redsync.WithExpiry(mutexExpiry))
+}
+
+// WithLock acquires the mutex of the name, runs fn and releases the mutex, even if fn panics.
+// The acquisition retries until ctx is done, unlike GetMutex it does not give up after a fixed number of tries.
+// An error wrapping ErrRedisUnlockFail is returned if the release fails, e.g. fn ran beyond the expiry of the mutex;
+// it's joined with the error of fn if any.
+func (rc *CacheImpl) WithLock(ctx context.Context, name string, fn func() error) (err error) {
+	mutex := rc.rs.NewMutex(name, redsync.WithExpiry(mutexExpiry), redsync.WithTries(math.MaxInt32))
+	if err := mutex.LockContext(ctx); err != nil {
+		return fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+	defer func() {
+		// release even when ctx is cancelled while fn is running
+		ok, unlockErr := mutex.UnlockContext(context.WithoutCancel(ctx))
+		switch {
+		case unlockErr != nil:
+			err = errors.Join(err, fmt.Errorf("%w: %s: %w", ErrRedisUnlockFail, name, unlockErr))
+		case !ok:
+			err = errors.Join(err, fmt.Errorf("%w: %s", ErrRedisUnlockFail, name))
+		}
+	}()
+	return fn()
 }
 
 var incrByX = redis.NewScript(`
@@ -272,42 +602,61 @@ func (rc *CacheImpl) ExecPipeLine(ctx context.Context, cmds *[]Cmd) error {
 			if err != nil {
 				return err
 			}
+			rc.invalidate(cmd.Payload.(SetPayload).Key)
 			pipelineCmds = append(pipelineCmds, PipelineCmd{
 				OpType: SET,
-				Cmd:    pipe.Set(ctx, cmd.Payload.(SetPayload).Key, strVal, utils.GetRandomExpiration(rc.expiration)),
+				Cmd:    pipe.Set(ctx, cmd.Payload.(SetPayload).Key, strVal, utils.GetJitteredExpiration(rc.expiration, rc.jitter)),
 			})
 		case DELETE:
+			rc.invalidate(cmd.Payload.(DeletePayload).Key)
 			pipelineCmds = append(pipelineCmds, PipelineCmd{
 				OpType: DELETE,
 				Cmd:    pipe.Del(ctx, cmd.Payload.(DeletePayload).Key),
 			})
 		case INCRBYX:
 			payload := cmd.Payload.(IncrByXPayload)
+			rc.invalidate(payload.Key)
 			pipelineCmds = append(pipelineCmds, PipelineCmd{
 				OpType: INCRBYX,
 				Cmd:    incrByX.Run(ctx, pipe, []string{payload.Key}, payload.Val),
 			})
+		case GET:
+			pipelineCmds = append(pipelineCmds, PipelineCmd{
+				OpType: GET,
+				Cmd:    pipe.Get(ctx, cmd.Payload.(GetPayload).Key),
+			})
 		default:
 			return ErrRedisCmdNotFound
 		}
 	}
+	// a missing key of GET is reported as redis.Nil, which is not a failure of the pipeline
 	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return err
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return wrapError(err)
 	}
 
-	for _, executedCmd := range pipelineCmds {
+	for i, executedCmd := range pipelineCmds {
 		switch executedCmd.OpType {
 		case SET:
 			if err := executedCmd.Cmd.(*redis.StatusCmd).Err(); err != nil {
-				return err
+				return wrapError(err)
 			}
 		case DELETE:
 			if err := executedCmd.Cmd.(*redis.IntCmd).Err(); err != nil {
-				return err
+				return wrapError(err)
 			}
 		case INCRBYX:
 			if err := executedCmd.Cmd.(*redis.Cmd).Err(); err != nil {
+				return wrapError(err)
+			}
+		case GET:
+			val, err := executedCmd.Cmd.(*redis.StringCmd).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			} else if err != nil {
+				return wrapError(err)
+			}
+			if err := json.Unmarshal([]byte(val), (*cmds)[i].Payload.(GetPayload).Dst); err != nil {
 				return err
 			}
 		}
@@ -320,7 +669,50 @@ func (rc *CacheImpl) Publish(ctx context.Context, topic string, payload interfac
 	if err != nil {
 		return err
 	}
-	return rc.client.Publish(ctx, topic, strVal).Err()
+	return wrapError(rc.client.Publish(ctx, topic, strVal).Err())
+}
+
+// Message is a message received from a subscription
+type Message struct {
+	// Topic is the channel the message was published to
+	Topic string
+	// Pattern is the pattern matching the topic
+	Pattern string
+	// Payload is the json published by Publish
+	Payload string
+}
+
+// PSubscribe subscribes to the topics matching the glob style patterns, e.g. order.* receives order.created.
+// The returned channel is closed and the subscription released once ctx is done.
+func (rc *CacheImpl) PSubscribe(ctx context.Context, patterns ...string) (<-chan Message, error) {
+	pubsub := rc.client.PSubscribe(ctx, patterns...)
+	// wait for the confirmation so messages published after PSubscribe returns are not missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, wrapError(err)
+	}
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- Message{Topic: msg.Channel, Pattern: msg.Pattern, Payload: msg.Payload}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return messages, nil
 }
 
 func (rc *CacheImpl) TopKAdd(ctx context.Context, topic string, payload interface{}) error {
@@ -328,7 +720,7 @@ func (rc *CacheImpl) TopKAdd(ctx context.Context, topic string, payload interfac
 	if err != nil {
 		return err
 	}
-	return rc.client.TopKAdd(ctx, topic, strVal).Err()
+	return wrapError(rc.client.TopKAdd(ctx, topic, strVal).Err())
 }
 
 func (rc *CacheImpl) TopKQuery(ctx context.Context, topic string, payload interface{}) ([]bool, error) {
@@ -336,5 +728,75 @@ func (rc *CacheImpl) TopKQuery(ctx context.Context, topic string, payload interf
 	if err != nil {
 		return nil, err
 	}
-	return rc.client.TopKQuery(ctx, topic, strVal).Result()
+	exists, err := rc.client.TopKQuery(ctx, topic, strVal).Result()
+	return exists, wrapError(err)
+}
+
+// Iterator walks the keys returned by a cursor based scan
+type Iterator interface {
+	// Next returns the next key, false is returned once all keys have been visited
+	Next(ctx context.Context) (string, bool, error)
+}
+
+// scanIterator pages SCAN cursors over every node it holds
+type scanIterator struct {
+	nodes   []redis.Cmdable
+	match   string
+	count   int64
+	idx     int
+	cursor  uint64
+	started bool
+	keys    []string
+	pos     int
+}
+
+// Scan returns an iterator over the keys matching the pattern without blocking the server like KEYS does.
+// In cluster mode every master is scanned in turn.
+func (rc *CacheImpl) Scan(ctx context.Context, match string, count int64) (Iterator, error) {
+	var nodes []redis.Cmdable
+	if cluster, ok := rc.client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			nodes = append(nodes, master)
+			return nil
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+	} else {
+		nodes = append(nodes, rc.client)
+	}
+	return &scanIterator{
+		nodes: nodes,
+		match: match,
+		count: count,
+	}, nil
+}
+
+// Next implements Iterator
+func (it *scanIterator) Next(ctx context.Context) (string, bool, error) {
+	for {
+		if it.pos < len(it.keys) {
+			key := it.keys[it.pos]
+			it.pos++
+			return key, true, nil
+		}
+		if it.idx >= len(it.nodes) {
+			return "", false, nil
+		}
+		// the cursor of the current node has been exhausted, move to the next one
+		if it.started && it.cursor == 0 {
+			it.idx++
+			it.started = false
+			continue
+		}
+		keys, cursor, err := it.nodes[it.idx].Scan(ctx, it.cursor, it.match, it.count).Result()
+		if err != nil {
+			return "", false, wrapError(err)
+		}
+		it.keys, it.pos = keys, 0
+		it.cursor, it.started = cursor, true
+	}
 }
@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrKeyNotFound is returned when the key does not exist, it wraps redis.Nil
+	ErrKeyNotFound = errors.New("redis key not found")
+	// ErrWrongType is returned when the operation is against a key holding the wrong kind of value
+	ErrWrongType = errors.New("redis wrong type")
+	// ErrConnFailure is returned when the server can not be reached or the connection is broken
+	ErrConnFailure = errors.New("redis connection failure")
+)
+
+// wrapError wraps the go-redis error into one of the typed errors, so both errors.Is(err, ErrWrongType)
+// and errors.Is(err, redis.Nil) keep working. Errors that do not fall into any category are returned as is.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed error
+	var netErr net.Error
+	var redisErr redis.Error
+	switch {
+	case errors.Is(err, redis.Nil):
+		typed = ErrKeyNotFound
+	case errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "WRONGTYPE"):
+		typed = ErrWrongType
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, redis.ErrClosed):
+		typed = ErrConnFailure
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", typed, err)
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/longpi1/gopkg/libary/conf"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTypedErrors(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	mr, cache := newTestCache(t)
+
+	// a string key can not be used as a hash or sorted set
+	is.NoError(cache.Set(ctx, "user", "alice"))
+	var dst string
+	_, err := cache.HGet(ctx, "user", "name", &dst)
+	is.True(errors.Is(err, ErrWrongType))
+	err = cache.ZAdd(ctx, "user", 1, "alice")
+	is.True(errors.Is(err, ErrWrongType))
+	is.False(errors.Is(err, ErrConnFailure))
+
+	mr.Close()
+	_, err = cache.Exist(ctx, "user")
+	is.True(errors.Is(err, ErrConnFailure))
+}
+
+func TestWrapError(t *testing.T) {
+	is := assert.New(t)
+
+	is.NoError(wrapError(nil))
+	err := wrapError(redis.Nil)
+	is.True(errors.Is(err, ErrKeyNotFound))
+	is.True(errors.Is(err, redis.Nil))
+	is.True(errors.Is(wrapError(redis.ErrClosed), ErrConnFailure))
+
+	// unknown errors are returned as is
+	other := fmt.Errorf("ERR syntax error")
+	is.Equal(other, wrapError(other))
+}
+
+func TestClosedClientError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	cache := NewRedisCache(&conf.RedisConfig{}, client)
+	_ = client.Close()
+	assert.ErrorIs(t, cache.IncrBy(context.Background(), "counter", 1), ErrConnFailure)
+}
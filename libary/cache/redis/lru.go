@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUCache is a size bounded in-memory cache evicting the least recently used entry,
+// it keeps the raw json values read from and written to redis
+type LRUCache struct {
+	lock  sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	val string
+}
+
+// NewLRUCache returns a LRUCache holding at most size entries
+func NewLRUCache(size int) *LRUCache {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of the key and marks it as recently used
+func (c *LRUCache) Get(key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*lruEntry).val, true
+}
+
+// Add sets the value of the key, the least recently used entry is evicted if the cache is full
+func (c *LRUCache) Add(key, val string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry).val = val
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, val: val})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Remove removes the key from the cache
+func (c *LRUCache) Remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Len returns the number of entries in the cache
+func (c *LRUCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.ll.Len()
+}
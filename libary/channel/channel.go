@@ -16,15 +16,32 @@ package channel
 
 import (
 	"container/list"
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/longpi1/gopkg/libary/hardware"
+	"github.com/longpi1/gopkg/libary/log"
+	"github.com/longpi1/gopkg/libary/metrics"
 )
 
 const (
 	defaultThrottleWindow = time.Millisecond * 100
 	defaultMinSize        = 1
+	// minExpirySweepInterval 主动过期扫描的最小间隔
+	minExpirySweepInterval = time.Millisecond
+)
+
+// WithMetrics 上报的指标名称
+const (
+	// MetricProduced 已经插入到缓冲区的数据项数量，计数器
+	MetricProduced = "channel_produced_total"
+	// MetricConsumed 已经消费（包括因超时丢弃）的数据项数量，计数器
+	MetricConsumed = "channel_consumed_total"
+	// MetricBuffered 未消费的数据项数量
+	MetricBuffered = "channel_buffered"
 )
 
 // item 代表通道中的一个数据项。
@@ -33,6 +50,10 @@ type item struct {
 	value interface{}
 	// deadline 表示数据项的过期时间。
 	deadline time.Time
+	// size 表示数据项占用的近似字节数，仅在设置了 WithMaxBytes 时计算。
+	size int64
+	// enqueuedAt 表示数据项进入缓冲区的时间，仅在设置了 WithSlowConsumerCallback 时记录。
+	enqueuedAt time.Time
 }
 
 // IsExpired 检查数据项是否已过期。
@@ -78,13 +99,88 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithMaxBytes 设置缓冲区中数据项占用的近似字节数上限，sizer 用于计算每个数据项的大小。
+// 超过上限时，阻塞模式下生产者会等待，非阻塞模式下数据项会被丢弃。
+// 缓冲区为空时总是允许写入一个数据项，避免单个数据项超过上限时永久阻塞。
+func WithMaxBytes(n int64, sizer func(interface{}) int64) Option {
+	return func(c *channel) {
+		if n > 0 && sizer != nil {
+			c.maxBytes = n
+			c.sizer = sizer
+		}
+	}
+}
+
+// WithHighWaterMark 设置缓冲深度的高水位线，用于向自动扩缩容等组件发出信号。
+// Len() 超过 threshold 时调用一次 onCross，之后降到 threshold 以下时再调用一次，
+// 两次越过之间不会重复调用。onCross 在生产者或消费者的 goroutine 中同步执行，应尽快返回。
+func WithHighWaterMark(threshold int, onCross func(len int)) Option {
+	return func(c *channel) {
+		if threshold > 0 && onCross != nil {
+			c.highWaterMark = threshold
+			c.onHighWaterMark = onCross
+		}
+	}
+}
+
+// WithSlowConsumerCallback 设置慢消费者的回调，数据项从进入缓冲区到被取出的等待时间超过 threshold 时调用 cb，
+// 用于在缓冲区溢出之前发出预警。连续的慢数据项只调用一次，出现等待时间未超过 threshold 的数据项后才会再次调用。
+// cb 在消费 goroutine 中同步执行，应尽快返回。
+func WithSlowConsumerCallback(threshold time.Duration, cb func()) Option {
+	return func(c *channel) {
+		if threshold > 0 && cb != nil {
+			c.slowThreshold = threshold
+			c.onSlowConsumer = cb
+		}
+	}
+}
+
+// WithContext 将通道的生命周期与 ctx 绑定，ctx 取消时通道自动关闭，效果与调用 Close 相同：
+// 缓冲区中剩余的数据项继续发送到 Output（过期的数据项按 WithTimeout 丢弃），之后关闭 Output，消费 goroutine 退出。
+func WithContext(ctx context.Context) Option {
+	return func(c *channel) {
+		c.ctx = ctx
+	}
+}
+
+// WithActiveExpiry 启动后台扫描，每隔 WithTimeout 设置的超时时间的一半检查一次缓冲区，及时丢弃已过期的数据项并调用超时回调。
+// 默认只在数据项出队时检查是否过期，消费者阻塞时排在后面的数据项要等到出队才会被丢弃，超时回调也会延迟执行。
+// 未设置 WithTimeout 时不生效。
+// 后台扫描与消费协程都会丢弃过期数据项，超时回调可能被两者并发调用，且调用顺序不保证与数据项入队顺序一致，
+// 回调函数需要是并发安全的。
+func WithActiveExpiry() Option {
+	return func(c *channel) {
+		c.activeExpiry = true
+	}
+}
+
 // WithTimeoutCallback 设置数据项超时时的回调函数。
+// 同时设置 WithActiveExpiry 时回调可能被并发调用，需要是并发安全的。
 func WithTimeoutCallback(timeoutCallback func(interface{})) Option {
 	return func(c *channel) {
 		c.timeoutCallback = timeoutCallback
 	}
 }
 
+// WithLogger 设置通道内部事件（丢弃数据项、限流等待等）的日志，默认不输出日志。
+func WithLogger(logger log.Logger) Option {
+	return func(c *channel) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// WithMetrics 设置指标收集器，数据项进入缓冲区时上报 MetricProduced，被消费或因超时丢弃时上报 MetricConsumed，
+// 两者都会更新 MetricBuffered，计数与 Stats 一致。默认不上报指标。
+func WithMetrics(m metrics.Metrics) Option {
+	return func(c *channel) {
+		if m != nil {
+			c.metrics = m
+		}
+	}
+}
+
 // WithThrottle 设置生产者和消费者的限流函数。
 // 如果生产者限流器触发，则输入通道会被阻塞（如果使用阻塞模式）。
 // 如果消费者限流器触发，则输出通道会被阻塞。
@@ -155,6 +251,30 @@ func WithRateThrottle(produceRate, consumeRate int) Option {
 	})
 }
 
+var (
+	// memoryUseRatio 获取内存使用率，测试时可替换
+	memoryUseRatio = hardware.GetMemoryUseRatio
+	// memorySampleInterval 内存使用率的采样间隔，避免每次调用限流函数都读取系统信息
+	memorySampleInterval = defaultThrottleWindow
+)
+
+// MemoryPressureThrottle 返回一个限流函数，当进程内存使用率超过 highWatermark（0~1）时触发限流。
+// 可以通过 WithThrottle 与其他限流函数组合使用。
+func MemoryPressureThrottle(highWatermark float64) Throttle {
+	var lock sync.Mutex
+	var sampledAt time.Time
+	var ratio float64
+	return func(c Channel) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		if now := time.Now(); now.Sub(sampledAt) >= memorySampleInterval {
+			ratio = memoryUseRatio()
+			sampledAt = now
+		}
+		return ratio > highWatermark
+	}
+}
+
 var (
 	_ Channel = (*channel)(nil)
 )
@@ -165,10 +285,14 @@ type Channel interface {
 	Input(v interface{})
 	// Output 返回一个只读的原生通道给消费者
 	Output() <-chan interface{}
+	// OutputBatch 返回一个按批次输出的只读通道，与 Output 竞争消费同一批数据项
+	OutputBatch(maxBatch int, maxWait time.Duration) <-chan []interface{}
 	// Len 返回未消费项的数量
 	Len() int
 	// Stats 返回已生产和已消费的计数
 	Stats() (produced uint64, consumed uint64)
+	// Dropped 返回因超时和因超过缓冲区上限而丢弃的数据项计数
+	Dropped() (timedOut uint64, overflowed uint64)
 	// Close 关闭输出通道。如果通道没有明确关闭，它将在 finalize 时关闭
 	Close()
 }
@@ -186,16 +310,36 @@ type channel struct {
 	nonblock         bool // 非阻塞模式
 	timeout          time.Duration
 	timeoutCallback  func(interface{})
+	activeExpiry     bool     // 是否在后台扫描过期的数据项
 	producerThrottle Throttle // 假设 Throttle 是一个用于节流的接口或函数类型
 	consumerThrottle Throttle
 	throttleWindow   time.Duration
+	maxBytes         int64                   // 缓冲区字节数上限
+	sizer            func(interface{}) int64 // 计算数据项的字节数
 	// 统计信息
-	produced uint64 // 已经插入到缓冲区的项目
-	consumed uint64 // 已经发送到 Output 通道的项目
+	produced   uint64 // 已经插入到缓冲区的项目
+	consumed   uint64 // 已经发送到 Output 通道的项目
+	timedOut   uint64 // 因超时被丢弃的项目
+	overflowed uint64 // 因超过缓冲区上限被丢弃的项目
 	// 缓冲区
-	buffer     *list.List // TODO：使用高性能队列以减少GC
-	bufferCond *sync.Cond
-	bufferLock sync.Mutex
+	buffer      *list.List // TODO：使用高性能队列以减少GC
+	bufferBytes int64      // 缓冲区中数据项的字节数，由 bufferLock 保护
+	bufferCond  *sync.Cond
+	bufferLock  sync.Mutex
+
+	logger  log.Logger      // 内部事件的日志
+	metrics metrics.Metrics // 生产、消费数量等指标
+
+	highWaterMark   int           // 缓冲深度的高水位线
+	onHighWaterMark func(len int) // 越过高水位线时的回调
+	aboveHighWater  int32         // 当前是否高于高水位线，1表示高于
+
+	slowThreshold  time.Duration // 数据项在缓冲区中等待时间的阈值
+	onSlowConsumer func()        // 等待时间超过阈值时的回调
+	slow           bool          // 上一个数据项的等待时间是否超过阈值，只由消费 goroutine 访问
+
+	ctx         context.Context // 绑定生命周期的 context
+	stopContext func() bool     // 取消 ctx 上注册的关闭函数
 }
 
 // New 创建并返回一个新的通道，应用所有提供的选项
@@ -204,12 +348,21 @@ func New(opts ...Option) Channel {
 	c.size = defaultMinSize
 	c.throttleWindow = defaultThrottleWindow
 	c.bufferCond = sync.NewCond(&c.bufferLock)
+	c.logger = log.NopLogger
+	c.metrics = metrics.NopMetrics
 	for _, opt := range opts {
 		opt(c) // 应用每个选项来配置通道
 	}
 	c.consumer = make(chan interface{})
 	c.buffer = list.New()
+	if c.ctx != nil {
+		// ctx 取消时关闭通道
+		c.stopContext = context.AfterFunc(c.ctx, c.Close)
+	}
 	go c.consume() // 在一个独立的goroutine中开始消费
+	if c.activeExpiry && c.timeout > 0 {
+		go c.sweepExpired()
+	}
 
 	// 使用包装器以确保通道在不再被引用时关闭
 	cw := &channelWrapper{c}
@@ -224,6 +377,9 @@ func (c *channel) Close() {
 	if !atomic.CompareAndSwapInt32(&c.state, 0, -1) {
 		return // 如果已经关闭或正在关闭，则返回
 	}
+	if c.stopContext != nil {
+		c.stopContext() // 通道已关闭，不再需要监听 ctx
+	}
 	c.bufferCond.Broadcast() // 通知所有等待的goroutine
 }
 
@@ -243,6 +399,9 @@ func (c *channel) Input(v interface{}) {
 	if c.timeout > 0 {
 		it.deadline = time.Now().Add(c.timeout)
 	}
+	if c.maxBytes > 0 {
+		it.size = c.sizer(v)
+	}
 
 	// 在阻塞模式下检查节流功能
 	if !c.nonblock && c.throttling(c.producerThrottle) {
@@ -252,7 +411,7 @@ func (c *channel) Input(v interface{}) {
 	c.bufferLock.Lock()
 	if !c.nonblock {
 		// 在阻塞模式下，如果缓冲区已满，则等待
-		for c.buffer.Len() >= c.size {
+		for c.buffer.Len() >= c.size || c.exceedsMaxBytes(it.size) {
 			c.bufferCond.Wait()
 			if c.isClosed() {
 				c.bufferLock.Unlock()
@@ -260,10 +419,21 @@ func (c *channel) Input(v interface{}) {
 			}
 		}
 	}
+	if c.nonblock && c.exceedsMaxBytes(it.size) {
+		// 在非阻塞模式下，超过字节数上限的数据项被丢弃
+		bufferBytes := c.bufferBytes
+		c.bufferLock.Unlock()
+		atomic.AddUint64(&c.overflowed, 1)
+		c.logger.Warnf("channel: item of %d bytes dropped, buffer holds %d of max %d bytes", it.size, bufferBytes, c.maxBytes)
+		return
+	}
 	c.enqueueBuffer(it)
 	atomic.AddUint64(&c.produced, 1)
 	c.bufferLock.Unlock()
 	c.bufferCond.Signal() // 使用 Signal 因为只有一个goroutine在等待条件
+	c.metrics.IncCounter(MetricProduced, 1)
+	c.reportBuffered()
+	c.checkHighWaterMark()
 }
 
 // Output 为消费者提供一个只读通道
@@ -271,6 +441,47 @@ func (c *channel) Output() <-chan interface{} {
 	return c.consumer
 }
 
+// OutputBatch 从 Output 中读取数据项并按批次输出，适用于批量写入数据库等场景。
+// 攒够 maxBatch 个数据项，或距离批次中第一个数据项到达已过去 maxWait 时输出一个批次，以先到者为准；
+// maxWait 小于等于0时只按数量输出。通道关闭时会输出剩余不足一批的数据项，然后关闭返回的通道。
+func (c *channel) OutputBatch(maxBatch int, maxWait time.Duration) <-chan []interface{} {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	batches := make(chan []interface{})
+	go func() {
+		defer close(batches)
+		var batch []interface{}
+		var deadline <-chan time.Time // 当前批次的超时，批次为空时为nil
+		flush := func() {
+			batches <- batch
+			batch = nil
+			deadline = nil
+		}
+		for {
+			select {
+			case v, ok := <-c.consumer:
+				if !ok {
+					if len(batch) > 0 {
+						flush()
+					}
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					deadline = time.After(maxWait)
+				}
+				if len(batch) >= maxBatch {
+					flush()
+				}
+			case <-deadline:
+				flush()
+			}
+		}
+	}()
+	return batches
+}
+
 // Len 返回未消费项的数量
 func (c *channel) Len() int {
 	produced, consumed := c.Stats()
@@ -284,6 +495,12 @@ func (c *channel) Stats() (uint64, uint64) {
 	return produced, consumed
 }
 
+// Dropped 返回因超时和因超过缓冲区上限而丢弃的数据项数量，可用于数据丢失时告警。
+// 因超时丢弃的数据项同时计入 Stats 的已消费计数，因超过上限丢弃的数据项不计入已生产计数。
+func (c *channel) Dropped() (uint64, uint64) {
+	return atomic.LoadUint64(&c.timedOut), atomic.LoadUint64(&c.overflowed)
+}
+
 // consume 方法用于处理输入缓冲区
 func (c *channel) consume() {
 	for {
@@ -317,20 +534,97 @@ func (c *channel) consume() {
 			continue
 		}
 
+		c.checkSlowConsumer(it)
 		// 检查消息是否过期
 		if it.IsExpired() {
-			if c.timeoutCallback != nil {
-				// 如果有超时回调，则执行回调函数
-				c.timeoutCallback(it.value)
-			}
-			// 增加消费计数
-			atomic.AddUint64(&c.consumed, 1)
+			c.dropExpired(it)
 			continue
 		}
 		// 发送数据到消费者通道，如果这里阻塞，表示消费者正忙
 		c.consumer <- it.value
 		// 更新已消费的消息数量
 		atomic.AddUint64(&c.consumed, 1)
+		c.metrics.IncCounter(MetricConsumed, 1)
+		c.reportBuffered()
+		c.checkHighWaterMark()
+	}
+}
+
+// dropExpired 丢弃一个已过期的数据项
+func (c *channel) dropExpired(it item) {
+	c.logger.Debugf("channel: item expired after %v and dropped", c.timeout)
+	atomic.AddUint64(&c.timedOut, 1)
+	if c.timeoutCallback != nil {
+		// 如果有超时回调，则执行回调函数
+		c.timeoutCallback(it.value)
+	}
+	// 增加消费计数
+	atomic.AddUint64(&c.consumed, 1)
+	c.metrics.IncCounter(MetricConsumed, 1)
+	c.reportBuffered()
+	c.checkHighWaterMark()
+}
+
+// reportBuffered 上报未消费的数据项数量
+func (c *channel) reportBuffered() {
+	c.metrics.SetGauge(MetricBuffered, float64(c.Len()))
+}
+
+// sweepExpired 定期从缓冲区头部移除已过期的数据项，直到通道关闭。
+// 所有数据项的超时时间相同，缓冲区中越靠前的数据项越早过期，遇到未过期的数据项即可停止扫描
+func (c *channel) sweepExpired() {
+	interval := max(c.timeout/2, minExpirySweepInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if c.isClosed() {
+			return
+		}
+		var expired []item
+		c.bufferLock.Lock()
+		for front := c.buffer.Front(); front != nil && front.Value.(item).IsExpired(); front = c.buffer.Front() {
+			it, _ := c.dequeueBuffer()
+			expired = append(expired, it)
+		}
+		c.bufferLock.Unlock()
+		if len(expired) == 0 {
+			continue
+		}
+		// 唤醒等待缓冲区空间的生产者
+		c.bufferCond.Broadcast()
+		for _, it := range expired {
+			c.dropExpired(it)
+		}
+	}
+}
+
+// checkSlowConsumer 检查数据项在缓冲区中的等待时间，从不慢变为慢时调用回调
+func (c *channel) checkSlowConsumer(it item) {
+	if c.onSlowConsumer == nil {
+		return
+	}
+	slow := time.Since(it.enqueuedAt) > c.slowThreshold
+	if slow && !c.slow {
+		c.logger.Warnf("channel: item waited more than %v in the buffer, consumer is slow", c.slowThreshold)
+		c.onSlowConsumer()
+	}
+	c.slow = slow
+}
+
+// checkHighWaterMark 检查缓冲深度是否越过高水位线，只在状态变化时调用回调
+func (c *channel) checkHighWaterMark() {
+	if c.onHighWaterMark == nil {
+		return
+	}
+	length := c.Len()
+	if length > c.highWaterMark {
+		if atomic.CompareAndSwapInt32(&c.aboveHighWater, 0, 1) {
+			c.onHighWaterMark(length)
+		}
+	} else if length < c.highWaterMark {
+		if atomic.CompareAndSwapInt32(&c.aboveHighWater, 1, 0) {
+			c.onHighWaterMark(length)
+		}
 	}
 }
 
@@ -343,6 +637,7 @@ func (c *channel) throttling(throttle Throttle) (closed bool) {
 	if !throttled {
 		return false // 如果不需限流，也直接返回
 	}
+	c.logger.Debugf("channel: throttled, rechecking every %v", c.throttleWindow)
 	ticker := time.NewTicker(c.throttleWindow)
 	defer ticker.Stop()
 
@@ -356,9 +651,18 @@ func (c *channel) throttling(throttle Throttle) (closed bool) {
 	return closed
 }
 
+// exceedsMaxBytes 判断加入 size 字节的数据项后是否超过字节数上限，调用方需持有 bufferLock
+func (c *channel) exceedsMaxBytes(size int64) bool {
+	return c.maxBytes > 0 && c.buffer.Len() > 0 && c.bufferBytes+size > c.maxBytes
+}
+
 // enqueueBuffer 将一个item加入到缓冲区的末尾
 func (c *channel) enqueueBuffer(it item) {
+	if c.onSlowConsumer != nil {
+		it.enqueuedAt = time.Now()
+	}
 	c.buffer.PushBack(it)
+	c.bufferBytes += it.size
 }
 
 // dequeueBuffer 从缓冲区取出一个item
@@ -370,5 +674,6 @@ func (c *channel) dequeueBuffer() (it item, ok bool) {
 	c.buffer.Remove(bi)
 
 	it = bi.Value.(item)
+	c.bufferBytes -= it.size
 	return it, true
 }
@@ -15,6 +15,7 @@
 package channel
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -498,3 +499,436 @@ func TestChannelInputAndClose(t *testing.T) {
 	cost := time.Now().Sub(begin)
 	assert.True(t, cost.Milliseconds() >= 100)
 }
+
+func TestChannelMaxBytesNonBlock(t *testing.T) {
+	ch := New(WithNonBlock(), WithMaxBytes(25, func(interface{}) int64 { return 10 }))
+	defer ch.Close()
+
+	ch.Input(0)
+	// wait for the consumer goroutine to take the first item out of the buffer
+	time.Sleep(time.Millisecond * 10)
+	for i := 1; i <= 10; i++ {
+		ch.Input(i)
+	}
+	// 1 in flight + 2 buffered, the others exceed the budget and are dropped
+	produced, _ := ch.Stats()
+	assert.Equal(t, uint64(3), produced)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i, <-ch.Output())
+	}
+	ch.Input(11)
+	assert.Equal(t, 11, <-ch.Output())
+}
+
+func TestChannelMaxBytesBlock(t *testing.T) {
+	ch := New(WithSize(100), WithMaxBytes(25, func(interface{}) int64 { return 10 }))
+	defer ch.Close()
+
+	var sum int32
+	go func() {
+		for i := 0; i < 5; i++ {
+			ch.Input(i)
+			atomic.AddInt32(&sum, 1)
+		}
+	}()
+	time.Sleep(time.Millisecond * 100)
+	// 1 in flight + 2 buffered, the producer is blocked by the byte budget rather than the size
+	assert.Equal(t, int32(3), atomic.LoadInt32(&sum))
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i, <-ch.Output())
+	}
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&sum))
+}
+
+func TestMemoryPressureThrottle(t *testing.T) {
+	var ratio atomic.Value
+	ratio.Store(0.5)
+	originRatio, originInterval := memoryUseRatio, memorySampleInterval
+	memoryUseRatio = func() float64 { return ratio.Load().(float64) }
+	memorySampleInterval = 0
+	defer func() {
+		memoryUseRatio, memorySampleInterval = originRatio, originInterval
+	}()
+
+	throttle := MemoryPressureThrottle(0.8)
+	assert.False(t, throttle(nil))
+	ratio.Store(0.9)
+	assert.True(t, throttle(nil))
+
+	ch := New(
+		WithSize(10),
+		WithThrottle(MemoryPressureThrottle(0.8), nil),
+		WithThrottleWindow(time.Millisecond*10),
+	)
+	defer ch.Close()
+
+	var produced int32
+	go func() {
+		ch.Input(1)
+		atomic.AddInt32(&produced, 1)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	// the producer is throttled while the memory ratio is above the watermark
+	assert.Equal(t, int32(0), atomic.LoadInt32(&produced))
+
+	ratio.Store(0.5)
+	assert.Equal(t, 1, <-ch.Output())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&produced) == 1
+	}, time.Second, time.Millisecond*10)
+}
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) { l.record("debug", format, args...) }
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) { l.record("warn", format, args...) }
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) { l.record("error", format, args...) }
+
+func (l *recordLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestChannelWithLogger(t *testing.T) {
+	logger := &recordLogger{}
+	ch := New(
+		WithNonBlock(),
+		WithMaxBytes(10, func(interface{}) int64 { return 10 }),
+		WithTimeout(time.Millisecond*10),
+		WithLogger(logger),
+	)
+	defer ch.Close()
+
+	// nobody reads Output: 1 item waits in the consumer goroutine, the second is buffered, the third is dropped
+	for i := 0; i < 3; i++ {
+		ch.Input(i)
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Contains(t, logger.Lines(), "warn channel: item of 10 bytes dropped, buffer holds 10 of max 10 bytes")
+
+	time.Sleep(time.Millisecond * 20)
+	<-ch.Output()
+	// the buffered item expired while waiting
+	assert.Eventually(t, func() bool {
+		for _, line := range logger.Lines() {
+			if line == "debug channel: item expired after 10ms and dropped" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestChannelThrottleLogged(t *testing.T) {
+	logger := &recordLogger{}
+	var throttled int32 = 1
+	ch := New(
+		WithThrottle(nil, func(c Channel) bool { return atomic.LoadInt32(&throttled) == 1 }),
+		WithThrottleWindow(time.Millisecond*10),
+		WithLogger(logger),
+	)
+	defer ch.Close()
+
+	ch.Input(1)
+	time.Sleep(time.Millisecond * 20)
+	atomic.StoreInt32(&throttled, 0)
+	assert.Equal(t, 1, <-ch.Output())
+	assert.Contains(t, logger.Lines(), "debug channel: throttled, rechecking every 10ms")
+}
+
+func TestChannelHighWaterMark(t *testing.T) {
+	var mu sync.Mutex
+	var crossings []int
+	ch := New(WithSize(100), WithHighWaterMark(3, func(len int) {
+		mu.Lock()
+		defer mu.Unlock()
+		crossings = append(crossings, len)
+	}))
+	defer ch.Close()
+	got := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), crossings...)
+	}
+
+	for i := 0; i < 3; i++ {
+		ch.Input(i)
+	}
+	assert.Empty(t, got())
+	// exceeding the threshold fires once, going further does not fire again
+	ch.Input(3)
+	ch.Input(4)
+	assert.Equal(t, []int{4}, got())
+
+	// 5 -> 3 does not drop below the threshold yet
+	<-ch.Output()
+	<-ch.Output()
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, []int{4}, got())
+	<-ch.Output()
+	assert.Eventually(t, func() bool { return len(got()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []int{4, 2}, got())
+
+	// crossing again fires again
+	ch.Input(5)
+	ch.Input(6)
+	assert.Equal(t, []int{4, 2, 4}, got())
+}
+
+func TestChannelOutputBatch(t *testing.T) {
+	// size trigger
+	ch := New(WithSize(100))
+	batches := ch.OutputBatch(3, time.Hour)
+	for i := 0; i < 6; i++ {
+		ch.Input(i)
+	}
+	assert.Equal(t, []interface{}{0, 1, 2}, <-batches)
+	assert.Equal(t, []interface{}{3, 4, 5}, <-batches)
+	ch.Close()
+	_, ok := <-batches
+	assert.False(t, ok)
+
+	// time trigger
+	ch = New(WithSize(100))
+	batches = ch.OutputBatch(100, time.Millisecond*50)
+	begin := time.Now()
+	ch.Input(0)
+	ch.Input(1)
+	assert.Equal(t, []interface{}{0, 1}, <-batches)
+	assert.GreaterOrEqual(t, time.Since(begin), time.Millisecond*50)
+
+	// a partial batch is flushed on close
+	ch.Input(2)
+	ch.Close()
+	assert.Equal(t, []interface{}{2}, <-batches)
+	_, ok = <-batches
+	assert.False(t, ok)
+}
+
+func TestChannelWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := New(WithSize(10), WithContext(ctx))
+	ch.Input(1)
+	ch.Input(2)
+	cancel()
+
+	// the remaining items are drained, then the output channel is closed
+	var values []interface{}
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case v, ok := <-ch.Output():
+			if !ok {
+				done = true
+				break
+			}
+			values = append(values, v)
+		case <-timeout:
+			t.Fatal("output channel not closed after context cancel")
+		}
+	}
+	assert.Equal(t, []interface{}{1, 2}, values)
+
+	// inputs after cancel are ignored
+	ch.Input(3)
+	assert.Equal(t, 0, ch.Len())
+	// Close after cancel is safe
+	ch.Close()
+}
+
+func TestChannelDropped(t *testing.T) {
+	var callbacks int32
+	ch := New(
+		WithSize(10),
+		WithTimeout(time.Millisecond*10),
+		WithTimeoutCallback(func(interface{}) { atomic.AddInt32(&callbacks, 1) }),
+	)
+	defer ch.Close()
+
+	// a slow consumer: the first item waits in the consumer goroutine, the others expire in the buffer
+	for i := 0; i < 5; i++ {
+		ch.Input(i)
+	}
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, 0, <-ch.Output())
+	assert.Eventually(t, func() bool {
+		timedOut, _ := ch.Dropped()
+		return timedOut == 4
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&callbacks))
+	_, overflowed := ch.Dropped()
+	assert.Equal(t, uint64(0), overflowed)
+
+	ch = New(WithNonBlock(), WithMaxBytes(10, func(interface{}) int64 { return 10 }))
+	defer ch.Close()
+	// nobody reads Output: 1 item waits in the consumer goroutine, the second is buffered, the others are dropped
+	for i := 0; i < 5; i++ {
+		ch.Input(i)
+		time.Sleep(time.Millisecond * 5)
+	}
+	timedOut, overflowed := ch.Dropped()
+	assert.Equal(t, uint64(0), timedOut)
+	assert.Equal(t, uint64(3), overflowed)
+}
+
+func TestChannelActiveExpiry(t *testing.T) {
+	expiredAt := make(chan time.Time, 10)
+	ch := New(
+		WithSize(10),
+		WithTimeout(time.Millisecond*50),
+		WithActiveExpiry(),
+		WithTimeoutCallback(func(v interface{}) { expiredAt <- time.Now() }),
+	)
+	defer ch.Close()
+
+	// nobody reads Output: the head item waits in the consumer goroutine, the buried one expires in the buffer
+	start := time.Now()
+	ch.Input("head")
+	ch.Input("buried")
+	select {
+	case at := <-expiredAt:
+		assert.Less(t, at.Sub(start), time.Millisecond*100)
+	case <-time.After(time.Second):
+		t.Fatal("timeout callback of the buried item was not called")
+	}
+	timedOut, _ := ch.Dropped()
+	assert.Equal(t, uint64(1), timedOut)
+	assert.Equal(t, 1, ch.Len())
+
+	// without active expiry the buried item is only dropped when it is dequeued
+	passive := New(
+		WithSize(10),
+		WithTimeout(time.Millisecond*10),
+		WithTimeoutCallback(func(v interface{}) { expiredAt <- time.Now() }),
+	)
+	defer passive.Close()
+	passive.Input("head")
+	passive.Input("buried")
+	time.Sleep(time.Millisecond * 50)
+	assert.Len(t, expiredAt, 0)
+	assert.Equal(t, "head", <-passive.Output())
+	<-expiredAt
+}
+
+func TestChannelSlowConsumerCallback(t *testing.T) {
+	var slow int32
+	ch := New(
+		WithSize(10),
+		WithSlowConsumerCallback(time.Millisecond*20, func() { atomic.AddInt32(&slow, 1) }),
+	)
+	defer ch.Close()
+
+	// a fast consumer never triggers the callback
+	for i := 0; i < 5; i++ {
+		ch.Input(i)
+		<-ch.Output()
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&slow))
+
+	// a slow consumer: items wait in the buffer behind the one being delivered
+	for i := 0; i < 5; i++ {
+		ch.Input(i)
+	}
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond * 30)
+		<-ch.Output()
+	}
+	// consecutive slow items only fire once
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slow))
+
+	// it fires again after the consumer has caught up
+	ch.Input(0)
+	<-ch.Output()
+	ch.Input(1)
+	ch.Input(2)
+	time.Sleep(time.Millisecond * 30)
+	<-ch.Output()
+	<-ch.Output()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&slow) == 2 }, time.Second, time.Millisecond)
+}
+
+// recordMetrics records the last gauge values and the counter sums
+type recordMetrics struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{counters: make(map[string]float64), gauges: make(map[string]float64)}
+}
+
+func (m *recordMetrics) IncCounter(name string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += v
+}
+
+func (m *recordMetrics) SetGauge(name string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = v
+}
+
+func (m *recordMetrics) Snapshot() (counters, gauges map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters, gauges = make(map[string]float64), make(map[string]float64)
+	for k, v := range m.counters {
+		counters[k] = v
+	}
+	for k, v := range m.gauges {
+		gauges[k] = v
+	}
+	return counters, gauges
+}
+
+func TestChannelWithMetrics(t *testing.T) {
+	m := newRecordMetrics()
+	ch := New(WithSize(10), WithNonBlock(), WithMetrics(m))
+	defer ch.Close()
+
+	for i := 0; i < 3; i++ {
+		ch.Input(i)
+	}
+	counters, gauges := m.Snapshot()
+	assert.Equal(t, float64(3), counters[MetricProduced])
+	assert.Equal(t, float64(3), gauges[MetricBuffered])
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i, <-ch.Output())
+	}
+	assert.Eventually(t, func() bool {
+		counters, gauges := m.Snapshot()
+		return counters[MetricConsumed] == 3 && gauges[MetricBuffered] == 0
+	}, time.Second, time.Millisecond)
+
+	// expired items count as consumed like in Stats
+	m = newRecordMetrics()
+	expiring := New(WithTimeout(time.Millisecond*50), WithSize(10), WithNonBlock(), WithMetrics(m))
+	defer expiring.Close()
+	// the first item is handed to the blocked send before it expires, the second one expires in the buffer
+	expiring.Input(1)
+	expiring.Input(2)
+	time.Sleep(time.Millisecond * 80)
+	assert.Equal(t, 1, <-expiring.Output())
+	assert.Eventually(t, func() bool {
+		counters, gauges := m.Snapshot()
+		return counters[MetricProduced] == 2 && counters[MetricConsumed] == 2 && gauges[MetricBuffered] == 0
+	}, time.Second, time.Millisecond)
+}
@@ -1,10 +1,104 @@
 package conf
 
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultRedisMaxRetries 未配置 MaxRetries 时的重试次数
+	DefaultRedisMaxRetries = 3
+	// DefaultRedisExpirationSeconds 未配置 ExpirationSeconds 时缓存的过期时间
+	DefaultRedisExpirationSeconds = 3600
+	// DefaultRedisExpirationJitterSeconds 未配置 ExpirationJitterSeconds 时过期时间的随机偏移范围，
+	// 缓存的过期时间在 [ExpirationSeconds, ExpirationSeconds+ExpirationJitterSeconds) 内随机，避免大量 key 同时过期
+	DefaultRedisExpirationJitterSeconds = 10
+	// DefaultRedisDialTimeout 未配置 DialTimeout 时建立连接的超时时间
+	DefaultRedisDialTimeout = 5 * time.Second
+	// DefaultRedisReadTimeout 未配置 ReadTimeout 时读取响应的超时时间
+	DefaultRedisReadTimeout = 3 * time.Second
+	// DefaultRedisWriteTimeout 未配置 WriteTimeout 时写入命令的超时时间
+	DefaultRedisWriteTimeout = 3 * time.Second
+)
+
+// ErrRedisAddressEmpty RedisConfig 未配置地址
+var ErrRedisAddressEmpty = errors.New("redis address is empty")
+
 type RedisConfig struct {
-	Address           string `json:"addr"`
-	Db                int    `json:"db"`
-	Password          string `json:"password"`
-	ExpirationSeconds int    `json:"expiration_seconds"`
-	PoolSize          int    `json:"pool_size"`
-	MaxRetries        int    `json:"max_retries"`
+	Address                 string `json:"addr" mapstructure:"addr"`
+	Db                      int    `json:"db" mapstructure:"db"`
+	Password                string `json:"password" mapstructure:"password"`
+	ExpirationSeconds       int    `json:"expiration_seconds" mapstructure:"expiration_seconds"`
+	ExpirationJitterSeconds int    `json:"expiration_jitter_seconds" mapstructure:"expiration_jitter_seconds"`
+	PoolSize                int    `json:"pool_size" mapstructure:"pool_size"`
+	MaxRetries              int    `json:"max_retries" mapstructure:"max_retries"`
+	EnableMetrics           bool   `json:"enable_metrics" mapstructure:"enable_metrics"`
+	// 超时时间，yaml 中可以写作 "500ms"、"3s"，避免网络分区时请求无限期挂起
+	DialTimeout  time.Duration `json:"dial_timeout" mapstructure:"dial_timeout"`
+	ReadTimeout  time.Duration `json:"read_timeout" mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `json:"write_timeout" mapstructure:"write_timeout"`
+}
+
+// Validate 校验配置，Address 不能为空；PoolSize、MaxRetries、ExpirationSeconds、ExpirationJitterSeconds
+// 以及 DialTimeout、ReadTimeout、WriteTimeout 为0时填充默认值，
+// PoolSize 的默认值与 go-redis 一致，为 10 * CPU 核数
+func (config *RedisConfig) Validate() error {
+	if config.Address == "" {
+		return ErrRedisAddressEmpty
+	}
+	if config.PoolSize == 0 {
+		config.PoolSize = 10 * runtime.GOMAXPROCS(0)
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultRedisMaxRetries
+	}
+	if config.ExpirationSeconds == 0 {
+		config.ExpirationSeconds = DefaultRedisExpirationSeconds
+	}
+	if config.ExpirationJitterSeconds == 0 {
+		config.ExpirationJitterSeconds = DefaultRedisExpirationJitterSeconds
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = DefaultRedisDialTimeout
+	}
+	if config.ReadTimeout == 0 {
+		config.ReadTimeout = DefaultRedisReadTimeout
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = DefaultRedisWriteTimeout
+	}
+	return nil
+}
+
+// WatchRedisConfig 读取 path 目录下名为 name 的 yaml 配置并监听文件变化，
+// 文件变化后重新解析配置并调用 onChange，解析失败时保留原配置且不调用 onChange
+func WatchRedisConfig(name, path string, onChange func(*RedisConfig)) (*RedisConfig, error) {
+	v := viper.New()
+	v.SetConfigName(name)
+	v.AddConfigPath(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("解析文件失败: %w", err)
+	}
+	config := new(RedisConfig)
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("解析文件失败: %w", err)
+	}
+	// 监听配置更新
+	v.OnConfigChange(func(e fsnotify.Event) {
+		changed := new(RedisConfig)
+		if err := v.Unmarshal(changed); err != nil {
+			return
+		}
+		if onChange != nil {
+			onChange(changed)
+		}
+	})
+	v.WatchConfig()
+	return config, nil
 }
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchRedisConfig(t *testing.T) {
+	is := assert.New(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "redis.yaml")
+	is.NoError(os.WriteFile(file, []byte("addr: 127.0.0.1:6379\npool_size: 10\nmax_retries: 3\nread_timeout: 500ms\n"), 0o644))
+
+	changes := make(chan *RedisConfig, 10)
+	config, err := WatchRedisConfig("redis", dir, func(config *RedisConfig) {
+		changes <- config
+	})
+	is.NoError(err)
+	is.Equal("127.0.0.1:6379", config.Address)
+	is.Equal(10, config.PoolSize)
+	is.Equal(3, config.MaxRetries)
+	is.Equal(500*time.Millisecond, config.ReadTimeout)
+
+	is.NoError(os.WriteFile(file, []byte("addr: 127.0.0.1:6379\npool_size: 20\nmax_retries: 5\n"), 0o644))
+	// the file may be observed half written, wait for the final content
+	timeout := time.After(5 * time.Second)
+	var changed *RedisConfig
+	for changed == nil || changed.PoolSize != 20 {
+		select {
+		case changed = <-changes:
+		case <-timeout:
+			t.Fatal("config change not notified")
+		}
+	}
+	is.Equal(5, changed.MaxRetries)
+
+	_, err = WatchRedisConfig("not-exist", dir, nil)
+	is.Error(err)
+}
+
+func TestRedisConfigValidate(t *testing.T) {
+	is := assert.New(t)
+
+	config := &RedisConfig{Address: "127.0.0.1:6379"}
+	is.NoError(config.Validate())
+	is.Equal(10*runtime.GOMAXPROCS(0), config.PoolSize)
+	is.Equal(DefaultRedisMaxRetries, config.MaxRetries)
+	is.Equal(DefaultRedisExpirationSeconds, config.ExpirationSeconds)
+	is.Equal(DefaultRedisExpirationJitterSeconds, config.ExpirationJitterSeconds)
+	is.Equal(DefaultRedisDialTimeout, config.DialTimeout)
+	is.Equal(DefaultRedisReadTimeout, config.ReadTimeout)
+	is.Equal(DefaultRedisWriteTimeout, config.WriteTimeout)
+
+	// configured values are kept
+	config = &RedisConfig{Address: "127.0.0.1:6379", PoolSize: 5, MaxRetries: 1, ExpirationSeconds: 60, ExpirationJitterSeconds: 5,
+		DialTimeout: time.Second, ReadTimeout: 200 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}
+	is.NoError(config.Validate())
+	is.Equal(&RedisConfig{Address: "127.0.0.1:6379", PoolSize: 5, MaxRetries: 1, ExpirationSeconds: 60, ExpirationJitterSeconds: 5,
+		DialTimeout: time.Second, ReadTimeout: 200 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}, config)
+
+	is.ErrorIs((&RedisConfig{PoolSize: 5}).Validate(), ErrRedisAddressEmpty)
+}
@@ -5,4 +5,5 @@ const (
 	KafkaMqName  = "kafka"
 	RocketMqName = "rocketmq"
 	PulsarMqName = "pulsar"
+	MemoryMqName = "memory"
 )
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -22,6 +23,9 @@ type eventManagerConf struct {
 	MaxTempEventBuf int
 	MaxTickCount    int
 	MaxIdeaTime     time.Duration
+	// ErrorHandler receives the structured info of each failed event, e.g. to emit JSON logs,
+	// the errors are logged with log.StdLogger if nil
+	ErrorHandler func(EventErrorInfo)
 }
 
 func StartEventManager() {
@@ -32,6 +36,24 @@ func StopEventManager() {
 	_defaultEventManager.Stop()
 }
 
+// RegisterHandler dispatches the events whose Name() is eventName to handler,
+// events without a registered handler fall back to their own Action.
+func RegisterHandler(eventName string, handler func(Event) error) {
+	_defaultEventManager.RegisterHandler(eventName, handler)
+}
+
+// OnTypedEvent dispatches the events of type T to handler, which receives the concrete event
+// without type assertion. Handlers matched by type take precedence over those registered by name.
+func OnTypedEvent[T Event](handler func(T) error) {
+	RegisterTypedHandler(_defaultEventManager, handler)
+}
+
+// DrainEventManager stops accepting new events and blocks until the already pushed events
+// are handled or ctx expires, then stops the event manager.
+func DrainEventManager(ctx context.Context) error {
+	return _defaultEventManager.Drain(ctx)
+}
+
 // OnEvent push event to gorotine pool then handled automatic.
 func OnEvent(event Event) {
 	_defaultEventManager.OnEvent(event)
@@ -107,9 +129,11 @@ func initEventManager(conf eventManagerConf) {
 		opts = append(opts, pool.WithMaxRequestTempBuf(10))
 	}
 	opts = append(opts, pool.WithMaxIdelTime(conf.MaxIdeaTime))
-	_defaultEventManager = NewEventManager(func(req Event, err error) {
-		if err != nil {
-			log.Error("handle event[%s] occurs error: %s", req.Name(), err)
+	errorHandler := conf.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = func(info EventErrorInfo) {
+			log.StdLogger.Errorf("handle event[%s] occurs error: %s", info.Name, info.Err)
 		}
-	}, opts...)
+	}
+	_defaultEventManager = NewEventManagerWithErrorHandler(errorHandler, opts...)
 }
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"time"
+
+	"github.com/alimy/tryst/event"
+)
+
+// NodeCompletedEventName is the name of NodeCompletedEvent
+const NodeCompletedEventName = "NodeCompletedEvent"
+
+// NodeCompletedEvent is emitted when a flow node finishes
+type NodeCompletedEvent struct {
+	event.UnimplementedEvent
+
+	FlowID   string
+	NodeID   string
+	Err      error
+	Duration time.Duration
+
+	handler func(*NodeCompletedEvent) error
+}
+
+// Name implements Event
+func (e *NodeCompletedEvent) Name() string {
+	return NodeCompletedEventName
+}
+
+// Action implements Event, it calls the handler of the observer emitting the event
+func (e *NodeCompletedEvent) Action() error {
+	if e.handler == nil {
+		return nil
+	}
+	return e.handler(e)
+}
+
+// FlowEventObserver bridges flow execution to the event manager,
+// it implements flow.FlowObserver and pushes a NodeCompletedEvent with OnEvent for each completed node
+type FlowEventObserver struct {
+	handler func(*NodeCompletedEvent) error
+}
+
+// NewFlowEventObserver create a FlowEventObserver, handler is called for each event by the event manager
+func NewFlowEventObserver(handler func(*NodeCompletedEvent) error) *FlowEventObserver {
+	return &FlowEventObserver{handler: handler}
+}
+
+// OnNodeCompleted implements flow.FlowObserver
+func (o *FlowEventObserver) OnNodeCompleted(flowID, nodeID string, err error, duration time.Duration) {
+	OnEvent(&NodeCompletedEvent{
+		FlowID:   flowID,
+		NodeID:   nodeID,
+		Err:      err,
+		Duration: duration,
+		handler:  o.handler,
+	})
+}
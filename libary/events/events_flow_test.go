@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/flow"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ flow.FlowObserver = (*FlowEventObserver)(nil)
+
+type testTask struct {
+	name string
+	err  error
+}
+
+func (t *testTask) NodeName() string {
+	return t.name
+}
+
+func (t *testTask) Run(ctx context.Context, data flow.DataSet) error {
+	return t.err
+}
+
+func TestFlowEventObserver(t *testing.T) {
+	is := assert.New(t)
+	initEventManager(eventManagerConf{})
+	defer StopEventManager()
+
+	var lock sync.Mutex
+	received := make(map[string]*NodeCompletedEvent)
+	observer := NewFlowEventObserver(func(e *NodeCompletedEvent) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received[e.NodeID] = e
+		return nil
+	})
+
+	errFailed := errors.New("failed")
+	dag := flow.NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("a", "c"))
+
+	dag.GetNode("a").SetTask(&testTask{name: "a"})
+	dag.GetNode("b").SetTask(&testTask{name: "b"})
+	dag.GetNode("c").SetTask(&testTask{name: "c", err: errFailed})
+	flow.NewFlow(dag).WithObserver(observer).Run(context.Background())
+
+	is.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) == 3
+	}, time.Second, time.Millisecond*10)
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, id := range []string{"a", "b", "c"} {
+		is.Equal(dag.Id, received[id].FlowID)
+		is.Equal(NodeCompletedEventName, received[id].Name())
+	}
+	is.NoError(received["a"].Err)
+	is.ErrorIs(received["c"].Err, errFailed)
+}
@@ -1,20 +1,78 @@
 package events
 
 import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
 	"github.com/alimy/tryst/event"
 	"github.com/alimy/tryst/pool"
 )
 
 type Event = event.Event
 
+// EventErrorInfo describes a failed event for structured error handlers
+type EventErrorInfo struct {
+	Event Event
+	Name  string
+	Err   error
+	// Attempt is the 1-based attempt that failed, events are not retried so it's always 1 for now
+	Attempt int
+	// Duration is how long the Action or the registered handler ran
+	Duration time.Duration
+	// Time is when the event failed
+	Time time.Time
+}
+
+// MarshalJSON encodes the info as a flat JSON object for log pipelines, the event itself is left out
+func (info EventErrorInfo) MarshalJSON() ([]byte, error) {
+	var errMsg string
+	if info.Err != nil {
+		errMsg = info.Err.Error()
+	}
+	return json.Marshal(struct {
+		Name       string `json:"event"`
+		Err        string `json:"error"`
+		Attempt    int    `json:"attempt"`
+		DurationMs int64  `json:"duration_ms"`
+		Time       string `json:"time"`
+	}{
+		Name:       info.Name,
+		Err:        errMsg,
+		Attempt:    info.Attempt,
+		DurationMs: info.Duration.Milliseconds(),
+		Time:       info.Time.Format(time.RFC3339Nano),
+	})
+}
+
 type EventManager interface {
 	Start()
 	Stop()
 	OnEvent(event Event)
+	// RegisterHandler handles the events named eventName with handler instead of their own Action
+	RegisterHandler(eventName string, handler func(Event) error)
+	// RegisterTypeHandler handles the events whose dynamic type is typ with handler,
+	// it takes precedence over the handler registered by name
+	RegisterTypeHandler(typ reflect.Type, handler func(Event) error)
+	// Drain stops accepting new events and waits for the pushed events to be handled, then stops the manager
+	Drain(ctx context.Context) error
 }
 
 type simpleEventManager struct {
 	em event.EventManager
+
+	errorHandler func(EventErrorInfo) // called for each failed event if set
+
+	handlersMu   sync.RWMutex
+	handlers     map[string]func(Event) error
+	typeHandlers map[reflect.Type]func(Event) error
+
+	mu       sync.Mutex
+	pending  int           // events pushed but not handled yet
+	draining bool          // no more event is accepted
+	idle     chan struct{} // closed when pending drops to zero while draining
 }
 
 func (s *simpleEventManager) Start() {
@@ -26,11 +84,132 @@ func (s *simpleEventManager) Stop() {
 }
 
 func (s *simpleEventManager) OnEvent(event Event) {
-	s.em.OnEvent(event)
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.pending++
+	s.mu.Unlock()
+
+	s.handlersMu.RLock()
+	handler, ok := s.typeHandlers[reflect.TypeOf(event)]
+	if !ok {
+		handler = s.handlers[event.Name()]
+	}
+	s.handlersMu.RUnlock()
+	s.em.OnEvent(&routedEvent{Event: event, handler: handler})
 }
 
-func NewEventManager(fn pool.RespFn[Event], opts ...pool.Option) EventManager {
-	return &simpleEventManager{
-		em: event.NewEventManager(fn, opts...),
+func (s *simpleEventManager) RegisterHandler(eventName string, handler func(Event) error) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]func(Event) error)
+	}
+	s.handlers[eventName] = handler
+}
+
+func (s *simpleEventManager) RegisterTypeHandler(typ reflect.Type, handler func(Event) error) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	if s.typeHandlers == nil {
+		s.typeHandlers = make(map[reflect.Type]func(Event) error)
+	}
+	s.typeHandlers[typ] = handler
+}
+
+// RegisterTypedHandler dispatches the events of type T pushed to m to handler,
+// which receives the concrete event without type assertion. T must be the concrete type
+// of the pushed events, e.g. *UserCreated, an interface type never matches
+func RegisterTypedHandler[T Event](m EventManager, handler func(T) error) {
+	m.RegisterTypeHandler(reflect.TypeFor[T](), func(event Event) error {
+		return handler(event.(T))
+	})
+}
+
+// Drain stops accepting new events and blocks until the in-flight and buffered events are handled
+// or ctx is done, the manager is stopped in both cases and ctx.Err() is returned on expiry
+func (s *simpleEventManager) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.draining {
+		s.draining = true
+		s.idle = make(chan struct{})
+		if s.pending == 0 {
+			close(s.idle)
+		}
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	defer s.em.Stop()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// done marks a pushed event as handled
+func (s *simpleEventManager) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if s.pending == 0 && s.draining {
+		close(s.idle)
 	}
 }
+
+// routedEvent replaces the Action of an event with its registered handler if any,
+// and records how long it ran
+type routedEvent struct {
+	Event
+	handler  func(Event) error
+	duration time.Duration
+}
+
+func (e *routedEvent) Action() error {
+	start := time.Now()
+	defer func() {
+		e.duration = time.Since(start)
+	}()
+	if e.handler != nil {
+		return e.handler(e.Event)
+	}
+	return e.Event.Action()
+}
+
+func NewEventManager(fn pool.RespFn[Event], opts ...pool.Option) EventManager {
+	return newEventManager(fn, nil, opts...)
+}
+
+// NewEventManagerWithErrorHandler create an event manager calling handler with the structured info of each failed event
+func NewEventManagerWithErrorHandler(handler func(EventErrorInfo), opts ...pool.Option) EventManager {
+	return newEventManager(nil, handler, opts...)
+}
+
+func newEventManager(fn pool.RespFn[Event], errorHandler func(EventErrorInfo), opts ...pool.Option) *simpleEventManager {
+	s := &simpleEventManager{errorHandler: errorHandler}
+	s.em = event.NewEventManager(func(req Event, err error) {
+		defer s.done()
+		var duration time.Duration
+		if routed, ok := req.(*routedEvent); ok {
+			req, duration = routed.Event, routed.duration
+		}
+		if err != nil && s.errorHandler != nil {
+			s.errorHandler(EventErrorInfo{
+				Event:    req,
+				Name:     req.Name(),
+				Err:      err,
+				Attempt:  1,
+				Duration: duration,
+				Time:     time.Now(),
+			})
+		}
+		if fn != nil {
+			fn(req, err)
+		}
+	}, opts...)
+	return s
+}
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alimy/tryst/event"
+	"github.com/stretchr/testify/assert"
+)
+
+type funcEvent struct {
+	event.UnimplementedEvent
+	name   string
+	action func() error
+}
+
+func (e *funcEvent) Name() string {
+	return e.name
+}
+
+func (e *funcEvent) Action() error {
+	return e.action()
+}
+
+func TestDrainEventManager(t *testing.T) {
+	initEventManager(eventManagerConf{})
+
+	var handled int32
+	for i := 0; i < 50; i++ {
+		OnEvent(&funcEvent{action: func() error {
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&handled, 1)
+			return nil
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, DrainEventManager(ctx))
+	assert.Equal(t, int32(50), atomic.LoadInt32(&handled))
+
+	// events pushed after draining are ignored
+	OnEvent(&funcEvent{action: func() error {
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}})
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, int32(50), atomic.LoadInt32(&handled))
+}
+
+func TestDrainEventManagerTimeout(t *testing.T) {
+	initEventManager(eventManagerConf{})
+
+	release := make(chan struct{})
+	defer close(release)
+	OnEvent(&funcEvent{action: func() error {
+		<-release
+		return nil
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.ErrorIs(t, DrainEventManager(ctx), context.DeadlineExceeded)
+}
+
+func TestRegisterHandler(t *testing.T) {
+	is := assert.New(t)
+	var lock sync.Mutex
+	var got []string
+	record := func(s string) {
+		lock.Lock()
+		defer lock.Unlock()
+		got = append(got, s)
+	}
+	var responded int32
+	errB := errors.New("b failed")
+	var respErr atomic.Value
+	_defaultEventManager = NewEventManager(func(req Event, err error) {
+		if err != nil {
+			respErr.Store(fmt.Sprintf("%T %s: %s", req, req.Name(), err))
+		}
+		atomic.AddInt32(&responded, 1)
+	})
+	defer StopEventManager()
+
+	RegisterHandler("a", func(e Event) error {
+		record("handler a: " + e.Name())
+		return nil
+	})
+	RegisterHandler("b", func(e Event) error {
+		record("handler b: " + e.Name())
+		return errB
+	})
+
+	for _, name := range []string{"a", "b", "c"} {
+		OnEvent(&funcEvent{name: name, action: func() error {
+			record("action: " + name)
+			return nil
+		}})
+	}
+
+	is.Eventually(func() bool {
+		return atomic.LoadInt32(&responded) == 3
+	}, time.Second, time.Millisecond*10)
+	lock.Lock()
+	defer lock.Unlock()
+	is.ElementsMatch([]string{"handler a: a", "handler b: b", "action: c"}, got)
+	// the response function receives the original event
+	is.Equal("*events.funcEvent b: b failed", respErr.Load())
+}
+
+type userCreated struct {
+	event.UnimplementedEvent
+	user string
+}
+
+func (e *userCreated) Name() string {
+	return "user_created"
+}
+
+func (e *userCreated) Action() error {
+	return errors.New("action should not run")
+}
+
+func TestOnTypedEvent(t *testing.T) {
+	is := assert.New(t)
+	var responded int32
+	var respErr atomic.Value
+	_defaultEventManager = NewEventManager(func(req Event, err error) {
+		if err != nil {
+			respErr.Store(err)
+		}
+		atomic.AddInt32(&responded, 1)
+	})
+	defer StopEventManager()
+
+	users := make(chan string, 1)
+	OnTypedEvent(func(e *userCreated) error {
+		users <- e.user
+		return nil
+	})
+	// the typed handler takes precedence over the one registered by name
+	RegisterHandler("user_created", func(e Event) error {
+		return errors.New("name handler should not run")
+	})
+	// events of other types are still routed by name
+	var named int32
+	RegisterHandler("other", func(e Event) error {
+		atomic.AddInt32(&named, 1)
+		return nil
+	})
+
+	OnEvent(&userCreated{user: "alice"})
+	OnEvent(&funcEvent{name: "other"})
+
+	is.Eventually(func() bool {
+		return atomic.LoadInt32(&responded) == 2
+	}, time.Second, time.Millisecond*10)
+	is.Equal("alice", <-users)
+	is.Equal(int32(1), atomic.LoadInt32(&named))
+	is.Nil(respErr.Load())
+}
+
+func TestEventErrorHandler(t *testing.T) {
+	is := assert.New(t)
+	infos := make(chan EventErrorInfo, 2)
+	initEventManager(eventManagerConf{ErrorHandler: func(info EventErrorInfo) {
+		infos <- info
+	}})
+
+	errSync := errors.New("sync failed")
+	failing := &funcEvent{name: "sync", action: func() error {
+		time.Sleep(time.Millisecond * 20)
+		return errSync
+	}}
+	before := time.Now()
+	OnEvent(failing)
+	OnEvent(&funcEvent{name: "ok", action: func() error { return nil }})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	is.NoError(DrainEventManager(ctx))
+	is.Len(infos, 1)
+
+	info := <-infos
+	is.Same(failing, info.Event)
+	is.Equal("sync", info.Name)
+	is.ErrorIs(info.Err, errSync)
+	is.Equal(1, info.Attempt)
+	is.GreaterOrEqual(info.Duration, time.Millisecond*20)
+	is.False(info.Time.Before(before))
+
+	raw, err := json.Marshal(info)
+	is.NoError(err)
+	var fields map[string]interface{}
+	is.NoError(json.Unmarshal(raw, &fields))
+	is.Equal("sync", fields["event"])
+	is.Equal("sync failed", fields["error"])
+	is.Equal(float64(1), fields["attempt"])
+	is.GreaterOrEqual(fields["duration_ms"], float64(20))
+	is.Equal(info.Time.Format(time.RFC3339Nano), fields["time"])
+}
@@ -3,6 +3,7 @@ package flow
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 )
 
 var (
@@ -17,6 +18,8 @@ var (
 	ErrMultipleStart = fmt.Errorf("only one start vertex is allowed")
 	// ErrRecursiveDep denotes that flow has a recursive dependecy
 	ErrRecursiveDep = fmt.Errorf("flow has recursive dependency")
+	// ErrFlattenForeach denotes that a foreach node can't be inlined into a single-level flow
+	ErrFlattenForeach = fmt.Errorf("foreach node can not be flattened")
 	// DefaultForwarder Default forwarder
 	DefaultForwarder = func(data []byte) []byte { return data }
 )
@@ -24,6 +27,15 @@ var (
 // Aggregator definition for the data aggregator of nodes
 type Aggregator func(map[string][]byte) ([]byte, error)
 
+// ForEachResult is the output of the foreach dag for a partition key
+type ForEachResult struct {
+	Key    string
+	Output []byte
+}
+
+// OrderedAggregator definition for the aggregator of foreach outputs in the sorted order of the partition keys
+type OrderedAggregator func([]ForEachResult) ([]byte, error)
+
 // Forwarder definition for the data forwarder of nodes
 type Forwarder func([]byte) []byte
 
@@ -46,6 +58,8 @@ type Dag struct {
 	hasEdge     bool  // denotes the flow or its subdag has edge
 	validated   bool  // denotes the flow has been validated
 
+	multipleStarts bool // denotes a synthetic start node is added instead of erroring on multiple initial nodes
+
 	executionFlow      bool // Flag to denote if none of the node forwards data
 	dataForwarderCount int  // Count of nodes that forwards data
 
@@ -69,6 +83,13 @@ func NewDag() *Dag {
 	return dag
 }
 
+// AllowMultipleStarts lets a flow have more than one node without dependency
+// On validation a synthetic start node is added with edges to all of them instead of returning ErrMultipleStart,
+// so the independent entry points run in parallel
+func (dag *Dag) AllowMultipleStarts() {
+	dag.multipleStarts = true
+}
+
 // Append appends another flow into an existing flow
 // Its a way to define and reuse subdags
 // append causes disconnected flow which must be linked with edge in order to execute
@@ -188,7 +209,7 @@ func (dag *Dag) HasEdge() bool {
 // A validated graph has only one initialNode and one EndNode set
 // if a graph has more than one end-node, a separate end-node gets added
 func (dag *Dag) Validate() error {
-	initialNodeCount := 0
+	var startNodes []*Node
 	var endNodes []*Node
 
 	if dag.validated {
@@ -202,7 +223,7 @@ func (dag *Dag) Validate() error {
 	for _, b := range dag.nodes {
 		b.uniqueId = b.generateUniqueId(dag.Id)
 		if b.indegree == 0 {
-			initialNodeCount = initialNodeCount + 1
+			startNodes = append(startNodes, b)
 			dag.initialNode = b
 		}
 		if b.outdegree == 0 {
@@ -267,8 +288,25 @@ func (dag *Dag) Validate() error {
 		}
 	}
 
-	if initialNodeCount > 1 {
-		return fmt.Errorf("%v, flow: %s", ErrMultipleStart, dag.Id)
+	if len(startNodes) > 1 {
+		if !dag.multipleStarts {
+			return fmt.Errorf("%v, flow: %s, unreachable nodes: %v", ErrMultipleStart, dag.Id, dag.UnreachableNodes())
+		}
+		// Add a virtual start node to fan out to the starts
+		startNodeId := fmt.Sprintf("start_%s", dag.Id)
+		blank := &BlankOperation{}
+		startNode := dag.AddVertex(startNodeId, []Operation{blank})
+		startNode.uniqueId = startNode.generateUniqueId(dag.Id)
+		for _, b := range startNodes {
+			// Create a edge
+			err := dag.AddEdge(startNodeId, b.Id)
+			if err != nil {
+				return err
+			}
+			// mark the edge as execution dependency
+			startNode.AddForwarder(b.Id, nil)
+		}
+		dag.initialNode = startNode
 	}
 
 	// If there is multiple ends add a virtual end node to combine them
@@ -295,6 +333,65 @@ func (dag *Dag) Validate() error {
 	return nil
 }
 
+// outputNode returns the node whose output is the output of the flow, the end node of a validated
+// flow or the only node without children otherwise
+func (dag *Dag) outputNode() (*Node, error) {
+	if dag.endNode != nil {
+		return dag.endNode, nil
+	}
+	var end *Node
+	for _, node := range dag.nodes {
+		if node.outdegree != 0 {
+			continue
+		}
+		if end != nil {
+			return nil, fmt.Errorf("flow: dag %s has more than one end node", dag.Id)
+		}
+		end = node
+	}
+	if end == nil {
+		return nil, ErrNoVertex
+	}
+	return end, nil
+}
+
+// UnreachableNodes returns the sorted ids of the nodes that can't be reached from the initial node via children
+// Before validation the initial node is the first added vertex without dependency
+func (dag *Dag) UnreachableNodes() []string {
+	initialNode := dag.initialNode
+	if !dag.validated {
+		initialNode = nil
+		for _, node := range dag.nodes {
+			if node.indegree == 0 && (initialNode == nil || node.index < initialNode.index) {
+				initialNode = node
+			}
+		}
+	}
+
+	reached := make(map[string]bool, len(dag.nodes))
+	if initialNode != nil {
+		stack := []*Node{initialNode}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if reached[node.Id] {
+				continue
+			}
+			reached[node.Id] = true
+			stack = append(stack, node.children...)
+		}
+	}
+
+	var unreachable []string
+	for id := range dag.nodes {
+		if !reached[id] {
+			unreachable = append(unreachable, id)
+		}
+	}
+	sort.Strings(unreachable)
+	return unreachable
+}
+
 // GetNodes returns a list of nodes (including subdags) belong to the flow
 func (dag *Dag) GetNodes(dynamicOption string) []string {
 	var nodes []string
@@ -355,3 +452,160 @@ func (dag *Dag) GetDefinition() (*DagExporter, error) {
 	exportDag(root, dag)
 	return root, err
 }
+
+// flatBoundary the flattened nodes an edge into (entries) or out of (exits) an original node is rewired to
+type flatBoundary struct {
+	entries []*Node
+	exits   []*Node
+}
+
+// Flatten inlines every subdag and conditional dag into a new single-level flow
+// Inlined node ids are prefixed with the id of the subdag they belong to (<subdag-id>_<node-id>)
+// and edges across the subdag boundary are rewired to its initial and end nodes, keeping the forwarders
+// Conditions and sub-aggregators are not carried over, every conditional branch becomes a plain branch
+// Foreach nodes are rejected with ErrFlattenForeach
+func (dag *Dag) Flatten() (*Dag, error) {
+	err := dag.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	flat := NewDag()
+	flat.Id = dag.Id
+	_, err = flat.inline(dag, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = flat.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return flat, nil
+}
+
+// inline copies the nodes and edges of src into dag and returns the boundary of each src node
+func (dag *Dag) inline(src *Dag, prefix string) (map[string]*flatBoundary, error) {
+	nodes := make([]*Node, 0, len(src.nodes))
+	for _, node := range src.nodes {
+		nodes = append(nodes, node)
+	}
+	// keep the insertion order so that the flattened indexes are deterministic
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].index < nodes[j].index })
+
+	boundaries := make(map[string]*flatBoundary, len(nodes))
+	for _, node := range nodes {
+		boundary, err := dag.inlineNode(node, prefix)
+		if err != nil {
+			return nil, err
+		}
+		boundaries[node.Id] = boundary
+	}
+
+	for _, node := range nodes {
+		for _, child := range node.children {
+			forwarder := node.forwarder[child.Id]
+			for _, from := range boundaries[node.Id].exits {
+				for _, to := range boundaries[child.Id].entries {
+					err := dag.addFlatEdge(from, to, forwarder)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return boundaries, nil
+}
+
+// inlineNode copies a node into dag, expanding its subdag and conditional dags
+func (dag *Dag) inlineNode(node *Node, prefix string) (*flatBoundary, error) {
+	if node.foreach != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFlattenForeach, node.Id)
+	}
+
+	id := node.Id
+	if prefix != "" {
+		id = prefix + "_" + node.Id
+	}
+
+	var subDags []*Dag
+	if node.subDag != nil {
+		subDags = append(subDags, node.subDag)
+	}
+	conditions := make([]string, 0, len(node.conditionalDags))
+	for condition := range node.conditionalDags {
+		conditions = append(conditions, condition)
+	}
+	sort.Strings(conditions)
+	for _, condition := range conditions {
+		subDags = append(subDags, node.conditionalDags[condition])
+	}
+
+	if len(subDags) == 0 {
+		flatNode, err := dag.copyVertex(id, node)
+		if err != nil {
+			return nil, err
+		}
+		return &flatBoundary{entries: []*Node{flatNode}, exits: []*Node{flatNode}}, nil
+	}
+
+	boundary := &flatBoundary{}
+	for _, subDag := range subDags {
+		subBoundaries, err := dag.inline(subDag, subDag.Id)
+		if err != nil {
+			return nil, err
+		}
+		boundary.entries = append(boundary.entries, subBoundaries[subDag.initialNode.Id].entries...)
+		boundary.exits = append(boundary.exits, subBoundaries[subDag.endNode.Id].exits...)
+	}
+
+	// a node executing operations before its subdag is kept in front of the inlined subdag
+	if len(node.operations) > 0 {
+		flatNode, err := dag.copyVertex(id, node)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range boundary.entries {
+			err = dag.addFlatEdge(flatNode, entry, DefaultForwarder)
+			if err != nil {
+				return nil, err
+			}
+		}
+		boundary.entries = []*Node{flatNode}
+	} else if node.aggregator != nil {
+		for _, entry := range boundary.entries {
+			if entry.aggregator == nil {
+				entry.aggregator = node.aggregator
+			}
+		}
+	}
+	return boundary, nil
+}
+
+// copyVertex adds a vertex with the operations, aggregator and task of node
+func (dag *Dag) copyVertex(id string, node *Node) (*Node, error) {
+	if _, duplicate := dag.nodes[id]; duplicate {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateVertex, id)
+	}
+	flatNode := dag.AddVertex(id, node.operations)
+	flatNode.aggregator = node.aggregator
+	flatNode.task = node.task
+	return flatNode, nil
+}
+
+// addFlatEdge adds an edge and sets the forwarder of the original edge
+func (dag *Dag) addFlatEdge(from, to *Node, forwarder Forwarder) error {
+	err := dag.AddEdge(from.Id, to.Id)
+	if err != nil {
+		return err
+	}
+	if forwarder == nil {
+		// mark the edge as execution dependency
+		from.AddForwarder(to.Id, nil)
+	} else {
+		// AddEdge already counted the default forwarder
+		from.forwarder[to.Id] = forwarder
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// edges returns the sorted "from->to" edges of a dag
+func edges(dag *Dag) []string {
+	var result []string
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			result = append(result, node.Id+"->"+child.Id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func nodeIds(dag *Dag) []string {
+	var result []string
+	for id := range dag.nodes {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestDagFlatten(t *testing.T) {
+	is := assert.New(t)
+
+	// inner: p -> q
+	inner := NewDag()
+	is.NoError(inner.AddEdge("p", "q"))
+
+	// middle: x -> y(inner)
+	middle := NewDag()
+	is.NoError(middle.AddEdge("x", "y"))
+	is.NoError(middle.GetNode("y").AddSubDag(inner))
+
+	// root: a -> b(middle) -> c
+	root := NewDag()
+	is.NoError(root.AddEdge("a", "b"))
+	is.NoError(root.AddEdge("b", "c"))
+	is.NoError(root.GetNode("b").AddSubDag(middle))
+	upper := func(data []byte) []byte { return append(data, '!') }
+	root.GetNode("a").AddForwarder("b", upper)
+
+	flat, err := root.Flatten()
+	is.NoError(err)
+	is.Equal([]string{"2_2_p", "2_2_q", "2_x", "a", "c"}, nodeIds(flat))
+	is.Equal([]string{"2_2_p->2_2_q", "2_2_q->c", "2_x->2_2_p", "a->2_x"}, edges(flat))
+	is.Equal("a", flat.GetInitialNode().Id)
+	is.Equal("c", flat.GetEndNode().Id)
+
+	// the forwarder of a->b now forwards a->2_x
+	forwarder := flat.GetNode("a").GetForwarder("2_x")
+	is.NotNil(forwarder)
+	is.Equal([]byte("data!"), forwarder([]byte("data")))
+	for _, node := range flat.nodes {
+		is.Nil(node.SubDag())
+	}
+}
+
+func TestDagFlattenConditional(t *testing.T) {
+	is := assert.New(t)
+
+	left := NewDag()
+	left.AddVertex("l", []Operation{&BlankOperation{}})
+	right := NewDag()
+	is.NoError(right.AddEdge("r1", "r2"))
+
+	root := NewDag()
+	is.NoError(root.AddEdge("a", "b"))
+	is.NoError(root.AddEdge("b", "c"))
+	b := root.GetNode("b")
+	b.AddOperation(&BlankOperation{})
+	b.AddCondition(func([]byte) []string { return []string{"left"} })
+	b.AddConditionalDag("left", left)
+	b.AddConditionalDag("right", right)
+
+	flat, err := root.Flatten()
+	is.NoError(err)
+	is.Equal([]string{"2_left_l", "2_right_r1", "2_right_r2", "a", "b", "c"}, nodeIds(flat))
+	is.Equal([]string{"2_left_l->c", "2_right_r1->2_right_r2", "2_right_r2->c", "a->b", "b->2_left_l", "b->2_right_r1"}, edges(flat))
+	is.False(flat.GetNode("b").Dynamic())
+}
+
+func TestDagFlattenForeach(t *testing.T) {
+	is := assert.New(t)
+
+	root := NewDag()
+	is.NoError(root.AddEdge("a", "b"))
+	b := root.GetNode("b")
+	b.AddForEach(func(data []byte) map[string][]byte { return map[string][]byte{"0": data} })
+	is.NoError(b.AddForEachDag(NewDag()))
+	b.SubDag().AddVertex("item", []Operation{})
+
+	_, err := root.Flatten()
+	is.True(errors.Is(err, ErrFlattenForeach))
+}
+
+func TestDagUnreachableNodes(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("b", "c"))
+	is.NoError(dag.AddEdge("a", "c"))
+	is.Empty(dag.UnreachableNodes())
+
+	dag.AddVertex("orphan", []Operation{})
+	is.Equal([]string{"orphan"}, dag.UnreachableNodes())
+
+	err := dag.Validate()
+	is.ErrorContains(err, ErrMultipleStart.Error())
+	is.ErrorContains(err, "[orphan]")
+}
+
+func TestDagAllowMultipleStarts(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "c"))
+	is.NoError(dag.AddEdge("b", "c"))
+	dag.AllowMultipleStarts()
+	is.NoError(dag.Validate())
+
+	start := dag.GetInitialNode()
+	is.Equal("start_0", start.Id)
+	is.Equal(0, start.indegree)
+	is.Equal(2, start.outdegree)
+	is.Equal(1, dag.GetNode("a").indegree)
+	is.Equal(1, dag.GetNode("b").indegree)
+	is.Equal("c", dag.GetEndNode().Id)
+	is.Empty(dag.UnreachableNodes())
+
+	var ran sync.Map
+	for _, id := range []string{"a", "b", "c"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			ran.Store(id, true)
+			return nil
+		}}
+	}
+	flow := NewFlow(dag).Run(context.Background())
+	for _, id := range []string{"a", "b", "c"} {
+		_, ok := ran.Load(id)
+		is.True(ok, id)
+		is.Equal(NodeStatusDone, flow.Status(id))
+	}
+	is.Equal(NodeStatusDone, flow.Status(start.Id))
+}
@@ -9,6 +9,14 @@ import (
 type DataSet interface {
 	Set(key string, data interface{}) DataSet
 	Get(key string) (data interface{}, ok bool)
+	// Range 遍历数据，fn 返回 false 时停止
+	Range(fn func(key string, data interface{}) bool)
+	// Snapshot 复制一份数据，供并行的子流程独立读写
+	Snapshot() DataSet
+	// Merge 将 other 中的数据以 prefix 为前缀合并进来
+	Merge(other DataSet, prefix string) DataSet
+	// Scope 返回以 nodeID 为命名空间的视图，写入的 key 为 <nodeID>.<key>
+	Scope(nodeID string) DataSet
 	String() string
 }
 
@@ -37,6 +45,58 @@ func (dataSet *FlowDataSet) Get(key string) (data interface{}, ok bool) {
 	return
 }
 
+func (dataSet *FlowDataSet) Range(fn func(key string, data interface{}) bool) {
+	dataSet.lock.RLock()
+	defer dataSet.lock.RUnlock()
+	for key, value := range dataSet.data {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+// Snapshot 复制 map 本身以及 []byte 类型的值，其它类型的值为浅拷贝
+func (dataSet *FlowDataSet) Snapshot() DataSet {
+	dataSet.lock.RLock()
+	defer dataSet.lock.RUnlock()
+	snapshot := &FlowDataSet{
+		data: make(map[string]interface{}, len(dataSet.data)),
+	}
+	for key, value := range dataSet.data {
+		if bytes, ok := value.([]byte); ok {
+			value = append([]byte(nil), bytes...)
+		}
+		snapshot.data[key] = value
+	}
+	return snapshot
+}
+
+// Merge 合并后的 key 为 <prefix>.<key>，prefix 为空时直接使用原 key
+func (dataSet *FlowDataSet) Merge(other DataSet, prefix string) DataSet {
+	if other == nil || other == DataSet(dataSet) {
+		return dataSet
+	}
+	merged := make(map[string]interface{})
+	other.Range(func(key string, data interface{}) bool {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		merged[key] = data
+		return true
+	})
+
+	dataSet.lock.Lock()
+	defer dataSet.lock.Unlock()
+	for key, value := range merged {
+		dataSet.data[key] = value
+	}
+	return dataSet
+}
+
+func (dataSet *FlowDataSet) Scope(nodeID string) DataSet {
+	return &scopedDataSet{parent: dataSet, prefix: nodeID + "."}
+}
+
 func (dataSet *FlowDataSet) String() string {
 	dataSet.lock.RLock()
 	defer dataSet.lock.RUnlock()
@@ -47,3 +107,62 @@ func (dataSet *FlowDataSet) String() string {
 
 	return result.String()
 }
+
+// scopedDataSet 节点命名空间下的数据视图，数据实际存储在 parent 中。
+// 写入时 key 加上命名空间前缀；读取时优先读取命名空间下的 key，不存在时读取全局的 key
+type scopedDataSet struct {
+	parent DataSet
+	prefix string // <nodeID>.
+}
+
+func (scope *scopedDataSet) Set(key string, data interface{}) DataSet {
+	scope.parent.Set(scope.prefix+key, data)
+	return scope
+}
+
+func (scope *scopedDataSet) Get(key string) (data interface{}, ok bool) {
+	if data, ok = scope.parent.Get(scope.prefix + key); ok {
+		return
+	}
+	return scope.parent.Get(key)
+}
+
+// Range 只遍历命名空间下的数据，key 不带命名空间前缀
+func (scope *scopedDataSet) Range(fn func(key string, data interface{}) bool) {
+	scope.parent.Range(func(key string, data interface{}) bool {
+		if !strings.HasPrefix(key, scope.prefix) {
+			return true
+		}
+		return fn(strings.TrimPrefix(key, scope.prefix), data)
+	})
+}
+
+// Snapshot 复制整个 parent，返回副本上相同命名空间的视图
+func (scope *scopedDataSet) Snapshot() DataSet {
+	return &scopedDataSet{parent: scope.parent.Snapshot(), prefix: scope.prefix}
+}
+
+// Merge 将 other 中的数据合并到命名空间下
+func (scope *scopedDataSet) Merge(other DataSet, prefix string) DataSet {
+	if other == nil || other == DataSet(scope) {
+		return scope
+	}
+	if prefix != "" {
+		prefix = "." + prefix
+	}
+	scope.parent.Merge(other, strings.TrimSuffix(scope.prefix, ".")+prefix)
+	return scope
+}
+
+func (scope *scopedDataSet) Scope(nodeID string) DataSet {
+	return &scopedDataSet{parent: scope.parent, prefix: scope.prefix + nodeID + "."}
+}
+
+func (scope *scopedDataSet) String() string {
+	result := new(strings.Builder)
+	scope.Range(func(key string, data interface{}) bool {
+		result.WriteString(fmt.Sprintf("key=%s,value=%s", key, data))
+		return true
+	})
+	return result.String()
+}
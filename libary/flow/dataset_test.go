@@ -0,0 +1,119 @@
+package flow
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSetSnapshot(t *testing.T) {
+	is := assert.New(t)
+
+	parent := NewDataSet()
+	parent.Set("input", []byte("abc")).Set("count", 1)
+
+	child := parent.Snapshot()
+	child.Set("count", 2)
+	bytes, _ := child.Get("input")
+	bytes.([]byte)[0] = 'x'
+
+	count, _ := parent.Get("count")
+	is.Equal(1, count)
+	input, _ := parent.Get("input")
+	is.Equal([]byte("abc"), input)
+
+	parent.Merge(child, "child")
+	count, _ = parent.Get("child.count")
+	is.Equal(2, count)
+	input, _ = parent.Get("child.input")
+	is.Equal([]byte("xbc"), input)
+
+	parent.Merge(child, "")
+	count, _ = parent.Get("count")
+	is.Equal(2, count)
+}
+
+func TestDataSetConcurrentBranches(t *testing.T) {
+	is := assert.New(t)
+
+	parent := NewDataSet()
+	parent.Set("input", 0)
+
+	const branches = 8
+	var wg sync.WaitGroup
+	for i := 0; i < branches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			branch := parent.Snapshot()
+			for j := 0; j < 100; j++ {
+				// every branch writes the same key in its own scope
+				branch.Set("result", i*1000+j)
+				_, _ = branch.Get("input")
+			}
+			parent.Merge(branch, fmt.Sprintf("branch%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < branches; i++ {
+		result, ok := parent.Get(fmt.Sprintf("branch%d.result", i))
+		is.True(ok)
+		is.Equal(i*1000+99, result)
+	}
+	_, ok := parent.Get("result")
+	is.False(ok)
+}
+
+func TestDataSetScope(t *testing.T) {
+	is := assert.New(t)
+
+	data := NewDataSet()
+	data.Set("input", "global")
+	a, b := data.Scope("a"), data.Scope("b")
+
+	// two nodes writing the same local key do not collide
+	a.Set("result", 1)
+	b.Set("result", 2)
+	result, ok := a.Get("result")
+	is.True(ok)
+	is.Equal(1, result)
+	result, ok = b.Get("result")
+	is.True(ok)
+	is.Equal(2, result)
+	_, ok = data.Get("result")
+	is.False(ok)
+
+	// global keys and other namespaces are readable through the fallback
+	input, ok := a.Get("input")
+	is.True(ok)
+	is.Equal("global", input)
+	result, ok = b.Get("a.result")
+	is.True(ok)
+	is.Equal(1, result)
+
+	// a scoped key shadows the global one
+	a.Set("input", "local")
+	input, _ = a.Get("input")
+	is.Equal("local", input)
+	input, _ = b.Get("input")
+	is.Equal("global", input)
+
+	keys := make(map[string]interface{})
+	a.Range(func(key string, value interface{}) bool {
+		keys[key] = value
+		return true
+	})
+	is.Equal(map[string]interface{}{"result": 1, "input": "local"}, keys)
+
+	other := NewDataSet()
+	other.Set("x", 3)
+	a.Merge(other, "sub")
+	x, ok := data.Get("a.sub.x")
+	is.True(ok)
+	is.Equal(3, x)
+	x, _ = a.Scope("sub").Get("x")
+	is.Equal(3, x)
+}
@@ -1,59 +1,608 @@
 package flow
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/channel"
+	"github.com/longpi1/gopkg/libary/pool"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type Flow struct {
 	dag       *Dag
 	readyChan chan *Node
 	data      DataSet
+
+	remaining int32                    // 尚未执行完成的节点数量
+	running   sync.WaitGroup           // 已分发但尚未执行完成的节点
+	groups    map[string]chan struct{} // 并发组名称 -> 信号量
+
+	indegreeLock sync.Mutex
+	indegrees    map[*Node]int               // 节点剩余未完成的父节点数量，执行过程中不修改 Dag 本身
+	forwarded    map[*Node]int               // 节点已完成且未被条件转发剪枝的父节点数量
+	inputs       map[*Node]map[string][]byte // 节点 -> 父节点 Id -> 父节点转发的数据
+
+	statusLock sync.RWMutex
+	statuses   map[string]NodeStatus // 节点 Id -> 节点状态
+	nodeErrors map[string]error      // 执行失败的节点 Id -> 错误
+
+	tracer trace.Tracer         // 为每个节点创建子 span，为 nil 时不创建
+	pool   *pool.Pool[struct{}] // 执行节点任务的协程池，为 nil 时每个节点启动一个协程
+
+	foreachPool *pool.Pool[[]byte] // 执行 foreach 分区的协程池，为 nil 时每次 foreach 创建一个临时的协程池
+
+	observers []FlowObserver // 节点执行完成时通知的观察者
+
+	deterministic bool // 入度为0的节点按 index 排序后再分发
+
+	contextValues map[string]interface{} // 通过 context 传给每个节点的请求级数据
+
+	outputLock sync.Mutex
+	output     channel.Channel // 结束节点的输出流
+	finished   bool
+}
+
+// NodeStatus 节点的执行状态
+type NodeStatus int
+
+const (
+	// NodeStatusUnknown 流程中不存在该节点
+	NodeStatusUnknown NodeStatus = iota
+	// NodeStatusPending 等待父节点执行完成
+	NodeStatusPending
+	// NodeStatusRunning 正在执行
+	NodeStatusRunning
+	// NodeStatusDone 执行成功
+	NodeStatusDone
+	// NodeStatusFailed 执行失败
+	NodeStatusFailed
+	// NodeStatusSkipped 所有父节点的条件转发都未选中该节点，未执行
+	NodeStatusSkipped
+	// NodeStatusCancelled 流程的 ctx 在节点开始执行前被取消，未执行
+	NodeStatusCancelled
+)
+
+func (status NodeStatus) String() string {
+	switch status {
+	case NodeStatusPending:
+		return "pending"
+	case NodeStatusRunning:
+		return "running"
+	case NodeStatusDone:
+		return "done"
+	case NodeStatusFailed:
+		return "failed"
+	case NodeStatusSkipped:
+		return "skipped"
+	case NodeStatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// FlowObserver 流程执行的观察者，每个节点执行完成时被调用
+type FlowObserver interface {
+	OnNodeCompleted(flowID, nodeID string, err error, duration time.Duration)
+}
+
+// FlowResult 流程执行完成后的结果
+type FlowResult struct {
+	// Output 结束节点以节点 Id 为 key 写入的 []byte 输出，结束节点失败、被跳过或有多个结束节点时为 nil
+	Output []byte
+	// NodeErrors 执行失败的节点 Id -> 错误，没有节点失败时为空
+	NodeErrors map[string]error
+	// Duration 流程的执行时间
+	Duration time.Duration
+}
+
+// NodeOutput 结束节点执行完成后输出到 OutputChannel 的数据
+type NodeOutput struct {
+	NodeId string
+	// Data 节点任务以节点 Id 为 key 写入其命名空间的数据，未写入时为 nil
+	Data interface{}
+	Err  error
 }
 
 func NewFlow(dag *Dag) *Flow {
-	return &Flow{
-		dag:       dag,
-		readyChan: make(chan *Node, len(dag.nodes)),
-		data:      NewDataSet(),
+	flow := &Flow{
+		dag:        dag,
+		readyChan:  make(chan *Node, len(dag.nodes)),
+		data:       NewDataSet(),
+		remaining:  int32(len(dag.nodes)),
+		groups:     make(map[string]chan struct{}),
+		indegrees:  make(map[*Node]int, len(dag.nodes)),
+		forwarded:  make(map[*Node]int, len(dag.nodes)),
+		inputs:     make(map[*Node]map[string][]byte),
+		statuses:   make(map[string]NodeStatus, len(dag.nodes)),
+		nodeErrors: make(map[string]error),
+	}
+	for _, node := range dag.nodes {
+		flow.indegrees[node] = node.indegree
+		flow.statuses[node.Id] = NodeStatusPending
+	}
+	// 同一并发组声明了不同的上限时，取最小值
+	groupMax := make(map[string]int)
+	for _, node := range dag.nodes {
+		if node.concurrencyGroup == "" {
+			continue
+		}
+		if max, ok := groupMax[node.concurrencyGroup]; !ok || node.concurrencyMax < max {
+			groupMax[node.concurrencyGroup] = node.concurrencyMax
+		}
+	}
+	for group, max := range groupMax {
+		flow.groups[group] = make(chan struct{}, max)
+	}
+	return flow
+}
+
+// WithTracer 设置 tracer，每个节点执行时会以节点 Id 为名称创建一个子 span，节点失败时记录错误
+func (flow *Flow) WithTracer(tracer trace.Tracer) *Flow {
+	flow.tracer = tracer
+	return flow
+}
+
+// WithPool 设置协程池，节点任务提交到协程池中执行，避免扇出较多的图创建大量协程
+func (flow *Flow) WithPool(pool *pool.Pool[struct{}]) *Flow {
+	flow.pool = pool
+	return flow
+}
+
+// WithForEachPool 设置执行 foreach 分区的协程池，限制同时执行的分区数量，子流程中嵌套的 foreach 也使用该协程池。
+// 与 WithPool 分开，避免节点任务占用 worker 等待分区时分区无法执行而死锁
+func (flow *Flow) WithForEachPool(pool *pool.Pool[[]byte]) *Flow {
+	flow.foreachPool = pool
+	return flow
+}
+
+// WithDeterministicOrder 入度为0的节点按加入 Dag 的顺序（index）分发，而不是按 map 的随机顺序，
+// 子节点按添加边的顺序分发。配合只有一个 worker 的协程池使用时，执行顺序可以复现
+func (flow *Flow) WithDeterministicOrder() *Flow {
+	flow.deterministic = true
+	return flow
+}
+
+// WithContextValues 设置请求级的数据（租户 Id、trace Id 等），与流程数据 DataSet 分开，
+// 节点任务通过 ContextValue 从 Run 的 ctx 中读取
+func (flow *Flow) WithContextValues(values map[string]interface{}) *Flow {
+	if flow.contextValues == nil {
+		flow.contextValues = make(map[string]interface{}, len(values))
 	}
+	for key, value := range values {
+		flow.contextValues[key] = value
+	}
+	return flow
+}
+
+// contextValuesKey WithContextValues 设置的数据在 context 中的 key
+type contextValuesKey struct{}
+
+// ContextValue 读取 WithContextValues 设置的数据
+func ContextValue(ctx context.Context, key string) (interface{}, bool) {
+	values, _ := ctx.Value(contextValuesKey{}).(map[string]interface{})
+	value, ok := values[key]
+	return value, ok
+}
+
+// WithObserver 添加观察者，flowID 为流程对应 Dag 的 Id
+func (flow *Flow) WithObserver(observer FlowObserver) *Flow {
+	flow.observers = append(flow.observers, observer)
+	return flow
 }
 
+// Run 执行流程，所有节点执行完成后返回。
+// ctx 取消时不再分发节点，尚未开始执行的节点标记为 NodeStatusCancelled，关闭输出通道后立即返回，
+// 正在执行的节点通过 ctx 获知取消，在后台结束
 func (flow *Flow) Run(ctx context.Context) *Flow {
+	if len(flow.dag.nodes) == 0 {
+		return flow
+	}
+	if flow.contextValues != nil {
+		ctx = context.WithValue(ctx, contextValuesKey{}, flow.contextValues)
+	}
 	// 遍历图的节点，寻找入度为0的父节点
+	var roots []*Node
 	for _, node := range flow.dag.nodes {
 		if node.indegree == 0 {
-			flow.readyChan <- node
+			roots = append(roots, node)
 		}
 	}
+	if flow.deterministic {
+		sort.Slice(roots, func(i, j int) bool {
+			return roots[i].index < roots[j].index
+		})
+	}
+	for _, node := range roots {
+		flow.readyChan <- node
+	}
 	// 执行就绪通道中的节点任务
-	for nodeTask := range flow.readyChan {
+	for {
+		// ctx 与就绪节点同时就绪时优先处理取消
+		if ctx.Err() != nil {
+			flow.cancel()
+			return flow
+		}
+		var nodeTask *Node
+		select {
+		case node, ok := <-flow.readyChan:
+			if !ok {
+				return flow
+			}
+			nodeTask = node
+		case <-ctx.Done():
+			flow.cancel()
+			return flow
+		}
 		if nodeTask != nil {
+			flow.running.Add(1)
+			if flow.pool != nil {
+				flow.submit(ctx, nodeTask)
+				continue
+			}
 			go func() {
+				defer flow.running.Done()
 				err := flow.RunNode(ctx, nodeTask)
 				if err != nil {
 
 				}
 			}()
 		}
+	}
+}
 
+// submit 将节点任务提交到协程池。提交失败（协程池已释放、非阻塞模式下过载等）时任务不会执行，
+// 节点直接以提交的错误失败，否则流程会一直等待该节点完成
+func (flow *Flow) submit(ctx context.Context, node *Node) {
+	var started atomic.Bool
+	future := flow.pool.Submit(func() (struct{}, error) {
+		started.Store(true)
+		defer flow.running.Done()
+		return struct{}{}, flow.RunNode(ctx, node)
+	})
+	select {
+	case <-future.Inner():
+	default:
+		// 任务已进入协程池
+		return
 	}
-	return flow
+	if started.Load() || future.Err == nil {
+		return
+	}
+	err := fmt.Errorf("flow: submit node %s: %w", node.Id, future.Err)
+	flow.setFailed(node.Id, err)
+	for _, observer := range flow.observers {
+		observer.OnNodeCompleted(flow.dag.Id, node.Id, err, 0)
+	}
+	flow.RunNodeDone(ctx, node, err)
+	flow.running.Done()
+}
+
+// cancel 将尚未开始执行的节点标记为已取消，并关闭输出通道
+func (flow *Flow) cancel() {
+	flow.statusLock.Lock()
+	for id, status := range flow.statuses {
+		if status == NodeStatusPending {
+			flow.statuses[id] = NodeStatusCancelled
+		}
+	}
+	flow.statusLock.Unlock()
+	flow.finish()
+}
+
+// RunAndWait 执行流程，所有节点执行完成后返回执行结果。
+// ctx 取消时等待正在执行的节点结束后返回，有节点因取消未执行时返回的错误列出这些节点并包装 ctx.Err()；
+// 有节点执行失败时同时返回错误，错误信息中列出失败的节点并包装按 Id 排序的第一个节点的错误
+func (flow *Flow) RunAndWait(ctx context.Context) (*FlowResult, error) {
+	start := time.Now()
+	flow.Run(ctx)
+	// ctx 取消时 Run 不等待正在执行的节点即返回
+	flow.running.Wait()
+	result := &FlowResult{
+		NodeErrors: flow.NodeErrors(),
+		Duration:   time.Since(start),
+	}
+	if end, err := flow.dag.outputNode(); err == nil {
+		output, _ := flow.data.Scope(end.Id).Get(end.Id)
+		result.Output, _ = output.([]byte)
+	}
+	if ctx.Err() != nil {
+		var cancelled []string
+		for id, status := range flow.AllStatuses() {
+			if status == NodeStatusCancelled {
+				cancelled = append(cancelled, id)
+			}
+		}
+		if len(cancelled) > 0 {
+			sort.Strings(cancelled)
+			return result, fmt.Errorf("flow %s: nodes %v cancelled: %w", flow.dag.Id, cancelled, ctx.Err())
+		}
+	}
+	if len(result.NodeErrors) == 0 {
+		return result, nil
+	}
+	failed := make([]string, 0, len(result.NodeErrors))
+	for id := range result.NodeErrors {
+		failed = append(failed, id)
+	}
+	sort.Strings(failed)
+	return result, fmt.Errorf("flow %s: nodes %v failed: %w", flow.dag.Id, failed, result.NodeErrors[failed[0]])
+}
+
+// RunWithTimeout 执行流程，限制整个流程的执行时间不超过 d。所有节点在超时前执行完成时返回nil；
+// 超时（或 ctx 取消）时立即返回 ctx.Err()，并在错误信息中列出未成功完成的节点
+// （包括已取消、正在执行以及因超时而失败的节点）。
+// 超时后尚未开始的节点不再执行任务，正在执行的节点通过 ctx 获知取消
+func (flow *Flow) RunWithTimeout(ctx context.Context, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	flow.Run(ctx)
+	if ctx.Err() == nil {
+		return nil
+	}
+	// 正在执行的节点可能已经因为取消而失败，流程也可能因此已经结束，因此列出所有未成功完成的节点
+	var unfinished []string
+	for id, status := range flow.AllStatuses() {
+		if status != NodeStatusDone && status != NodeStatusSkipped {
+			unfinished = append(unfinished, id)
+		}
+	}
+	if len(unfinished) == 0 {
+		// 超时的同时流程恰好执行完成
+		return nil
+	}
+	sort.Strings(unfinished)
+	return fmt.Errorf("flow %s: nodes %v not finished: %w", flow.dag.Id, unfinished, ctx.Err())
 }
 
 func (flow *Flow) RunNode(ctx context.Context, node *Node) (err error) {
+	start := time.Now()
+	started := false
 	defer func() {
 		// todo 一些后置操作
+		if err != nil && !started && ctx.Err() != nil {
+			// 流程已取消，节点没有开始执行
+			flow.setStatus(node.Id, NodeStatusCancelled)
+		} else if err != nil {
+			flow.setFailed(node.Id, err)
+		} else {
+			flow.setStatus(node.Id, NodeStatusDone)
+		}
+		for _, observer := range flow.observers {
+			observer.OnNodeCompleted(flow.dag.Id, node.Id, err, time.Since(start))
+		}
 		flow.RunNodeDone(ctx, node, err)
 	}()
-	err = node.task.Run(ctx, flow.data)
+	// 节点的 context 派生自流程的 context，span 需要在 RunNodeDone 之前结束
+	if flow.tracer != nil {
+		var span trace.Span
+		ctx, span = flow.tracer.Start(ctx, node.Id)
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+	// 同一并发组内同时执行的节点数量不超过上限
+	if sem, ok := flow.groups[node.concurrencyGroup]; ok {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	// 流程已超时或取消，不再执行节点任务
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	flow.setStatus(node.Id, NodeStatusRunning)
+	started = true
+	if err = flow.setInput(node); err != nil {
+		return err
+	}
+	// 每个节点写入自己的命名空间，读取时也能读到全局及其它节点命名空间下的数据
+	data := flow.data.Scope(node.Id)
+	if node.task == nil {
+		if node.foreach != nil {
+			return flow.runForEach(ctx, node, data)
+		}
+		return runOperations(node, data)
+	}
+	err = node.task.Run(ctx, data)
 	return err
 }
 
+// setInput 将父节点转发的数据以节点 Id 为 key 写入流程数据，作为节点的输入。
+// 设置了 aggregator 时由 aggregator 合并各父节点的数据；只有一个父节点转发数据时直接作为输入；
+// 没有父节点转发数据时保留已有的输入。多个父节点转发数据且没有 aggregator 时，没有设置 Task 的节点返回错误，
+// 设置了 Task 的节点不写入输入，由任务自行读取各父节点命名空间下的数据
+func (flow *Flow) setInput(node *Node) error {
+	flow.indegreeLock.Lock()
+	inputs := flow.inputs[node]
+	delete(flow.inputs, node)
+	flow.indegreeLock.Unlock()
+
+	var input []byte
+	switch {
+	case len(inputs) == 0:
+		return nil
+	case node.aggregator != nil:
+		aggregated, err := node.aggregator(inputs)
+		if err != nil {
+			return fmt.Errorf("flow: aggregate the inputs of node %s: %w", node.Id, err)
+		}
+		input = aggregated
+	case len(inputs) == 1:
+		for _, data := range inputs {
+			input = data
+		}
+	case node.task != nil:
+		return nil
+	default:
+		return fmt.Errorf("flow: node %s receives %d inputs without an aggregator", node.Id, len(inputs))
+	}
+	flow.data.Set(node.Id, input)
+	return nil
+}
+
+// runOperations 执行没有设置 Task 的节点：以节点 Id 为 key 读取 []byte 类型的输入（父节点转发的数据由 setInput 写入），
+// 依次执行节点的 operations，结果以节点 Id 为 key 写入节点的命名空间。
+// DataSetOperation 使用节点命名空间的 DataSet 执行，写入的 key 可以被下游节点以 <节点Id>.<key> 读取
+func runOperations(node *Node, data DataSet) error {
+	input, _ := data.Get(node.Id)
+	bytes, _ := input.([]byte)
+	result, err := node.ExecuteWithData(bytes, data)
+	if err != nil {
+		return err
+	}
+	data.Set(node.Id, result)
+	return nil
+}
+
+// Status 返回节点当前的执行状态，可以在流程执行过程中并发调用
+func (flow *Flow) Status(nodeID string) NodeStatus {
+	flow.statusLock.RLock()
+	defer flow.statusLock.RUnlock()
+	return flow.statuses[nodeID]
+}
+
+// AllStatuses 返回所有节点当前执行状态的副本，key 为节点 Id
+func (flow *Flow) AllStatuses() map[string]NodeStatus {
+	flow.statusLock.RLock()
+	defer flow.statusLock.RUnlock()
+	statuses := make(map[string]NodeStatus, len(flow.statuses))
+	for id, status := range flow.statuses {
+		statuses[id] = status
+	}
+	return statuses
+}
+
+// NodeErrors 返回执行失败的节点错误的副本，key 为节点 Id
+func (flow *Flow) NodeErrors() map[string]error {
+	flow.statusLock.RLock()
+	defer flow.statusLock.RUnlock()
+	errs := make(map[string]error, len(flow.nodeErrors))
+	for id, err := range flow.nodeErrors {
+		errs[id] = err
+	}
+	return errs
+}
+
+func (flow *Flow) setStatus(nodeID string, status NodeStatus) {
+	flow.statusLock.Lock()
+	defer flow.statusLock.Unlock()
+	flow.statuses[nodeID] = status
+}
+
+// setFailed 标记节点执行失败并记录错误
+func (flow *Flow) setFailed(nodeID string, err error) {
+	flow.statusLock.Lock()
+	defer flow.statusLock.Unlock()
+	flow.statuses[nodeID] = NodeStatusFailed
+	flow.nodeErrors[nodeID] = err
+}
+
+// OutputChannel 返回一个通道，每个结束节点（出度为0）执行完成后输出一个 NodeOutput，流程结束后通道关闭
+// 需要在 Run 之前调用才能收到全部输出
+func (flow *Flow) OutputChannel() channel.Channel {
+	flow.outputLock.Lock()
+	defer flow.outputLock.Unlock()
+	if flow.output == nil {
+		// 非阻塞模式，消费者处理慢时不会阻塞流程的执行
+		flow.output = channel.New(channel.WithNonBlock())
+		if flow.finished {
+			flow.output.Close()
+		}
+	}
+	return flow.output
+}
+
 func (flow *Flow) RunNodeDone(ctx context.Context, node *Node, err error) {
+	flow.completeNode(node, err, false)
+}
+
+// completeNode 节点执行完成或被跳过后，按条件转发决定子节点是否执行，并在所有节点完成时结束流程
+func (flow *Flow) completeNode(node *Node, err error, skipped bool) {
 	// todo 一些后置操作，例如更新节点状态，释放资源等
-	// 可以在这里将子节点的入度 -1，当入度为0时，将其放入 readyChan
+	if node.outdegree == 0 && !skipped {
+		flow.emitOutput(node, err)
+	}
+	var output []byte
+	if !skipped {
+		value, _ := flow.data.Scope(node.Id).Get(node.Id)
+		output, _ = value.([]byte)
+	}
+	// 将子节点的剩余入度 -1，当入度为0时，有父节点转发过数据则放入 readyChan，否则跳过该节点
+	var skip []*Node
+	flow.indegreeLock.Lock()
 	for _, child := range node.children {
-		child.indegree--
-		if child.indegree == 0 {
-			flow.readyChan <- child
+		if !skipped && flow.forward(node, child, output) {
+			flow.forwarded[child]++
+		}
+		flow.indegrees[child]--
+		if flow.indegrees[child] == 0 {
+			if flow.forwarded[child] > 0 {
+				flow.readyChan <- child
+			} else {
+				skip = append(skip, child)
+			}
+		}
+	}
+	flow.indegreeLock.Unlock()
+	for _, child := range skip {
+		flow.setStatus(child.Id, NodeStatusSkipped)
+		flow.completeNode(child, nil, true)
+	}
+	// 所有节点执行完成，结束流程
+	if atomic.AddInt32(&flow.remaining, -1) == 0 {
+		flow.finish()
+		close(flow.readyChan)
+	}
+}
+
+// forward 判断节点到子节点的边是否转发，转发时记录边的 forwarder 处理后的节点输出，子节点执行前由 setInput 合并为输入。
+// 没有设置条件转发的边总是转发，条件转发的边只在谓词返回 true 时转发；
+// forwarder 为 nil 的边只表示执行依赖，不转发数据，没有输出的任务节点也不转发数据，不覆盖子节点已有的输入。
+// 调用方需持有 indegreeLock
+func (flow *Flow) forward(node, child *Node, output []byte) bool {
+	if predicate := node.predicates[child.Id]; predicate != nil && !predicate(output) {
+		return false
+	}
+	if forwarder := node.forwarder[child.Id]; forwarder != nil && output != nil {
+		if flow.inputs[child] == nil {
+			flow.inputs[child] = make(map[string][]byte)
 		}
+		flow.inputs[child][node.Id] = forwarder(output)
+	}
+	return true
+}
+
+// emitOutput 将结束节点的输出写入输出通道
+func (flow *Flow) emitOutput(node *Node, err error) {
+	flow.outputLock.Lock()
+	defer flow.outputLock.Unlock()
+	if flow.output == nil {
+		return
+	}
+	data, _ := flow.data.Scope(node.Id).Get(node.Id)
+	flow.output.Input(NodeOutput{NodeId: node.Id, Data: data, Err: err})
+}
+
+// finish 标记流程结束并关闭输出通道
+func (flow *Flow) finish() {
+	flow.outputLock.Lock()
+	defer flow.outputLock.Unlock()
+	flow.finished = true
+	if flow.output != nil {
+		flow.output.Close()
 	}
 }
@@ -0,0 +1,700 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/pool"
+	"github.com/panjf2000/ants/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// funcTask adapts a function to Task
+type funcTask struct {
+	name string
+	run  func(ctx context.Context, data DataSet) error
+}
+
+func (t *funcTask) NodeName() string {
+	return t.name
+}
+
+func (t *funcTask) Run(ctx context.Context, data DataSet) error {
+	return t.run(ctx, data)
+}
+
+func TestFlowConcurrencyGroup(t *testing.T) {
+	is := assert.New(t)
+
+	var running, maxRunning, otherRan int32
+	limited := func(ctx context.Context, data DataSet) error {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&maxRunning)
+			if cur <= old || atomic.CompareAndSwapInt32(&maxRunning, old, cur) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	dag := NewDag()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		node := dag.AddVertex(id, []Operation{})
+		node.task = &funcTask{name: id, run: limited}
+		node.SetConcurrencyGroup("api", 2)
+	}
+	// a node of another group is not blocked by the "api" group
+	other := dag.AddVertex("other", []Operation{})
+	other.task = &funcTask{name: "other", run: func(ctx context.Context, data DataSet) error {
+		atomic.AddInt32(&otherRan, 1)
+		return nil
+	}}
+	other.SetConcurrencyGroup("db", 1)
+
+	done := make(chan struct{})
+	go func() {
+		NewFlow(dag).Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flow did not finish")
+	}
+
+	is.Equal(int32(2), atomic.LoadInt32(&maxRunning))
+	is.Equal(int32(1), atomic.LoadInt32(&otherRan))
+}
+
+func TestFlowOutputChannel(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("a", "c"))
+	errFailed := errors.New("failed")
+	for _, id := range []string{"a", "b", "c"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			data.Set(id, "output of "+id)
+			if id == "c" {
+				return errFailed
+			}
+			return nil
+		}}
+	}
+
+	flow := NewFlow(dag)
+	output := flow.OutputChannel()
+	go flow.Run(context.Background())
+
+	outputs := make(map[string]NodeOutput)
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case v, ok := <-output.Output():
+			if !ok {
+				done = true
+				break
+			}
+			out := v.(NodeOutput)
+			outputs[out.NodeId] = out
+		case <-timeout:
+			t.Fatal("output channel was not closed")
+		}
+	}
+
+	is.Len(outputs, 2)
+	is.Equal("output of b", outputs["b"].Data)
+	is.NoError(outputs["b"].Err)
+	is.Equal("output of c", outputs["c"].Data)
+	is.ErrorIs(outputs["c"].Err, errFailed)
+
+	// the channel of a finished flow is closed right away
+	_, ok := <-flow.OutputChannel().Output()
+	is.False(ok)
+}
+
+func TestFlowWithTracer(t *testing.T) {
+	is := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("flow")
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("a", "c"))
+	errFailed := errors.New("failed")
+	for _, id := range []string{"a", "b", "c"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			if id == "c" {
+				return errFailed
+			}
+			return nil
+		}}
+	}
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	NewFlow(dag).WithTracer(tracer).Run(ctx)
+	root.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	is.Len(spans, 4)
+	for _, id := range []string{"a", "b", "c"} {
+		span := spans[id]
+		is.NotNil(span)
+		is.Equal(root.SpanContext().TraceID(), span.SpanContext().TraceID())
+		is.Equal(root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	is.Equal(codes.Error, spans["c"].Status().Code)
+	is.Len(spans["c"].Events(), 1)
+	is.Equal(codes.Unset, spans["a"].Status().Code)
+}
+
+func TestFlowWithPool(t *testing.T) {
+	is := assert.New(t)
+
+	var running, maxRunning, ran int32
+	run := func(ctx context.Context, data DataSet) error {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&maxRunning)
+			if cur <= old || atomic.CompareAndSwapInt32(&maxRunning, old, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&ran, 1)
+		return nil
+	}
+
+	dag := NewDag()
+	root := dag.AddVertex("root", []Operation{})
+	root.task = &funcTask{name: "root", run: run}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("leaf%d", i)
+		is.NoError(dag.AddEdge("root", id))
+		dag.GetNode(id).task = &funcTask{name: id, run: run}
+	}
+
+	p := pool.NewPool[struct{}](8)
+	defer p.Release()
+	NewFlow(dag).WithPool(p).Run(context.Background())
+
+	is.Equal(int32(1001), atomic.LoadInt32(&ran))
+	is.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(8))
+}
+
+func TestFlowWithReleasedPool(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	var ran int32
+	for _, id := range []string{"a", "b"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}}
+	}
+
+	// nodes failing to be submitted fail instead of blocking Run forever
+	p := pool.NewPool[struct{}](2)
+	p.Release()
+	done := make(chan struct{})
+	var err error
+	go func() {
+		_, err = NewFlow(dag).WithPool(p).RunAndWait(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return with a released pool")
+	}
+	is.ErrorIs(err, ants.ErrPoolClosed)
+	is.Contains(err.Error(), "[a b]")
+	is.Equal(int32(0), atomic.LoadInt32(&ran))
+}
+
+func TestFlowKeepsDagIndegree(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	var ran int32
+	for _, id := range []string{"a", "b", "c", "d"} {
+		node := dag.AddVertex(id, []Operation{})
+		node.task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}}
+	}
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("a", "c"))
+	is.NoError(dag.AddEdge("b", "d"))
+	is.NoError(dag.AddEdge("c", "d"))
+
+	indegrees := func() map[string]int {
+		result := make(map[string]int)
+		for id, node := range dag.nodes {
+			result[id] = node.Indegree()
+		}
+		return result
+	}
+	before := indegrees()
+
+	NewFlow(dag).Run(context.Background())
+	is.Equal(int32(4), atomic.LoadInt32(&ran))
+	is.Equal(before, indegrees())
+
+	// the same dag can be run again
+	NewFlow(dag).Run(context.Background())
+	is.Equal(int32(8), atomic.LoadInt32(&ran))
+}
+
+func TestFlowScopedDataSet(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	for i, id := range []string{"a", "b"} {
+		value := i
+		node := dag.AddVertex(id, []Operation{})
+		node.task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			data.Set("result", value)
+			return nil
+		}}
+	}
+
+	flow := NewFlow(dag).Run(context.Background())
+	for i, id := range []string{"a", "b"} {
+		result, ok := flow.data.Get(id + ".result")
+		is.True(ok)
+		is.Equal(i, result)
+	}
+	_, ok := flow.data.Get("result")
+	is.False(ok)
+}
+
+func TestFlowNodeStatus(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	dag.GetNode("a").task = &funcTask{name: "a", run: func(ctx context.Context, data DataSet) error {
+		close(started)
+		<-release
+		return nil
+	}}
+	dag.GetNode("b").task = &funcTask{name: "b", run: func(ctx context.Context, data DataSet) error {
+		return errors.New("failed")
+	}}
+
+	flow := NewFlow(dag)
+	is.Equal(map[string]NodeStatus{"a": NodeStatusPending, "b": NodeStatusPending}, flow.AllStatuses())
+
+	done := make(chan struct{})
+	go func() {
+		flow.Run(context.Background())
+		close(done)
+	}()
+	<-started
+	is.Equal(NodeStatusRunning, flow.Status("a"))
+	is.Equal(NodeStatusPending, flow.Status("b"))
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flow did not finish")
+	}
+	is.Equal(map[string]NodeStatus{"a": NodeStatusDone, "b": NodeStatusFailed}, flow.AllStatuses())
+	is.Equal(NodeStatusUnknown, flow.Status("missing"))
+	is.Equal("failed", flow.Status("b").String())
+}
+
+func TestFlowDeterministicOrder(t *testing.T) {
+	is := assert.New(t)
+
+	for i := 0; i < 20; i++ {
+		var lock sync.Mutex
+		var order []string
+		dag := NewDag()
+		for _, id := range []string{"c", "b", "a"} {
+			dag.AddVertex(id, []Operation{})
+		}
+		is.NoError(dag.AddEdge("a", "x"))
+		is.NoError(dag.AddEdge("x", "y"))
+		for _, id := range []string{"a", "b", "c", "x", "y"} {
+			dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+				lock.Lock()
+				defer lock.Unlock()
+				order = append(order, id)
+				return nil
+			}}
+		}
+
+		p := pool.NewPool[struct{}](1)
+		NewFlow(dag).WithPool(p).WithDeterministicOrder().Run(context.Background())
+		p.Release()
+		// roots in the order they were added, then the chain
+		is.Equal([]string{"c", "b", "a", "x", "y"}, order)
+	}
+}
+
+func TestFlowContextValues(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	var tenants sync.Map
+	for _, id := range []string{"a", "b"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			tenant, ok := ContextValue(ctx, "tenant")
+			is.True(ok)
+			tenants.Store(id, tenant)
+			_, ok = ContextValue(ctx, "missing")
+			is.False(ok)
+			// context values are not part of the flow data
+			_, ok = data.Get("tenant")
+			is.False(ok)
+			return nil
+		}}
+	}
+
+	NewFlow(dag).WithContextValues(map[string]interface{}{"tenant": "t1"}).Run(context.Background())
+	for _, id := range []string{"a", "b"} {
+		tenant, _ := tenants.Load(id)
+		is.Equal("t1", tenant)
+	}
+
+	_, ok := ContextValue(context.Background(), "tenant")
+	is.False(ok)
+}
+
+func TestFlowRunWithTimeout(t *testing.T) {
+	is := assert.New(t)
+
+	newDag := func(ran *sync.Map) *Dag {
+		dag := NewDag()
+		is.NoError(dag.AddEdge("a", "b"))
+		is.NoError(dag.AddEdge("b", "c"))
+		for _, id := range []string{"a", "b", "c"} {
+			dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+				ran.Store(id, true)
+				select {
+				case <-time.After(50 * time.Millisecond):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}}
+		}
+		return dag
+	}
+
+	// each node is under 80ms but the flow takes 150ms
+	var ran sync.Map
+	flow := NewFlow(newDag(&ran))
+	start := time.Now()
+	err := flow.RunWithTimeout(context.Background(), 80*time.Millisecond)
+	is.ErrorIs(err, context.DeadlineExceeded)
+	is.Less(time.Since(start), 140*time.Millisecond)
+	is.Contains(err.Error(), "[b c]")
+
+	is.Eventually(func() bool {
+		return flow.Status("b") == NodeStatusFailed
+	}, time.Second, time.Millisecond)
+	is.Equal(NodeStatusDone, flow.Status("a"))
+	is.Equal(NodeStatusCancelled, flow.Status("c"))
+	_, ok := ran.Load("c")
+	is.False(ok)
+
+	// the same flow finishes in time with a larger budget
+	is.NoError(NewFlow(newDag(&ran)).RunWithTimeout(context.Background(), time.Second))
+}
+
+func TestFlowRunCancel(t *testing.T) {
+	is := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a -> b -> c, cancelled once a finishes
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("b", "c"))
+	var ran sync.Map
+	for _, id := range []string{"a", "b", "c"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			ran.Store(id, true)
+			if id == "a" {
+				cancel()
+			}
+			return nil
+		}}
+	}
+
+	flow := NewFlow(dag)
+	done := make(chan struct{})
+	go func() {
+		flow.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+
+	is.Eventually(func() bool {
+		return flow.Status("b") == NodeStatusCancelled
+	}, time.Second, time.Millisecond)
+	is.Equal(NodeStatusDone, flow.Status("a"))
+	is.Equal(NodeStatusCancelled, flow.Status("c"))
+	for _, id := range []string{"b", "c"} {
+		_, ok := ran.Load(id)
+		is.False(ok, id)
+	}
+
+	// the output channel is closed so consumers don't block
+	_, ok := <-flow.OutputChannel().Output()
+	is.False(ok)
+}
+
+func TestFlowRunAndWaitCancel(t *testing.T) {
+	is := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a -> b cancels the flow once a finishes, slow is still running at that time
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	dag.AddVertex("slow", []Operation{})
+	var slowDone atomic.Bool
+	slowStarted := make(chan struct{})
+	for _, id := range []string{"a", "b", "slow"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			switch id {
+			case "a":
+				<-slowStarted
+				cancel()
+			case "slow":
+				close(slowStarted)
+				time.Sleep(50 * time.Millisecond)
+				data.Set("slow", []byte("done"))
+				slowDone.Store(true)
+			}
+			return nil
+		}}
+	}
+
+	flow := NewFlow(dag)
+	result, err := flow.RunAndWait(ctx)
+	is.ErrorIs(err, context.Canceled)
+	is.Contains(err.Error(), "[b]")
+	is.NotNil(result)
+	// the nodes running when the flow was cancelled are waited for
+	is.True(slowDone.Load())
+	is.Equal(NodeStatusDone, flow.Status("slow"))
+	is.Equal(NodeStatusCancelled, flow.Status("b"))
+}
+
+func TestFlowConditionalForwarder(t *testing.T) {
+	is := assert.New(t)
+
+	route := func(output string) (*Flow, *sync.Map) {
+		dag := NewDag()
+		is.NoError(dag.AddEdge("a", "left"))
+		is.NoError(dag.AddEdge("a", "right"))
+		is.NoError(dag.AddEdge("right", "after-right"))
+		upper := func(data []byte) []byte { return []byte(strings.ToUpper(string(data))) }
+		a := dag.GetNode("a")
+		a.AddConditionalForwarder("left", func(data []byte) bool { return string(data) == "left" }, upper)
+		a.AddConditionalForwarder("right", func(data []byte) bool { return string(data) == "right" }, upper)
+
+		var inputs sync.Map
+		a.task = &funcTask{name: "a", run: func(ctx context.Context, data DataSet) error {
+			data.Set("a", []byte(output))
+			return nil
+		}}
+		for _, id := range []string{"left", "right", "after-right"} {
+			dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+				input, _ := data.Get(id)
+				inputs.Store(id, input)
+				return nil
+			}}
+		}
+		return NewFlow(dag).Run(context.Background()), &inputs
+	}
+
+	flow, inputs := route("left")
+	input, ok := inputs.Load("left")
+	is.True(ok)
+	is.Equal([]byte("LEFT"), input)
+	_, ok = inputs.Load("right")
+	is.False(ok)
+	_, ok = inputs.Load("after-right")
+	is.False(ok)
+	is.Equal(map[string]NodeStatus{
+		"a":           NodeStatusDone,
+		"left":        NodeStatusDone,
+		"right":       NodeStatusSkipped,
+		"after-right": NodeStatusSkipped,
+	}, flow.AllStatuses())
+
+	flow, inputs = route("right")
+	_, ok = inputs.Load("left")
+	is.False(ok)
+	input, _ = inputs.Load("right")
+	is.Equal([]byte("RIGHT"), input)
+	_, ok = inputs.Load("after-right")
+	is.True(ok)
+	is.Equal(NodeStatusSkipped, flow.Status("left"))
+	is.Equal("skipped", flow.Status("left").String())
+}
+
+func TestFlowForwarder(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "upper"))
+	is.NoError(dag.AddEdge("a", "plain"))
+	is.NoError(dag.AddEdge("a", "exec-only"))
+	a := dag.GetNode("a")
+	a.AddForwarder("upper", func(data []byte) []byte { return []byte(strings.ToUpper(string(data))) })
+	// AddEdge sets DefaultForwarder on plain, a nil forwarder only orders the execution
+	a.AddForwarder("exec-only", nil)
+
+	a.task = &funcTask{name: "a", run: func(ctx context.Context, data DataSet) error {
+		data.Set("a", []byte("data"))
+		return nil
+	}}
+	var inputs sync.Map
+	for _, id := range []string{"upper", "plain", "exec-only"} {
+		dag.GetNode(id).task = &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			input, _ := data.Get(id)
+			inputs.Store(id, input)
+			return nil
+		}}
+	}
+	NewFlow(dag).Run(context.Background())
+
+	input, _ := inputs.Load("upper")
+	is.Equal([]byte("DATA"), input)
+	input, _ = inputs.Load("plain")
+	is.Equal([]byte("data"), input)
+	input, ok := inputs.Load("exec-only")
+	is.True(ok)
+	is.Nil(input)
+}
+
+func TestFlowOperationChain(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	dag.AddVertex("a", []Operation{FuncOperation(func(data []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(data))), nil
+	})})
+	dag.AddVertex("b", []Operation{FuncOperation(func(data []byte) ([]byte, error) {
+		return append(data, '!'), nil
+	})})
+	dag.AddVertex("c", []Operation{&BlankOperation{}})
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("b", "c"))
+	dag.GetNode("b").AddForwarder("c", func(data []byte) []byte { return append(data, '?') })
+
+	// the output of each node is piped to the operations of its child
+	flow := NewFlow(dag)
+	flow.data.Set("a", []byte("hello"))
+	result, err := flow.RunAndWait(context.Background())
+	is.NoError(err)
+	is.Equal([]byte("HELLO!?"), result.Output)
+}
+
+func TestFlowAggregator(t *testing.T) {
+	is := assert.New(t)
+	newDag := func() *Dag {
+		dag := NewDag()
+		for _, id := range []string{"x", "y"} {
+			dag.AddVertex(id, []Operation{FuncOperation(func(data []byte) ([]byte, error) {
+				return []byte(id), nil
+			})})
+			is.NoError(dag.AddEdge("root", id))
+			is.NoError(dag.AddEdge(id, "join"))
+		}
+		dag.GetNode("root").AddOperation(&BlankOperation{})
+		dag.GetNode("join").AddOperation(&BlankOperation{})
+		return dag
+	}
+
+	dag := newDag()
+	dag.GetNode("join").AddAggregator(func(inputs map[string][]byte) ([]byte, error) {
+		return []byte(string(inputs["x"]) + "+" + string(inputs["y"])), nil
+	})
+	flow := NewFlow(dag)
+	flow.data.Set("root", []byte("in"))
+	result, err := flow.RunAndWait(context.Background())
+	is.NoError(err)
+	is.Equal([]byte("x+y"), result.Output)
+
+	// the inputs of several parents can not be piped into operations without an aggregator
+	flow = NewFlow(newDag())
+	flow.data.Set("root", []byte("in"))
+	_, err = flow.RunAndWait(context.Background())
+	is.ErrorContains(err, "node join receives 2 inputs without an aggregator")
+}
+
+func TestFlowRunAndWait(t *testing.T) {
+	is := assert.New(t)
+	dag := NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	is.NoError(dag.AddEdge("a", "broken"))
+	is.NoError(dag.AddEdge("b", "end"))
+	is.NoError(dag.AddEdge("broken", "end"))
+
+	errBroken := errors.New("broken")
+	set := func(id, value string) *funcTask {
+		return &funcTask{name: id, run: func(ctx context.Context, data DataSet) error {
+			data.Set(id, []byte(value))
+			return nil
+		}}
+	}
+	dag.GetNode("a").task = set("a", "a")
+	dag.GetNode("b").task = set("b", "b")
+	dag.GetNode("broken").task = &funcTask{name: "broken", run: func(ctx context.Context, data DataSet) error {
+		return errBroken
+	}}
+	dag.GetNode("end").task = &funcTask{name: "end", run: func(ctx context.Context, data DataSet) error {
+		b, _ := data.Get("b.b")
+		data.Set("end", append([]byte("end:"), b.([]byte)...))
+		return nil
+	}}
+
+	result, err := NewFlow(dag).RunAndWait(context.Background())
+	is.ErrorIs(err, errBroken)
+	is.Contains(err.Error(), "[broken]")
+	is.Equal([]byte("end:b"), result.Output)
+	is.Equal(map[string]error{"broken": errBroken}, result.NodeErrors)
+	is.Greater(result.Duration, time.Duration(0))
+
+	// a flow without failures returns no error
+	dag = NewDag()
+	is.NoError(dag.AddEdge("a", "b"))
+	dag.GetNode("a").task = set("a", "a")
+	dag.GetNode("b").task = set("b", "done")
+	result, err = NewFlow(dag).RunAndWait(context.Background())
+	is.NoError(err)
+	is.Equal([]byte("done"), result.Output)
+	is.Empty(result.NodeErrors)
+}
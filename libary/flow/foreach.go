@@ -0,0 +1,149 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/future"
+	"github.com/longpi1/gopkg/libary/pool"
+)
+
+// runForEach 执行没有设置 Task 的 foreach 节点：以节点 Id 为 key 读取 []byte 类型的输入，按 ForEach 拆分为多个分区，
+// 每个分区以子流程执行 foreach dag。分区按 key 排序后提交到协程池，输出按 key 的顺序交给 sub aggregator 合并，
+// 合并结果以节点 Id 为 key 写入节点的命名空间。任意分区失败时返回按 key 排序的第一个错误。
+// 未设置 WithForEachPool 时使用临时的协程池，worker 数量不超过 GOMAXPROCS；子流程中嵌套的 foreach 共享同一个协程池，
+// 没有空闲 worker 时分区由当前协程执行，外层分区占满 worker 时内层分区不会因等待 worker 而死锁。
+// 子流程写入的数据合并到节点的命名空间下，见 runPartition
+func (flow *Flow) runForEach(ctx context.Context, node *Node, data DataSet) error {
+	if node.subDag == nil {
+		return fmt.Errorf("flow: foreach node %s has no foreach dag", node.Id)
+	}
+	input, _ := data.Get(node.Id)
+	bytes, _ := input.([]byte)
+	partitions := node.foreach(bytes)
+	keys := make([]string, 0, len(partitions))
+	for key := range partitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	p := flow.foreachPool
+	if p == nil {
+		p = pool.NewPool[[]byte](max(min(len(keys), runtime.GOMAXPROCS(0)), 1))
+		defer p.Release()
+	}
+	futures := make([]*future.Future[[]byte], 0, len(keys))
+	for _, key := range keys {
+		run := func() ([]byte, error) {
+			output, err := flow.runPartition(ctx, p, node.subDag, partitions[key], key, data)
+			if err != nil {
+				return nil, fmt.Errorf("flow: foreach node %s partition %s: %w", node.Id, key, err)
+			}
+			return output, nil
+		}
+		f, ok := p.TrySubmit(run)
+		if !ok {
+			f = future.NewFuture[[]byte]()
+			f.Complete(run())
+		}
+		futures = append(futures, f)
+	}
+	if err := future.AwaitAll(futures...); err != nil {
+		return err
+	}
+	outputs := make([][]byte, 0, len(futures))
+	for _, f := range futures {
+		outputs = append(outputs, f.Value)
+	}
+
+	aggregated, err := aggregateForEach(node, keys, outputs)
+	if err != nil {
+		return err
+	}
+	data.Set(node.Id, aggregated)
+	return nil
+}
+
+// runPartition 以子流程执行 foreach dag，入度为0的节点以 input 作为输入，返回结束节点的输出。
+// 子流程中的 foreach 使用 foreachPool 执行分区。
+// 子流程的数据是流程数据的快照，可以读取 foreach 开始前写入的数据，并行的分区之间的写入互不影响；
+// 分区执行成功后，子流程节点写入的数据以 <key>.<子节点Id> 为前缀合并到 data（foreach 节点的命名空间），
+// 例如节点 split 的分区 a 中节点 upper 写入的 k 可以读取为 split.a.upper.k
+func (flow *Flow) runPartition(ctx context.Context, foreachPool *pool.Pool[[]byte], dag *Dag, input []byte, key string, data DataSet) ([]byte, error) {
+	end, err := dag.outputNode()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := NewFlow(dag).WithTracer(flow.tracer)
+	sub.deterministic = flow.deterministic
+	sub.foreachPool = foreachPool
+	sub.data = flow.data.Snapshot()
+	for _, node := range dag.nodes {
+		if node.indegree == 0 {
+			sub.data.Set(node.Id, input)
+		}
+	}
+	errs := &firstErrorObserver{}
+	sub.WithObserver(errs).Run(ctx)
+	// ctx 取消时 Run 不等待正在执行的节点即返回，子流程的输出不完整
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err = errs.Err(); err != nil {
+		return nil, err
+	}
+	for _, node := range dag.nodes {
+		data.Merge(sub.data.Scope(node.Id), key+"."+node.Id)
+	}
+	output, _ := sub.data.Scope(end.Id).Get(end.Id)
+	bytes, _ := output.([]byte)
+	return bytes, nil
+}
+
+// aggregateForEach 合并各分区的输出，outputs 与 keys 一一对应且按 key 排序
+func aggregateForEach(node *Node, keys []string, outputs [][]byte) ([]byte, error) {
+	if node.orderedSubAggregator != nil {
+		results := make([]ForEachResult, 0, len(keys))
+		for i, key := range keys {
+			results = append(results, ForEachResult{Key: key, Output: outputs[i]})
+		}
+		return node.orderedSubAggregator(results)
+	}
+	if node.subAggregator != nil {
+		results := make(map[string][]byte, len(keys))
+		for i, key := range keys {
+			results[key] = outputs[i]
+		}
+		return node.subAggregator(results)
+	}
+	return nil, fmt.Errorf("flow: foreach node %s has no sub aggregator", node.Id)
+}
+
+// firstErrorObserver 记录子流程中第一个失败节点的错误
+type firstErrorObserver struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (o *firstErrorObserver) OnNodeCompleted(flowID, nodeID string, err error, duration time.Duration) {
+	if err == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err == nil {
+		o.err = fmt.Errorf("node %s: %w", nodeID, err)
+	}
+}
+
+// Err 返回第一个失败节点的错误，可以与 OnNodeCompleted 并发调用
+func (o *firstErrorObserver) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
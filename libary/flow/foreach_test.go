@@ -0,0 +1,231 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/pool"
+	"github.com/stretchr/testify/assert"
+)
+
+// newForEachDag returns a dag of a single foreach node splitting into partitions c, a and b,
+// each partition upper-cases its input
+func newForEachDag(t *testing.T, partition func(ctx context.Context, data DataSet) error) (*Dag, *Node) {
+	subDag := NewDag()
+	subDag.AddVertex("upper", []Operation{}).task = &funcTask{name: "upper", run: partition}
+
+	dag := NewDag()
+	node := dag.AddVertex("split", []Operation{})
+	node.AddForEach(func(data []byte) map[string][]byte {
+		return map[string][]byte{"c": []byte("z"), "a": []byte("x"), "b": []byte("y")}
+	})
+	assert.NoError(t, node.AddForEachDag(subDag))
+	return dag, node
+}
+
+func upperPartition(ctx context.Context, data DataSet) error {
+	input, _ := data.Get("upper")
+	data.Set("upper", []byte(strings.ToUpper(string(input.([]byte)))))
+	return nil
+}
+
+func TestFlowForEachOrder(t *testing.T) {
+	is := assert.New(t)
+	dag, node := newForEachDag(t, upperPartition)
+	var keys []string
+	node.AddOrderedSubAggregator(func(results []ForEachResult) ([]byte, error) {
+		var outputs []string
+		for _, result := range results {
+			keys = append(keys, result.Key)
+			outputs = append(outputs, string(result.Output))
+		}
+		return []byte(strings.Join(outputs, ",")), nil
+	})
+
+	p := pool.NewPool[[]byte](2)
+	defer p.Release()
+	flow := NewFlow(dag).WithForEachPool(p).Run(context.Background())
+	is.Equal([]string{"a", "b", "c"}, keys)
+	output, _ := flow.data.Get("split.split")
+	is.Equal([]byte("X,Y,Z"), output)
+	is.Equal(NodeStatusDone, flow.Status("split"))
+}
+
+func TestFlowForEachMapAggregator(t *testing.T) {
+	is := assert.New(t)
+	dag, node := newForEachDag(t, upperPartition)
+	var results map[string][]byte
+	node.AddSubAggregator(func(outputs map[string][]byte) ([]byte, error) {
+		results = outputs
+		return nil, nil
+	})
+
+	// without a foreach pool a temporary pool is used
+	NewFlow(dag).Run(context.Background())
+	is.Equal(map[string][]byte{"a": []byte("X"), "b": []byte("Y"), "c": []byte("Z")}, results)
+}
+
+func TestFlowForEachDataSet(t *testing.T) {
+	is := assert.New(t)
+	dag, node := newForEachDag(t, func(ctx context.Context, data DataSet) error {
+		// every partition reads the data of the flow and writes the same keys concurrently
+		suffix, _ := data.Get("suffix")
+		input, _ := data.Get("upper")
+		data.Set("input", input)
+		data.Set("upper", []byte(strings.ToUpper(string(input.([]byte)))+suffix.(string)))
+		return nil
+	})
+	node.AddOrderedSubAggregator(func(results []ForEachResult) ([]byte, error) {
+		return nil, nil
+	})
+
+	flow := NewFlow(dag)
+	flow.data.Set("suffix", "!")
+	flow.Run(context.Background())
+	is.Equal(NodeStatusDone, flow.Status("split"))
+	for key, want := range map[string]string{"a": "x", "b": "y", "c": "z"} {
+		input, _ := flow.data.Get("split." + key + ".upper.input")
+		is.Equal([]byte(want), input)
+		output, _ := flow.data.Get("split." + key + ".upper.upper")
+		is.Equal([]byte(strings.ToUpper(want)+"!"), output)
+	}
+	// the writes of the partitions stay out of the data of the flow
+	_, ok := flow.data.Get("upper.upper")
+	is.False(ok)
+}
+
+func TestFlowForEachPartitionError(t *testing.T) {
+	is := assert.New(t)
+	errFailed := errors.New("failed")
+	dag, node := newForEachDag(t, func(ctx context.Context, data DataSet) error {
+		input, _ := data.Get("upper")
+		if string(input.([]byte)) != "x" {
+			return errFailed
+		}
+		return nil
+	})
+	node.AddOrderedSubAggregator(func(results []ForEachResult) ([]byte, error) {
+		t.Fatal("aggregator called after a partition failed")
+		return nil, nil
+	})
+
+	errs := &firstErrorObserver{}
+	NewFlow(dag).WithObserver(errs).Run(context.Background())
+	is.ErrorIs(errs.Err(), errFailed)
+	// the first failed partition in key order
+	is.Contains(errs.Err().Error(), "partition b")
+}
+
+func TestFlowForEachCancel(t *testing.T) {
+	is := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dag, node := newForEachDag(t, func(ctx context.Context, data DataSet) error {
+		cancel()
+		return upperPartition(ctx, data)
+	})
+	var aggregated atomic.Bool
+	node.AddOrderedSubAggregator(func(results []ForEachResult) ([]byte, error) {
+		aggregated.Store(true)
+		return nil, nil
+	})
+
+	// a cancelled partition fails the foreach node instead of aggregating the partial outputs
+	errs := &firstErrorObserver{}
+	flow := NewFlow(dag).WithObserver(errs)
+	flow.Run(ctx)
+	is.Eventually(func() bool {
+		return flow.Status("split") == NodeStatusFailed
+	}, time.Second, time.Millisecond)
+	is.ErrorIs(errs.Err(), context.Canceled)
+	is.False(aggregated.Load())
+}
+
+// newFanOutDag returns a dag of a single foreach node id splitting its input into n partitions run by sub,
+// the outputs of the partitions are concatenated in key order
+func newFanOutDag(t *testing.T, id string, n int, sub *Dag) *Dag {
+	dag := NewDag()
+	node := dag.AddVertex(id, []Operation{})
+	node.AddForEach(func(data []byte) map[string][]byte {
+		partitions := make(map[string][]byte, n)
+		for i := 0; i < n; i++ {
+			partitions[fmt.Sprintf("%02d", i)] = []byte("x")
+		}
+		return partitions
+	})
+	node.AddOrderedSubAggregator(func(results []ForEachResult) ([]byte, error) {
+		var output []byte
+		for _, result := range results {
+			output = append(output, result.Output...)
+		}
+		return output, nil
+	})
+	assert.NoError(t, node.AddForEachDag(sub))
+	return dag
+}
+
+// newLeafDag returns a dag of a single task recording the number of partitions running at the same time
+func newLeafDag(running, maxRunning *int32) *Dag {
+	dag := NewDag()
+	dag.AddVertex("leaf", []Operation{}).task = &funcTask{name: "leaf", run: func(ctx context.Context, data DataSet) error {
+		n := atomic.AddInt32(running, 1)
+		defer atomic.AddInt32(running, -1)
+		for {
+			cur := atomic.LoadInt32(maxRunning)
+			if n <= cur || atomic.CompareAndSwapInt32(maxRunning, cur, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		input, _ := data.Get("leaf")
+		data.Set("leaf", []byte(strings.ToUpper(string(input.([]byte)))))
+		return nil
+	}}
+	return dag
+}
+
+func TestFlowForEachDefaultPoolBounded(t *testing.T) {
+	is := assert.New(t)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	var running, maxRunning int32
+	dag := newFanOutDag(t, "split", 32, newLeafDag(&running, &maxRunning))
+
+	flow := NewFlow(dag).Run(context.Background())
+	is.Equal(NodeStatusDone, flow.Status("split"))
+	output, _ := flow.data.Get("split.split")
+	is.Equal([]byte(strings.Repeat("X", 32)), output)
+	// two workers of the temporary pool, plus the node running a partition when both are busy
+	is.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(3))
+}
+
+func TestFlowForEachNestedPool(t *testing.T) {
+	is := assert.New(t)
+	var running, maxRunning int32
+	inner := newFanOutDag(t, "inner", 3, newLeafDag(&running, &maxRunning))
+	dag := newFanOutDag(t, "outer", 4, inner)
+
+	// the outer partitions occupy both workers, the inner partitions run on them instead of waiting
+	p := pool.NewPool[[]byte](2)
+	defer p.Release()
+	flow := NewFlow(dag).WithForEachPool(p)
+	finished := make(chan struct{})
+	go func() {
+		flow.Run(context.Background())
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested foreach deadlocked on the shared pool")
+	}
+	is.Equal(NodeStatusDone, flow.Status("outer"))
+	output, _ := flow.data.Get("outer.outer")
+	is.Equal([]byte(strings.Repeat("X", 12)), output)
+	is.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(3))
+}
@@ -23,12 +23,14 @@ type Node struct {
 	conditionalDags map[string]*Dag // Conditional subdags
 	operations      []Operation     // The list of operations
 
-	dynamic       bool                 // Denotes if the node is dynamic
-	aggregator    Aggregator           // The aggregator aggregates multiple inputs to a node into one
-	foreach       ForEach              // If specified foreach allows to execute the vertex in parallel
-	condition     Condition            // If specified condition allows to execute only selected sub-flow
-	subAggregator Aggregator           // Aggregates foreach/condition outputs into one
-	forwarder     map[string]Forwarder // The forwarder handle forwarding output to a children
+	dynamic              bool                         // Denotes if the node is dynamic
+	aggregator           Aggregator                   // The aggregator aggregates multiple inputs to a node into one
+	foreach              ForEach                      // If specified foreach allows to execute the vertex in parallel
+	condition            Condition                    // If specified condition allows to execute only selected sub-flow
+	subAggregator        Aggregator                   // Aggregates foreach/condition outputs into one
+	orderedSubAggregator OrderedAggregator            // Aggregates foreach outputs into one in the sorted order of the keys
+	forwarder            map[string]Forwarder         // The forwarder handle forwarding output to a children
+	predicates           map[string]func([]byte) bool // The predicates selecting at runtime which children are forwarded to
 
 	task            Task
 	parentDag       *Dag    // The reference of the flow this node part of
@@ -40,6 +42,9 @@ type Node struct {
 
 	next []*Node
 	prev []*Node
+
+	concurrencyGroup string // The concurrency group the node runs in
+	concurrencyMax   int    // The max number of nodes of the group running at once
 }
 
 // inSlice check if a node belongs in a slice
@@ -97,6 +102,29 @@ func (node *Node) ParentDag() *Dag {
 	return node.parentDag
 }
 
+// SetTask sets the task executed by the flow executor for the node,
+// the operations of the node are executed instead when no task is set
+func (node *Node) SetTask(task Task) {
+	node.task = task
+}
+
+// Task returns the task of the node
+func (node *Node) Task() Task {
+	return node.task
+}
+
+// Execute executes the operations of the node in order, piping the output of an operation
+// to the input of the next one
+func (node *Node) Execute(data []byte) ([]byte, error) {
+	return ExecuteOperations(node.operations, data, nil)
+}
+
+// ExecuteWithData executes the operations of the node like Execute,
+// DataSetOperation are executed with ds
+func (node *Node) ExecuteWithData(data []byte, ds DataSet) ([]byte, error) {
+	return ExecuteOperationsWithData(node.operations, data, nil, ds)
+}
+
 // AddOperation adds an operation
 func (node *Node) AddOperation(operation Operation) {
 	node.operations = append(node.operations, operation)
@@ -126,6 +154,12 @@ func (node *Node) AddSubAggregator(aggregator Aggregator) {
 	node.subAggregator = aggregator
 }
 
+// AddOrderedSubAggregator add a foreach aggregator receiving the outputs in the sorted order of the
+// partition keys, it is used instead of the sub aggregator when both are set
+func (node *Node) AddOrderedSubAggregator(aggregator OrderedAggregator) {
+	node.orderedSubAggregator = aggregator
+}
+
 // AddForwarder adds a forwarder for a specific children
 func (node *Node) AddForwarder(children string, forwarder Forwarder) {
 	node.forwarder[children] = forwarder
@@ -140,6 +174,33 @@ func (node *Node) AddForwarder(children string, forwarder Forwarder) {
 	}
 }
 
+// AddConditionalForwarder adds a forwarder for a specific children that is only used when predicate
+// returns true for the output of the node. The flow executor evaluates predicate once the node is done:
+// when it returns true the forwarded output becomes the input of the children, when it returns false
+// nothing is forwarded and a children without any other forwarded parent is skipped along with its descendants
+func (node *Node) AddConditionalForwarder(children string, predicate func([]byte) bool, forwarder Forwarder) {
+	if node.predicates == nil {
+		node.predicates = make(map[string]func([]byte) bool)
+	}
+	node.predicates[children] = predicate
+	node.AddForwarder(children, forwarder)
+}
+
+// GetPredicate gets the predicate of the conditional forwarder for a children
+func (node *Node) GetPredicate(children string) func([]byte) bool {
+	return node.predicates[children]
+}
+
+// SetConcurrencyGroup limits the nodes of the group named name to run at most max at once
+// Nodes of the same group should use the same max, the smallest one is applied otherwise
+func (node *Node) SetConcurrencyGroup(name string, max int) {
+	if max <= 0 {
+		max = 1
+	}
+	node.concurrencyGroup = name
+	node.concurrencyMax = max
+}
+
 // AddSubDag adds a subdag to the node
 func (node *Node) AddSubDag(subDag *Dag) error {
 	parentDag := node.parentDag
@@ -208,6 +269,11 @@ func (node *Node) GetSubAggregator() Aggregator {
 	return node.subAggregator
 }
 
+// GetOrderedSubAggregator gets the ordered subaggregator for foreach
+func (node *Node) GetOrderedSubAggregator() OrderedAggregator {
+	return node.orderedSubAggregator
+}
+
 // GetCondition get the condition function
 func (node *Node) GetCondition() Condition {
 	return node.condition
@@ -1,13 +1,63 @@
 package flow
 
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/log"
+)
+
+// Operation is a unit of work of a node, the operations of a node are executed in order
+// with the output of an operation being the input of the next one
 type Operation interface {
+	// GetId returns the name of the operation, used when exporting the definition
 	GetId() string
+	// Encode returns the serialized form of the operation
 	Encode() []byte
+	// GetProperties returns the properties of the operation, used when exporting the definition
 	GetProperties() map[string][]string
 	// Execute executes an operation, executor can pass configuration
 	Execute([]byte, map[string]interface{}) ([]byte, error)
 }
 
+// DataSetOperation is an operation reading or writing the flow state besides the piped bytes,
+// the executor calls ExecuteWithData instead of Execute with the DataSet of the node,
+// so values written by key can be read by the downstream nodes
+type DataSetOperation interface {
+	Operation
+	// ExecuteWithData executes an operation with the DataSet of the node
+	ExecuteWithData(data []byte, ds DataSet) ([]byte, error)
+}
+
+// ExecuteOperations executes the operations in order, passing the output of an operation
+// to the next one, and stops at the first error
+func ExecuteOperations(operations []Operation, data []byte, option map[string]interface{}) ([]byte, error) {
+	return ExecuteOperationsWithData(operations, data, option, nil)
+}
+
+// ExecuteOperationsWithData executes the operations like ExecuteOperations,
+// a DataSetOperation is executed with ds when ds is not nil
+func ExecuteOperationsWithData(operations []Operation, data []byte, option map[string]interface{}, ds DataSet) ([]byte, error) {
+	var err error
+	for _, operation := range operations {
+		data, err = executeOperation(operation, data, option, ds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func executeOperation(operation Operation, data []byte, option map[string]interface{}, ds DataSet) ([]byte, error) {
+	if dsOperation, ok := operation.(DataSetOperation); ok && ds != nil {
+		return dsOperation.ExecuteWithData(data, ds)
+	}
+	return operation.Execute(data, option)
+}
+
 type BlankOperation struct {
 }
 
@@ -26,3 +76,215 @@ func (ops *BlankOperation) GetProperties() map[string][]string {
 func (ops *BlankOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
 	return data, nil
 }
+
+// FuncOperation returns an operation executing fn
+func FuncOperation(fn func([]byte) ([]byte, error)) Operation {
+	return &funcOperation{fn: fn}
+}
+
+type funcOperation struct {
+	fn func([]byte) ([]byte, error)
+}
+
+func (ops *funcOperation) GetId() string {
+	return "func"
+}
+
+func (ops *funcOperation) Encode() []byte {
+	return []byte("")
+}
+
+func (ops *funcOperation) GetProperties() map[string][]string {
+	return make(map[string][]string)
+}
+
+func (ops *funcOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+	return ops.fn(data)
+}
+
+// DataSetFuncOperation returns a DataSetOperation executing fn,
+// fn gets an empty DataSet when the operation is executed without one
+func DataSetFuncOperation(fn func([]byte, DataSet) ([]byte, error)) Operation {
+	return &dataSetFuncOperation{fn: fn}
+}
+
+type dataSetFuncOperation struct {
+	fn func([]byte, DataSet) ([]byte, error)
+}
+
+func (ops *dataSetFuncOperation) GetId() string {
+	return "func"
+}
+
+func (ops *dataSetFuncOperation) Encode() []byte {
+	return []byte("")
+}
+
+func (ops *dataSetFuncOperation) GetProperties() map[string][]string {
+	return make(map[string][]string)
+}
+
+func (ops *dataSetFuncOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+	return ops.fn(data, NewDataSet())
+}
+
+func (ops *dataSetFuncOperation) ExecuteWithData(data []byte, ds DataSet) ([]byte, error) {
+	return ops.fn(data, ds)
+}
+
+// LogOperation returns an operation logging its input at debug level and passing it through unchanged
+func LogOperation(logger log.Logger) Operation {
+	if logger == nil {
+		logger = log.NopLogger
+	}
+	return &logOperation{logger: logger}
+}
+
+type logOperation struct {
+	logger log.Logger
+}
+
+func (ops *logOperation) GetId() string {
+	return "log"
+}
+
+func (ops *logOperation) Encode() []byte {
+	return []byte("")
+}
+
+func (ops *logOperation) GetProperties() map[string][]string {
+	return make(map[string][]string)
+}
+
+func (ops *logOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+	ops.logger.Debugf("flow: operation input %q, option %v", data, option)
+	return data, nil
+}
+
+// RetryOperation returns an operation executing op up to attempts times until it succeeds,
+// the error of the last attempt is returned if all attempts fail
+func RetryOperation(op Operation, attempts int) Operation {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &retryOperation{op: op, attempts: attempts}
+}
+
+type retryOperation struct {
+	op       Operation
+	attempts int
+}
+
+func (ops *retryOperation) GetId() string {
+	return ops.op.GetId()
+}
+
+func (ops *retryOperation) Encode() []byte {
+	return ops.op.Encode()
+}
+
+// GetProperties returns the properties of the wrapped operation with the attempts added
+func (ops *retryOperation) GetProperties() map[string][]string {
+	properties := make(map[string][]string)
+	for key, value := range ops.op.GetProperties() {
+		properties[key] = value
+	}
+	properties["attempts"] = []string{strconv.Itoa(ops.attempts)}
+	return properties
+}
+
+func (ops *retryOperation) Execute(data []byte, option map[string]interface{}) (result []byte, err error) {
+	return ops.execute(data, option, nil)
+}
+
+// ExecuteWithData passes ds to the wrapped operation if it is a DataSetOperation
+func (ops *retryOperation) ExecuteWithData(data []byte, ds DataSet) ([]byte, error) {
+	return ops.execute(data, nil, ds)
+}
+
+func (ops *retryOperation) execute(data []byte, option map[string]interface{}, ds DataSet) (result []byte, err error) {
+	for i := 0; i < ops.attempts; i++ {
+		if result, err = executeOperation(ops.op, data, option, ds); err == nil {
+			return result, nil
+		}
+	}
+	return nil, err
+}
+
+// OperationCache is the cache used by CachedOperation, redis.Cache satisfies it
+type OperationCache interface {
+	// Get reads the value of key into dst, reporting whether the key exists
+	Get(ctx context.Context, key string, dst interface{}) (bool, error)
+	// Set stores val with the default expiration of the cache
+	Set(ctx context.Context, key string, val interface{}) error
+	// SetNX stores val for ttl if key does not exist
+	SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error)
+}
+
+// CachedOperation returns an operation memoizing the output of op in the cache, keyed by keyFn(input).
+// On a hit op is not executed, on a miss the output of op is stored for ttl, the expiration of the cache is used
+// if ttl is not positive. keyFn defaults to the id of op with the SHA1 of the input.
+// op must be deterministic, its output depending only on the input. Errors of the cache are ignored,
+// op is executed as if the cache missed
+func CachedOperation(op Operation, cache OperationCache, keyFn func([]byte) string, ttl time.Duration) Operation {
+	if keyFn == nil {
+		keyFn = func(data []byte) string {
+			sum := sha1.Sum(data)
+			return "flow:operation:" + op.GetId() + ":" + hex.EncodeToString(sum[:])
+		}
+	}
+	return &cachedOperation{op: op, cache: cache, keyFn: keyFn, ttl: ttl}
+}
+
+type cachedOperation struct {
+	op    Operation
+	cache OperationCache
+	keyFn func([]byte) string
+	ttl   time.Duration
+}
+
+func (ops *cachedOperation) GetId() string {
+	return ops.op.GetId()
+}
+
+func (ops *cachedOperation) Encode() []byte {
+	return ops.op.Encode()
+}
+
+// GetProperties returns the properties of the wrapped operation with the ttl added
+func (ops *cachedOperation) GetProperties() map[string][]string {
+	properties := make(map[string][]string)
+	for key, value := range ops.op.GetProperties() {
+		properties[key] = value
+	}
+	properties["ttl"] = []string{ops.ttl.String()}
+	return properties
+}
+
+func (ops *cachedOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+	return ops.execute(data, option, nil)
+}
+
+// ExecuteWithData passes ds to the wrapped operation if it is a DataSetOperation
+func (ops *cachedOperation) ExecuteWithData(data []byte, ds DataSet) ([]byte, error) {
+	return ops.execute(data, nil, ds)
+}
+
+func (ops *cachedOperation) execute(data []byte, option map[string]interface{}, ds DataSet) ([]byte, error) {
+	ctx := context.Background()
+	key := ops.keyFn(data)
+	var cached []byte
+	if ok, err := ops.cache.Get(ctx, key, &cached); err == nil && ok {
+		return cached, nil
+	}
+	result, err := executeOperation(ops.op, data, option, ds)
+	if err != nil {
+		return nil, err
+	}
+	if ops.ttl > 0 {
+		_, _ = ops.cache.SetNX(ctx, key, result, ops.ttl)
+	} else {
+		_ = ops.cache.Set(ctx, key, result)
+	}
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncOperations(t *testing.T) {
+	is := assert.New(t)
+
+	calls := 0
+	flaky := FuncOperation(func(data []byte) ([]byte, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("unavailable")
+		}
+		return append(data, '!'), nil
+	})
+
+	dag := NewDag()
+	node := dag.AddVertex("n", []Operation{
+		FuncOperation(func(data []byte) ([]byte, error) { return bytes.ToUpper(data), nil }),
+		LogOperation(nil),
+	})
+	node.AddOperation(RetryOperation(flaky, 3))
+	node.AddOperation(FuncOperation(func(data []byte) ([]byte, error) { return append(data, '?'), nil }))
+
+	result, err := ExecuteOperations(node.Operations(), []byte("hello"), nil)
+	is.NoError(err)
+	is.Equal("HELLO!?", string(result))
+	is.Equal(3, calls)
+	is.Equal([]string{"3"}, node.Operations()[2].GetProperties()["attempts"])
+
+	// the error of the last attempt is returned once the attempts are exhausted
+	calls = 0
+	_, err = ExecuteOperations([]Operation{RetryOperation(flaky, 2)}, []byte("hello"), nil)
+	is.EqualError(err, "unavailable")
+	is.Equal(2, calls)
+}
+
+func TestNodeExecuteOperations(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	node := dag.AddVertex("n", []Operation{&BlankOperation{}})
+	node.AddOperation(FuncOperation(func(data []byte) ([]byte, error) { return append(data, 'b'), nil }))
+	node.AddOperation(FuncOperation(func(data []byte) ([]byte, error) { return append(data, 'c'), nil }))
+
+	result, err := node.Execute([]byte("a"))
+	is.NoError(err)
+	is.Equal("abc", string(result))
+
+	// the flow executes the operations of a node without task
+	flow := NewFlow(dag)
+	flow.data.Set("n", []byte("a"))
+	output := flow.OutputChannel()
+	flow.Run(context.Background())
+	out := (<-output.Output()).(NodeOutput)
+	is.NoError(out.Err)
+	is.Equal("abc", string(out.Data.([]byte)))
+}
+
+func TestDataSetOperation(t *testing.T) {
+	is := assert.New(t)
+
+	dag := NewDag()
+	is.NoError(dag.AddEdge("parse", "report"))
+	dag.GetNode("parse").AddOperation(DataSetFuncOperation(func(data []byte, ds DataSet) ([]byte, error) {
+		ds.Set("count", len(data))
+		return data, nil
+	}))
+	// a retried operation still gets the DataSet
+	dag.GetNode("report").AddOperation(RetryOperation(DataSetFuncOperation(func(data []byte, ds DataSet) ([]byte, error) {
+		count, ok := ds.Get("parse.count")
+		if !ok {
+			return nil, errors.New("count not found")
+		}
+		return []byte(fmt.Sprintf("count=%d", count)), nil
+	}), 2))
+
+	flow := NewFlow(dag)
+	flow.data.Set("parse", []byte("hello"))
+	result, err := flow.RunAndWait(context.Background())
+	is.NoError(err)
+	is.Equal("count=5", string(result.Output))
+
+	// without a DataSet the operation gets an empty one
+	_, err = dag.GetNode("report").Execute(nil)
+	is.EqualError(err, "count not found")
+}
+
+// memoryCache is an OperationCache storing []byte values in memory
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string, dst interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	if ok {
+		*dst.(*[]byte) = value
+	}
+	return ok, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, val interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = val.([]byte)
+	return nil
+}
+
+func (c *memoryCache) SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+	c.values[key] = val.([]byte)
+	c.ttls[key] = ttl
+	return true, nil
+}
+
+func TestCachedOperation(t *testing.T) {
+	is := assert.New(t)
+	cache := newMemoryCache()
+
+	calls := 0
+	upper := FuncOperation(func(data []byte) ([]byte, error) {
+		calls++
+		return bytes.ToUpper(data), nil
+	})
+	op := CachedOperation(upper, cache, func(data []byte) string { return "upper:" + string(data) }, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		result, err := op.Execute([]byte("abc"), nil)
+		is.NoError(err)
+		is.Equal("ABC", string(result))
+	}
+	is.Equal(1, calls)
+	is.Equal([]byte("ABC"), cache.values["upper:abc"])
+	is.Equal(time.Minute, cache.ttls["upper:abc"])
+
+	// a different input misses the cache
+	result, err := op.Execute([]byte("xyz"), nil)
+	is.NoError(err)
+	is.Equal("XYZ", string(result))
+	is.Equal(2, calls)
+
+	// errors are not cached
+	failing := CachedOperation(FuncOperation(func(data []byte) ([]byte, error) {
+		calls++
+		return nil, errors.New("unavailable")
+	}), cache, nil, 0)
+	for i := 0; i < 2; i++ {
+		_, err = failing.Execute([]byte("abc"), nil)
+		is.Error(err)
+	}
+	is.Equal(4, calls)
+
+	// the node executes the cached operation across flow runs
+	dag := NewDag()
+	dag.AddVertex("n", []Operation{op})
+	for i := 0; i < 2; i++ {
+		flow := NewFlow(dag)
+		flow.data.Set("n", []byte("abc"))
+		out, err := flow.RunAndWait(context.Background())
+		is.NoError(err)
+		is.Equal("ABC", string(out.Output))
+	}
+	is.Equal(4, calls)
+}
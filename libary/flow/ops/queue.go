@@ -0,0 +1,40 @@
+// Package ops provides flow operations backed by external systems, kept out of the flow package
+// so that using flow does not pull in the clients of those systems.
+package ops
+
+import (
+	"fmt"
+
+	"github.com/longpi1/gopkg/libary/flow"
+	"github.com/longpi1/gopkg/libary/queue"
+)
+
+// QueueOperation returns an operation publishing its input to the topic with producer
+// and passing the input through unchanged, the operation fails if the message can't be sent
+func QueueOperation(producer queue.Producer, topic string) flow.Operation {
+	return &queueOperation{producer: producer, topic: topic}
+}
+
+type queueOperation struct {
+	producer queue.Producer
+	topic    string
+}
+
+func (ops *queueOperation) GetId() string {
+	return "queue"
+}
+
+func (ops *queueOperation) Encode() []byte {
+	return []byte("")
+}
+
+func (ops *queueOperation) GetProperties() map[string][]string {
+	return map[string][]string{"topic": {ops.topic}}
+}
+
+func (ops *queueOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+	if _, err := ops.producer.SendByteMsg(ops.topic, data); err != nil {
+		return nil, fmt.Errorf("flow: publish to topic %s: %w", ops.topic, err)
+	}
+	return data, nil
+}
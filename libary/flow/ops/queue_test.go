@@ -0,0 +1,68 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/longpi1/gopkg/libary/flow"
+	"github.com/longpi1/gopkg/libary/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordProducer records the messages sent with SendByteMsg
+type recordProducer struct {
+	queue.Producer // other methods are not used
+	err            error
+	sent           []queue.Msg
+}
+
+func (p *recordProducer) SendByteMsg(topic string, body []byte) (queue.Msg, error) {
+	if p.err != nil {
+		return queue.Msg{}, p.err
+	}
+	msg := queue.NewMsg(topic, body, nil)
+	p.sent = append(p.sent, msg)
+	return msg, nil
+}
+
+// sourceTask writes its data as the output of the node
+type sourceTask struct {
+	id   string
+	data []byte
+}
+
+func (task *sourceTask) NodeName() string {
+	return task.id
+}
+
+func (task *sourceTask) Run(ctx context.Context, data flow.DataSet) error {
+	data.Set(task.id, task.data)
+	return nil
+}
+
+func TestQueueOperation(t *testing.T) {
+	is := assert.New(t)
+	producer := &recordProducer{}
+
+	dag := flow.NewDag()
+	is.NoError(dag.AddEdge("source", "emit"))
+	dag.GetNode("source").SetTask(&sourceTask{id: "source", data: []byte("created")})
+	emit := dag.GetNode("emit")
+	emit.AddOperation(flow.FuncOperation(func(data []byte) ([]byte, error) { return bytes.ToUpper(data), nil }))
+	emit.AddOperation(QueueOperation(producer, "events"))
+
+	result, err := flow.NewFlow(dag).RunAndWait(context.Background())
+	is.NoError(err)
+	is.Len(producer.sent, 1)
+	is.Equal("events", producer.sent[0].Topic)
+	is.Equal([]byte("CREATED"), producer.sent[0].Body)
+	// the output passes through unchanged
+	is.Equal([]byte("CREATED"), result.Output)
+	is.Equal(map[string][]string{"topic": {"events"}}, QueueOperation(producer, "events").GetProperties())
+
+	errBroker := errors.New("broker unavailable")
+	_, err = QueueOperation(&recordProducer{err: errBroker}, "events").Execute([]byte("x"), nil)
+	is.ErrorIs(err, errBroker)
+}
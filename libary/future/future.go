@@ -75,6 +75,14 @@ func (future *Future[T]) GetErr() error {
 	return future.Err
 }
 
+// Complete 设置异步任务的结果和错误并标记任务完成，用于基于回调的异步接口。
+// 每个Future只能完成一次，重复调用会panic。
+func (future *Future[T]) Complete(value T, err error) {
+	future.Value, future.Err = value, err
+	close(future.Ch)        // 关闭通道，表示任务完成
+	future.done.Store(true) // 标记任务已完成
+}
+
 // Inner 返回一个只读通道，当异步任务完成时该通道会关闭。
 // 如果需要在select语句中等待异步任务，可以使用这个通道。
 func (future *Future[T]) Inner() <-chan struct{} {
@@ -87,9 +95,7 @@ func (future *Future[T]) Inner() <-chan struct{} {
 func Go[T any](fn func() (T, error)) *Future[T] {
 	future := NewFuture[T]()
 	go func() {
-		future.Value, future.Err = fn() // 执行函数并保存结果
-		close(future.Ch)                // 关闭通道，表示任务完成
-		future.done.Store(true)         // 标记任务已完成
+		future.Complete(fn()) // 执行函数并保存结果
 	}()
 	return future
 }
@@ -20,6 +20,8 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync/atomic"
+
+	"github.com/longpi1/gopkg/libary/log"
 )
 
 // 设定GC百分比的最大值和最小值
@@ -42,10 +44,23 @@ func init() {
 	defaultGCPercent = uint32(gogc) // 设置默认GC百分比
 }
 
+// Option 调优器的选项
+type Option func(t *tuner)
+
+// WithLogger 设置调优器的日志，GC百分比发生变化时输出日志，默认不输出日志
+func WithLogger(logger log.Logger) Option {
+	return func(t *tuner) {
+		if logger != nil {
+			t.logger.Store(loggerHolder{logger})
+		}
+	}
+}
+
 // Tuning Tuning函数用于设置GC调优器的阈值
 // 当设置阈值时，环境变量GOGC将不再生效
 // threshold: 如果threshold为0，则禁用调优功能
-func Tuning(threshold uint64) {
+// opts: 调优器的选项，调优器已存在时应用到已有的调优器上
+func Tuning(threshold uint64, opts ...Option) {
 	// 如果阈值为0且当前有调优器，则停止调优并清空全局调优器
 	if threshold <= 0 && globalTuner != nil {
 		globalTuner.stop()
@@ -55,13 +70,38 @@ func Tuning(threshold uint64) {
 
 	// 如果当前没有调优器，则创建一个新的调优器
 	if globalTuner == nil {
-		globalTuner = newTuner(threshold)
+		globalTuner = newTuner(threshold, opts...)
 		return
 	}
 	// 否则，设置新的阈值
+	for _, opt := range opts {
+		opt(globalTuner)
+	}
 	globalTuner.setThreshold(threshold)
 }
 
+// TuningWithMemoryLimit 与 Tuning 相同，同时通过 debug.SetMemoryLimit 设置运行时的软内存限制（GOMEMLIMIT）。
+// 两者的配合：调优器按 threshold 动态调整GC百分比，内存远低于 threshold 时减少GC次数；
+// 软内存限制是运行时自身的兜底，堆接近 softLimit 时无论GC百分比多大运行时都会主动GC。
+// 因此 softLimit 应大于 threshold，例如 threshold 为内存限制的70%，softLimit 为90%；
+// softLimit 小于 threshold 时运行时会在调优器生效前频繁GC，动态调整的GC百分比不再起作用。
+// softLimit 为0时不修改内存限制。停止调优（threshold 为0）时恢复为调用前的内存限制
+func TuningWithMemoryLimit(threshold, softLimit uint64, opts ...Option) {
+	if threshold > 0 {
+		opts = append(opts, withMemoryLimit(softLimit))
+	}
+	Tuning(threshold, opts...)
+}
+
+// withMemoryLimit 设置运行时的软内存限制，limit 为0时不修改
+func withMemoryLimit(limit uint64) Option {
+	return func(t *tuner) {
+		if limit > 0 {
+			t.setMemoryLimit(limit)
+		}
+	}
+}
+
 // GetGCPercent 返回当前的GC百分比
 func GetGCPercent() uint32 {
 	if globalTuner == nil {
@@ -111,9 +151,20 @@ Go运行时仅在达到gc_trigger时触发GC，gc_trigger由GCPercent和heap_liv
 因此我们可以动态调整GCPercent来优化GC性能。
 */
 type tuner struct {
-	finalizer *finalizer // 调优器的finalizer
-	gcPercent uint32     // 当前的GC百分比
-	threshold uint64     // 高水位线，单位为字节
+	finalizer *finalizer   // 调优器的finalizer
+	gcPercent uint32       // 当前的GC百分比
+	threshold uint64       // 高水位线，单位为字节
+	logger    atomic.Value // 存储 loggerHolder，GC百分比变化时输出日志
+
+	originalGCPercent int // 创建调优器时运行时的GC百分比，停止时恢复
+
+	memoryLimitSet      bool  // 是否设置过软内存限制
+	originalMemoryLimit int64 // 第一次设置软内存限制前运行时的内存限制，停止时恢复
+}
+
+// loggerHolder 保证 atomic.Value 中存储的类型一致
+type loggerHolder struct {
+	log.Logger
 }
 
 // tuning函数根据内存使用情况动态调整GC百分比
@@ -163,21 +214,53 @@ func calcGCPercent(inuse, threshold uint64) uint32 {
 // newTuner 创建一个新的tuner实例，并启动调节器
 // 参数:
 //   - threshold: 初始的内存阈值
+//   - opts: 调优器的选项
 //
 // 返回值:
 //   - 指向新创建的tuner实例的指针
-func newTuner(threshold uint64) *tuner {
+func newTuner(threshold uint64, opts ...Option) *tuner {
 	t := &tuner{
-		gcPercent: defaultGCPercent, // 初始的GC百分比为默认值
-		threshold: threshold,        // 设置初始阈值
+		gcPercent:         defaultGCPercent, // 初始的GC百分比为默认值
+		threshold:         threshold,        // 设置初始阈值
+		originalGCPercent: readGCPercent(),  // 记录调优前的GC百分比
+	}
+	t.logger.Store(loggerHolder{log.NopLogger}) // 默认不输出日志
+	for _, opt := range opts {
+		opt(t)
 	}
 	t.finalizer = newFinalizer(t.tuning) // 启动调节器，开始自动调节GC
 	return t
 }
 
-// stop 停止tuner的调节器
+// stop 停止tuner的调节器，并将运行时的GC百分比恢复为创建调优器时的值
 func (t *tuner) stop() {
 	t.finalizer.stop()
+	debug.SetGCPercent(t.originalGCPercent)
+	t.getLogger().Debugf("gctuner: stopped, gc percent restored to %d", t.originalGCPercent)
+	if t.memoryLimitSet {
+		debug.SetMemoryLimit(t.originalMemoryLimit)
+		t.getLogger().Debugf("gctuner: memory limit restored to %d", t.originalMemoryLimit)
+	}
+}
+
+// setMemoryLimit 设置运行时的软内存限制，第一次设置时记录原来的内存限制
+func (t *tuner) setMemoryLimit(limit uint64) {
+	if limit > math.MaxInt64 {
+		limit = math.MaxInt64
+	}
+	old := debug.SetMemoryLimit(int64(limit))
+	if !t.memoryLimitSet {
+		t.memoryLimitSet = true
+		t.originalMemoryLimit = old
+	}
+	t.getLogger().Debugf("gctuner: memory limit changed from %d to %d", old, limit)
+}
+
+// readGCPercent 读取运行时当前的GC百分比
+func readGCPercent() int {
+	percent := debug.SetGCPercent(-1)
+	debug.SetGCPercent(percent)
+	return percent
 }
 
 // setThreshold 更新内存阈值
@@ -201,10 +284,17 @@ func (t *tuner) getThreshold() uint64 {
 // 返回值:
 //   - 设置前的GC百分比
 func (t *tuner) setGCPercent(percent uint32) uint32 {
-	atomic.StoreUint32(&t.gcPercent, percent)
+	if old := atomic.SwapUint32(&t.gcPercent, percent); old != percent {
+		t.getLogger().Debugf("gctuner: gc percent changed from %d to %d", old, percent)
+	}
 	return uint32(debug.SetGCPercent(int(percent)))
 }
 
+// getLogger 获取调优器的日志
+func (t *tuner) getLogger() log.Logger {
+	return t.logger.Load().(loggerHolder).Logger
+}
+
 // getGCPercent 获取当前的GC百分比
 // 返回值:
 //   - 当前的GC百分比
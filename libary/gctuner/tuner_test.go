@@ -15,7 +15,10 @@
 package gctuner
 
 import (
+	"fmt"
 	"runtime"
+	"runtime/debug"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -124,3 +127,81 @@ func TestCalcGCPercent(t *testing.T) {
 	is.Equal(minGCPercent, calcGCPercent(4*gb, 4*gb))
 	is.Equal(minGCPercent, calcGCPercent(5*gb, 4*gb))
 }
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) { l.record("debug", format, args...) }
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) { l.record("warn", format, args...) }
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) { l.record("error", format, args...) }
+
+func (l *recordLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestTunerWithLogger(t *testing.T) {
+	is := assert.New(t)
+	logger := &recordLogger{}
+	// a threshold of 0 disables the tuning callback, so only the explicit calls below change the percent
+	tn := newTuner(0, WithLogger(logger))
+	defer tn.stop()
+
+	old := tn.setGCPercent(defaultGCPercent + 10)
+	defer debug.SetGCPercent(int(old))
+	tn.setGCPercent(defaultGCPercent + 10)
+
+	is.Equal([]string{
+		fmt.Sprintf("debug gctuner: gc percent changed from %d to %d", defaultGCPercent, defaultGCPercent+10),
+	}, logger.Lines())
+}
+
+func TestTunerStopRestoresGCPercent(t *testing.T) {
+	is := assert.New(t)
+	original := readGCPercent()
+
+	tn := newTuner(0)
+	tn.setGCPercent(minGCPercent)
+	is.Equal(int(minGCPercent), readGCPercent())
+
+	tn.stop()
+	is.Equal(original, readGCPercent())
+}
+
+func TestTuningWithMemoryLimit(t *testing.T) {
+	is := assert.New(t)
+	const mb = 1024 * 1024
+	original := debug.SetMemoryLimit(-1)
+	originalGCPercent := readGCPercent()
+
+	TuningWithMemoryLimit(512*mb, 768*mb)
+	is.Equal(int64(768*mb), debug.SetMemoryLimit(-1))
+	// updating the tuner keeps the limit from before the first call for the restore
+	TuningWithMemoryLimit(512*mb, 640*mb)
+	is.Equal(int64(640*mb), debug.SetMemoryLimit(-1))
+	// a soft limit of 0 leaves the memory limit untouched
+	TuningWithMemoryLimit(512*mb, 0)
+	is.Equal(int64(640*mb), debug.SetMemoryLimit(-1))
+
+	Tuning(0)
+	is.Nil(globalTuner)
+	is.Equal(original, debug.SetMemoryLimit(-1))
+	is.Equal(originalGCPercent, readGCPercent())
+
+	// without a soft limit the memory limit is never changed
+	TuningWithMemoryLimit(512*mb, 0)
+	TuningWithMemoryLimit(0, 0)
+	is.Nil(globalTuner)
+	is.Equal(original, debug.SetMemoryLimit(-1))
+}
@@ -0,0 +1,45 @@
+package generic
+
+import "sync/atomic"
+
+// Counter 是基于 sync/atomic 的单调递增计数器，用于统计次数类指标，并发安全，零值可直接使用。
+// 不可复制，需要以指针或嵌入结构体的方式使用
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc 计数加1，返回加1后的值
+func (c *Counter) Inc() uint64 {
+	return c.v.Add(1)
+}
+
+// Add 计数加 n，返回相加后的值
+func (c *Counter) Add(n uint64) uint64 {
+	return c.v.Add(n)
+}
+
+// Load 返回当前计数
+func (c *Counter) Load() uint64 {
+	return c.v.Load()
+}
+
+// Reset 将计数清零并返回清零前的值，适用于按周期上报增量
+func (c *Counter) Reset() uint64 {
+	return c.v.Swap(0)
+}
+
+// Gauge 是基于 sync/atomic 的瞬时值指标，如队列长度、当前容量，并发安全，零值可直接使用。
+// 不可复制，需要以指针或嵌入结构体的方式使用
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v int64) {
+	g.v.Store(v)
+}
+
+// Load 返回当前值
+func (g *Gauge) Load() int64 {
+	return g.v.Load()
+}
@@ -0,0 +1,56 @@
+package generic
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	is := assert.New(t)
+	var c Counter
+	is.Equal(uint64(0), c.Load())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Inc()
+				c.Add(2)
+				c.Load()
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(uint64(24000), c.Load())
+
+	is.Equal(uint64(24000), c.Reset())
+	is.Equal(uint64(0), c.Load())
+	is.Equal(uint64(1), c.Inc())
+	is.Equal(uint64(6), c.Add(5))
+}
+
+func TestGauge(t *testing.T) {
+	is := assert.New(t)
+	var g Gauge
+	is.Equal(int64(0), g.Load())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(v int64) {
+			defer wg.Done()
+			g.Set(v)
+			g.Load()
+		}(int64(i))
+	}
+	wg.Wait()
+	is.GreaterOrEqual(g.Load(), int64(1))
+	is.LessOrEqual(g.Load(), int64(8))
+
+	g.Set(-3)
+	is.Equal(int64(-3), g.Load())
+}
@@ -53,3 +53,26 @@ func Equal(v1, v2 any) bool {
 	// 直接使用 == 操作符比较 v1 和 v2，返回比较结果。
 	return v1 == v2
 }
+
+// Ptr 返回值 v 的指针，便于对字面量或常量取地址。
+// 例如：Ptr(10)、Ptr("name")。
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Deref 安全地解引用指针 p，如果 p 为 nil 则返回 fallback。
+func Deref[T any](p *T, fallback T) T {
+	if p == nil {
+		return fallback
+	}
+	return *p
+}
+
+// Must 在 err 不为 nil 时 panic，否则返回 v。
+// 适用于初始化阶段或测试中不应出错的调用，例如：Must(strconv.Atoi("10"))。
+func Must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,42 @@
+package generic
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPtr(t *testing.T) {
+	is := assert.New(t)
+	p := Ptr(10)
+	is.Equal(10, *p)
+
+	// each call returns a distinct pointer
+	v := "name"
+	sp := Ptr(v)
+	*sp = "changed"
+	is.Equal("name", v)
+	is.NotSame(Ptr(1), Ptr(1))
+}
+
+func TestDeref(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(10, Deref(Ptr(10), 1))
+	is.Equal(1, Deref[int](nil, 1))
+	is.Equal("", Deref(Ptr(""), "fallback"))
+	is.Equal("fallback", Deref[string](nil, "fallback"))
+}
+
+func TestMust(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(10, Must(strconv.Atoi("10")))
+
+	is.PanicsWithError("boom", func() {
+		Must(0, errors.New("boom"))
+	})
+	is.Panics(func() {
+		Must(strconv.Atoi("not a number"))
+	})
+}
@@ -0,0 +1,120 @@
+package generic
+
+import "sync"
+
+// PriorityQueue 是基于二叉堆的泛型优先队列，less(a, b) 返回 true 表示 a 优先于 b 出队，
+// 即按 less 排序的最小堆。优先级相同的元素出队顺序不确定。非并发安全，并发使用请用 SafePriorityQueue。
+type PriorityQueue[T any] struct {
+	items []T
+	less  func(a, b T) bool
+}
+
+// NewPriorityQueue 创建一个按 less 排序的优先队列
+func NewPriorityQueue[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	return &PriorityQueue[T]{less: less}
+}
+
+// Push 加入一个元素，时间复杂度 O(log n)
+func (pq *PriorityQueue[T]) Push(item T) {
+	pq.items = append(pq.items, item)
+	pq.up(len(pq.items) - 1)
+}
+
+// Pop 取出并返回优先级最高的元素，队列为空时 ok 为 false，时间复杂度 O(log n)
+func (pq *PriorityQueue[T]) Pop() (item T, ok bool) {
+	n := len(pq.items)
+	if n == 0 {
+		return Zero[T](), false
+	}
+	item = pq.items[0]
+	pq.items[0] = pq.items[n-1]
+	pq.items[n-1] = Zero[T]() // 避免底层数组持有已出队元素的引用
+	pq.items = pq.items[:n-1]
+	if n > 1 {
+		pq.down(0)
+	}
+	return item, true
+}
+
+// Peek 返回优先级最高的元素但不出队，队列为空时 ok 为 false
+func (pq *PriorityQueue[T]) Peek() (item T, ok bool) {
+	if len(pq.items) == 0 {
+		return Zero[T](), false
+	}
+	return pq.items[0], true
+}
+
+// Len 返回元素数量
+func (pq *PriorityQueue[T]) Len() int {
+	return len(pq.items)
+}
+
+// up 将下标 i 的元素上浮到合适的位置
+func (pq *PriorityQueue[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !pq.less(pq.items[i], pq.items[parent]) {
+			return
+		}
+		pq.items[i], pq.items[parent] = pq.items[parent], pq.items[i]
+		i = parent
+	}
+}
+
+// down 将下标 i 的元素下沉到合适的位置
+func (pq *PriorityQueue[T]) down(i int) {
+	n := len(pq.items)
+	for {
+		smallest := i
+		if left := 2*i + 1; left < n && pq.less(pq.items[left], pq.items[smallest]) {
+			smallest = left
+		}
+		if right := 2*i + 2; right < n && pq.less(pq.items[right], pq.items[smallest]) {
+			smallest = right
+		}
+		if smallest == i {
+			return
+		}
+		pq.items[i], pq.items[smallest] = pq.items[smallest], pq.items[i]
+		i = smallest
+	}
+}
+
+// SafePriorityQueue 是并发安全的 PriorityQueue，基于 sync.Mutex 实现
+type SafePriorityQueue[T any] struct {
+	mu sync.Mutex
+	pq *PriorityQueue[T]
+}
+
+// NewSafePriorityQueue 创建一个按 less 排序的并发安全优先队列
+func NewSafePriorityQueue[T any](less func(a, b T) bool) *SafePriorityQueue[T] {
+	return &SafePriorityQueue[T]{pq: NewPriorityQueue(less)}
+}
+
+// Push 加入一个元素
+func (spq *SafePriorityQueue[T]) Push(item T) {
+	spq.mu.Lock()
+	defer spq.mu.Unlock()
+	spq.pq.Push(item)
+}
+
+// Pop 取出并返回优先级最高的元素，队列为空时 ok 为 false
+func (spq *SafePriorityQueue[T]) Pop() (item T, ok bool) {
+	spq.mu.Lock()
+	defer spq.mu.Unlock()
+	return spq.pq.Pop()
+}
+
+// Peek 返回优先级最高的元素但不出队，队列为空时 ok 为 false
+func (spq *SafePriorityQueue[T]) Peek() (item T, ok bool) {
+	spq.mu.Lock()
+	defer spq.mu.Unlock()
+	return spq.pq.Peek()
+}
+
+// Len 返回元素数量
+func (spq *SafePriorityQueue[T]) Len() int {
+	spq.mu.Lock()
+	defer spq.mu.Unlock()
+	return spq.pq.Len()
+}
@@ -0,0 +1,103 @@
+package generic
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	is := assert.New(t)
+	pq := NewPriorityQueue(func(a, b int) bool { return a < b })
+
+	_, ok := pq.Pop()
+	is.False(ok)
+	_, ok = pq.Peek()
+	is.False(ok)
+
+	values := rand.Perm(1000)
+	for _, v := range values {
+		pq.Push(v)
+	}
+	is.Equal(1000, pq.Len())
+	top, ok := pq.Peek()
+	is.True(ok)
+	is.Equal(0, top)
+	is.Equal(1000, pq.Len())
+
+	for want := 0; want < 1000; want++ {
+		v, ok := pq.Pop()
+		is.True(ok)
+		is.Equal(want, v)
+	}
+	is.Equal(0, pq.Len())
+}
+
+func TestPriorityQueueComparator(t *testing.T) {
+	is := assert.New(t)
+	type task struct {
+		name     string
+		priority int
+	}
+	// a max-heap by priority
+	pq := NewPriorityQueue(func(a, b task) bool { return a.priority > b.priority })
+	pq.Push(task{"low", 1})
+	pq.Push(task{"high", 10})
+	pq.Push(task{"mid", 5})
+
+	for _, want := range []string{"high", "mid", "low"} {
+		v, _ := pq.Pop()
+		is.Equal(want, v.name)
+	}
+}
+
+func TestSafePriorityQueue(t *testing.T) {
+	is := assert.New(t)
+	pq := NewSafePriorityQueue(func(a, b int) bool { return a < b })
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				pq.Push(g*100 + i)
+				pq.Peek()
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(800, pq.Len())
+
+	var lock sync.Mutex
+	var popped []int
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each consumer sees its own values in increasing order
+			last := -1
+			for {
+				v, ok := pq.Pop()
+				if !ok {
+					return
+				}
+				is.Greater(v, last)
+				last = v
+				lock.Lock()
+				popped = append(popped, v)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(0, pq.Len())
+	is.Len(popped, 800)
+	sort.Ints(popped)
+	for i, v := range popped {
+		is.Equal(i, v)
+	}
+}
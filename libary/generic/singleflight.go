@@ -0,0 +1,74 @@
+package generic
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Group 合并同一 key 的并发调用：同一时刻只有一个调用真正执行 fn，其余调用等待并共享其结果。
+// 语义与 golang.org/x/sync/singleflight 一致，但 key 可以是任意 comparable 类型且返回值是类型安全的，
+// 适用于进程内去重昂贵的计算（如本地解析）。零值可直接使用。
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+// call 是一次正在执行或已完成的调用
+type call[V any] struct {
+	wg   sync.WaitGroup
+	val  V
+	err  error
+	dups int
+}
+
+// Do 执行 fn 并返回其结果，如果同一 key 已有调用在执行，则等待该调用完成并返回相同的结果。
+// shared 表示结果是否被多个调用方共享。fn panic 时等待中的调用方会收到错误，panic 在执行 fn 的调用方中继续抛出
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call[V])
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	g.doCall(key, c, fn)
+	return c.val, c.err, c.dups > 0
+}
+
+// doCall 执行 fn，完成后移除 key 并唤醒等待的调用方
+func (g *Group[K, V]) doCall(key K, c *call[V], fn func() (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("generic: singleflight fn panicked: %v", r)
+			g.finish(key, c)
+			panic(r)
+		}
+	}()
+	c.val, c.err = fn()
+	g.finish(key, c)
+}
+
+func (g *Group[K, V]) finish(key K, c *call[V]) {
+	g.mu.Lock()
+	// Forget 之后同一 key 可能已经是新的调用
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	c.wg.Done()
+}
+
+// Forget 使之后对 key 的调用不再等待正在执行的调用，而是重新执行 fn
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
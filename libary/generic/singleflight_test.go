@@ -0,0 +1,122 @@
+package generic
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupDo(t *testing.T) {
+	is := assert.New(t)
+	type key struct {
+		file string
+		line int
+	}
+	var g Group[key, int]
+	var calls int32
+	release := make(chan struct{})
+	k := key{"a.go", 1}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var sharedCount int32
+	results := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err, shared := g.Do(k, func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			is.NoError(err)
+			results[i] = v
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}(i)
+	}
+	// wait until every other goroutine joined the in-flight call
+	is.Eventually(func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c, ok := g.calls[k]
+		return ok && c.dups == n-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	is.Equal(int32(1), atomic.LoadInt32(&calls))
+	is.Equal(int32(n), atomic.LoadInt32(&sharedCount))
+	for _, v := range results {
+		is.Equal(42, v)
+	}
+
+	// the key is released after the call, a later call runs fn again
+	v, err, shared := g.Do(k, func() (int, error) { return 0, errors.New("boom") })
+	is.Equal(0, v)
+	is.EqualError(err, "boom")
+	is.False(shared)
+}
+
+func TestGroupForget(t *testing.T) {
+	is := assert.New(t)
+	var g Group[int, string]
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(1, func() (string, error) {
+			close(started)
+			<-release
+			return "old", nil
+		})
+	}()
+	<-started
+	g.Forget(1)
+	v, _, shared := g.Do(1, func() (string, error) { return "new", nil })
+	is.Equal("new", v)
+	is.False(shared)
+	close(release)
+	<-done
+}
+
+func TestGroupPanic(t *testing.T) {
+	is := assert.New(t)
+	var g Group[string, int]
+	release := make(chan struct{})
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.Do("k", func() (int, error) {
+			<-release
+			panic("bad")
+		})
+	}()
+	is.Eventually(func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		_, ok := g.calls["k"]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do("k", func() (int, error) { return 1, nil })
+		errs <- err
+	}()
+	is.Eventually(func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.calls["k"].dups == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	is.Equal("bad", <-panicked)
+	is.ErrorContains(<-errs, "panicked")
+}
@@ -0,0 +1,31 @@
+package generic
+
+import "fmt"
+
+// GroupBy 按照 keyFn 计算出的键对切片元素进行分组。
+// 每个分组内的元素保持其在原切片中的相对顺序。
+func GroupBy[T any, K comparable](items []T, keyFn func(T) K) map[K][]T {
+	groups := make(map[K][]T)
+	for _, item := range items {
+		key := keyFn(item)
+		groups[key] = append(groups[key], item)
+	}
+	return groups
+}
+
+// Chunk 将切片按 size 切分为多个批次，长度不能整除时最后一个批次较短。
+// 返回的批次共享原切片的底层数组。size 小于等于0时会panic。
+func Chunk[T any](items []T, size int) [][]T {
+	if size <= 0 {
+		panic(fmt.Sprintf("generic: invalid chunk size %d", size))
+	}
+	chunks := make([][]T, 0, (len(items)+size-1)/size)
+	for size < len(items) {
+		// 使用完整切片表达式限制容量，避免对批次 append 时覆盖后续元素
+		items, chunks = items[size:], append(chunks, items[0:size:size])
+	}
+	if len(items) > 0 {
+		chunks = append(chunks, items)
+	}
+	return chunks
+}
@@ -0,0 +1,67 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupBy(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	cases := []struct {
+		name  string
+		items []user
+		want  map[bool][]user
+	}{
+		{
+			name:  "empty",
+			items: nil,
+			want:  map[bool][]user{},
+		},
+		{
+			name:  "keep order in group",
+			items: []user{{"a", 10}, {"b", 20}, {"c", 30}, {"d", 15}},
+			want: map[bool][]user{
+				false: {{"a", 10}, {"d", 15}},
+				true:  {{"b", 20}, {"c", 30}},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := GroupBy(c.items, func(u user) bool { return u.Age >= 18 })
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestChunk(t *testing.T) {
+	cases := []struct {
+		name  string
+		items []int
+		size  int
+		want  [][]int
+	}{
+		{"empty", nil, 2, [][]int{}},
+		{"divisible", []int{1, 2, 3, 4}, 2, [][]int{{1, 2}, {3, 4}}},
+		{"last chunk shorter", []int{1, 2, 3, 4, 5}, 2, [][]int{{1, 2}, {3, 4}, {5}}},
+		{"size larger than length", []int{1, 2, 3}, 10, [][]int{{1, 2, 3}}},
+		{"size one", []int{1, 2, 3}, 1, [][]int{{1}, {2}, {3}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Chunk(c.items, c.size))
+		})
+	}
+
+	// appending to a chunk must not overwrite the next one
+	chunks := Chunk([]int{1, 2, 3, 4}, 2)
+	_ = append(chunks[0], 100)
+	assert.Equal(t, []int{3, 4}, chunks[1])
+
+	assert.Panics(t, func() { Chunk([]int{1}, 0) })
+	assert.Panics(t, func() { Chunk([]int{1}, -1) })
+}
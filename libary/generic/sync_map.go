@@ -0,0 +1,82 @@
+package generic
+
+import "sync"
+
+// SyncMap 是并发安全的泛型 map，基于 sync.RWMutex 与原生 map 实现。
+// 相比 sync.Map，它提供了类型安全的接口，并且可以 O(1) 获取元素数量。
+// 零值可直接使用。
+type SyncMap[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+// NewSyncMap 创建一个 SyncMap
+func NewSyncMap[K comparable, V any]() *SyncMap[K, V] {
+	return &SyncMap[K, V]{m: make(map[K]V)}
+}
+
+// Load 返回 key 对应的值，ok 表示 key 是否存在
+func (sm *SyncMap[K, V]) Load(key K) (value V, ok bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	value, ok = sm.m[key]
+	return
+}
+
+// Store 设置 key 对应的值
+func (sm *SyncMap[K, V]) Store(key K, value V) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.m == nil {
+		sm.m = make(map[K]V)
+	}
+	sm.m[key] = value
+}
+
+// LoadOrStore 如果 key 已存在则返回已有的值且 loaded 为 true，
+// 否则存储 value 并返回 value，loaded 为 false
+func (sm *SyncMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if actual, loaded = sm.m[key]; loaded {
+		return actual, true
+	}
+	if sm.m == nil {
+		sm.m = make(map[K]V)
+	}
+	sm.m[key] = value
+	return value, false
+}
+
+// Delete 删除 key
+func (sm *SyncMap[K, V]) Delete(key K) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.m, key)
+}
+
+// Range 依次对每个键值对调用 fn，fn 返回 false 时停止遍历。
+// 遍历的是调用时刻的快照，因此可以在 fn 中安全地修改 SyncMap。
+func (sm *SyncMap[K, V]) Range(fn func(key K, value V) bool) {
+	sm.mu.RLock()
+	keys := make([]K, 0, len(sm.m))
+	values := make([]V, 0, len(sm.m))
+	for k, v := range sm.m {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	sm.mu.RUnlock()
+
+	for i := range keys {
+		if !fn(keys[i], values[i]) {
+			return
+		}
+	}
+}
+
+// Len 返回元素数量
+func (sm *SyncMap[K, V]) Len() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.m)
+}
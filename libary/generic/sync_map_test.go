@@ -0,0 +1,91 @@
+package generic
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncMap(t *testing.T) {
+	is := assert.New(t)
+	var sm SyncMap[string, int]
+
+	_, ok := sm.Load("a")
+	is.False(ok)
+	is.Equal(0, sm.Len())
+
+	sm.Store("a", 1)
+	v, ok := sm.Load("a")
+	is.True(ok)
+	is.Equal(1, v)
+
+	actual, loaded := sm.LoadOrStore("a", 2)
+	is.True(loaded)
+	is.Equal(1, actual)
+	actual, loaded = sm.LoadOrStore("b", 2)
+	is.False(loaded)
+	is.Equal(2, actual)
+	is.Equal(2, sm.Len())
+
+	sm.Delete("a")
+	_, ok = sm.Load("a")
+	is.False(ok)
+	is.Equal(1, sm.Len())
+}
+
+func TestSyncMapRange(t *testing.T) {
+	is := assert.New(t)
+	sm := NewSyncMap[int, int]()
+	for i := 0; i < 10; i++ {
+		sm.Store(i, i*i)
+	}
+
+	sum := 0
+	sm.Range(func(k, v int) bool {
+		is.Equal(k*k, v)
+		sum += v
+		// modifying the map inside Range must not deadlock
+		sm.Delete(k)
+		return true
+	})
+	is.Equal(285, sum)
+	is.Equal(0, sm.Len())
+
+	for i := 0; i < 10; i++ {
+		sm.Store(i, i)
+	}
+	visited := 0
+	sm.Range(func(k, v int) bool {
+		visited++
+		return visited < 3
+	})
+	is.Equal(3, visited)
+}
+
+func TestSyncMapConcurrent(t *testing.T) {
+	sm := NewSyncMap[int, int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				sm.Store(i, g)
+				sm.LoadOrStore(i+1000, g)
+				sm.Load(i)
+				if i%10 == 0 {
+					sm.Delete(i)
+				}
+				_ = sm.Len()
+			}
+			sm.Range(func(k, v int) bool { return true })
+		}(g)
+	}
+	wg.Wait()
+	for i := 1000; i < 2000; i++ {
+		_, ok := sm.Load(i)
+		assert.True(t, ok)
+	}
+	assert.GreaterOrEqual(t, sm.Len(), 1900)
+}
@@ -111,6 +111,11 @@ func getContainerMemUsed() (uint64, error) {
 	return used, nil
 }
 
+// getContainerCPUQuota returns cpu quota in cores and error
+func getContainerCPUQuota() (float64, error) {
+	return readCgroupCPUQuota("/sys/fs/cgroup")
+}
+
 // fileExists checks if a file or directory exists at the given path
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
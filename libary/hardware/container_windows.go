@@ -24,3 +24,8 @@ func getContainerMemLimit() (uint64, error) {
 func getContainerMemUsed() (uint64, error) {
 	return 0, errors.New("Not supported")
 }
+
+// getContainerCPUQuota returns cpu quota in cores and error
+func getContainerCPUQuota() (float64, error) {
+	return 0, errors.New("Not supported")
+}
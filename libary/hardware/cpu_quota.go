@@ -0,0 +1,62 @@
+package hardware
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// errNoCPUQuota denotes that the cgroup does not limit cpu
+var errNoCPUQuota = errors.New("no cpu quota set")
+
+// readCgroupCPUQuota returns the cpu quota in cores of the cgroup mounted at root.
+// cgroup v2 is read from <root>/cpu.max, cgroup v1 from <root>/cpu/cpu.cfs_quota_us and cpu.cfs_period_us.
+func readCgroupCPUQuota(root string) (float64, error) {
+	// cgroup v2: "<quota> <period>" or "max <period>"
+	if data, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, errors.Newf("invalid cpu.max content: %q", string(data))
+		}
+		if fields[0] == "max" {
+			return 0, errNoCPUQuota
+		}
+		return parseCPUQuota(fields[0], fields[1])
+	}
+
+	// cgroup v1: quota is -1 when not limited
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		quota, err := os.ReadFile(filepath.Join(root, dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		period, err := os.ReadFile(filepath.Join(root, dir, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, err
+		}
+		quotaStr := strings.TrimSpace(string(quota))
+		if quotaStr == "-1" {
+			return 0, errNoCPUQuota
+		}
+		return parseCPUQuota(quotaStr, strings.TrimSpace(string(period)))
+	}
+	return 0, errNoCPUQuota
+}
+
+func parseCPUQuota(quotaStr, periodStr string) (float64, error) {
+	quota, err := strconv.ParseFloat(quotaStr, 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseFloat(periodStr, 64)
+	if err != nil {
+		return 0, err
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, errNoCPUQuota
+	}
+	return quota / period, nil
+}
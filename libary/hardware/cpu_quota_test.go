@@ -0,0 +1,43 @@
+package hardware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCgroupFile(t *testing.T, path, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestReadCgroupCPUQuota(t *testing.T) {
+	// cgroup v2
+	root := t.TempDir()
+	writeCgroupFile(t, filepath.Join(root, "cpu.max"), "150000 100000\n")
+	quota, err := readCgroupCPUQuota(root)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, quota)
+
+	writeCgroupFile(t, filepath.Join(root, "cpu.max"), "max 100000\n")
+	_, err = readCgroupCPUQuota(root)
+	assert.ErrorIs(t, err, errNoCPUQuota)
+
+	// cgroup v1
+	root = t.TempDir()
+	writeCgroupFile(t, filepath.Join(root, "cpu", "cpu.cfs_quota_us"), "400000\n")
+	writeCgroupFile(t, filepath.Join(root, "cpu", "cpu.cfs_period_us"), "100000\n")
+	quota, err = readCgroupCPUQuota(root)
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, quota)
+
+	writeCgroupFile(t, filepath.Join(root, "cpu", "cpu.cfs_quota_us"), "-1\n")
+	_, err = readCgroupCPUQuota(root)
+	assert.ErrorIs(t, err, errNoCPUQuota)
+
+	// no cgroup
+	_, err = readCgroupCPUQuota(t.TempDir())
+	assert.ErrorIs(t, err, errNoCPUQuota)
+}
@@ -41,6 +41,19 @@ func GetCPUNum() int {
 	return cur
 }
 
+// GetContainerCPUQuota returns the cpu quota of the container in cores,
+// falls back to the count of cpu core when no quota is set or it can't be detected.
+func GetContainerCPUQuota() float64 {
+	quota, err := getContainerCPUQuota()
+	if err != nil || quota <= 0 {
+		return float64(GetCPUNum())
+	}
+	if cpuNum := float64(GetCPUNum()); quota > cpuNum {
+		return cpuNum
+	}
+	return quota
+}
+
 // GetCPUUsage returns the cpu usage in percentage.
 func GetCPUUsage() float64 {
 	percents, err := cpu.Percent(0, false)
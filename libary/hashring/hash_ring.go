@@ -0,0 +1,116 @@
+// Package hashring implements a consistent hash ring with virtual nodes, used for keyed routing of queue messages.
+package hashring
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultReplicas is the number of virtual nodes per node when not specified
+const defaultReplicas = 160
+
+// HashRing is a consistent hash ring mapping keys to nodes, e.g. message keys to partitions or consumers.
+// Every node is placed on the ring as replicas virtual nodes for balance, so adding or removing a node
+// only remaps the keys that move to or from that node. It's safe for concurrent use.
+type HashRing struct {
+	lock     sync.RWMutex
+	replicas int
+	hashes   []uint64          // sorted hashes of the virtual nodes
+	owners   map[uint64]string // hash of a virtual node -> node
+	nodes    map[string]struct{}
+}
+
+// NewHashRing create a hash ring with replicas virtual nodes per node, 160 if replicas is not positive
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &HashRing{
+		replicas: replicas,
+		owners:   make(map[uint64]string),
+		nodes:    make(map[string]struct{}),
+	}
+}
+
+// Add add a node to the ring, adding an existing node is a no-op
+func (r *HashRing) Add(node string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.nodes[node]; ok {
+		return
+	}
+	r.nodes[node] = struct{}{}
+	for i := 0; i < r.replicas; i++ {
+		h := hashKey(node + "#" + strconv.Itoa(i))
+		// on the rare collision the virtual node added first keeps the position
+		if _, ok := r.owners[h]; ok {
+			continue
+		}
+		r.owners[h] = node
+		r.hashes = append(r.hashes, h)
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove remove a node from the ring, the keys of the node move to the next nodes on the ring
+func (r *HashRing) Remove(node string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.nodes[node]; !ok {
+		return
+	}
+	delete(r.nodes, node)
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if r.owners[h] == node {
+			delete(r.owners, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	r.hashes = hashes
+}
+
+// Get return the node owning the key, the first virtual node clockwise from the hash of the key.
+// It returns an empty string if the ring has no node
+func (r *HashRing) Get(key string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Nodes return the sorted nodes of the ring
+func (r *HashRing) Nodes() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// hashKey hash the key with FNV-1a followed by the murmur3 finalizer,
+// FNV-1a alone spreads similar keys such as "node#1" and "node#2" poorly over the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
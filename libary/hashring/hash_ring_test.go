@@ -0,0 +1,90 @@
+package hashring
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRingEmpty(t *testing.T) {
+	ring := NewHashRing(0)
+	assert.Equal(t, "", ring.Get("key"))
+	ring.Add("a")
+	ring.Remove("a")
+	assert.Equal(t, "", ring.Get("key"))
+	assert.Empty(t, ring.Nodes())
+}
+
+func TestHashRingBalance(t *testing.T) {
+	ring := NewHashRing(0)
+	for i := 0; i < 10; i++ {
+		ring.Add(fmt.Sprintf("node-%d", i))
+	}
+	ring.Add("node-0") // adding twice is a no-op
+	assert.Len(t, ring.Nodes(), 10)
+
+	const keys = 100000
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		counts[ring.Get(fmt.Sprintf("key-%d", i))]++
+	}
+	assert.Len(t, counts, 10)
+	mean := keys / 10
+	for node, count := range counts {
+		assert.InDelta(t, mean, count, float64(mean)*0.25, node)
+	}
+}
+
+func TestHashRingRemap(t *testing.T) {
+	ring := NewHashRing(0)
+	for i := 0; i < 5; i++ {
+		ring.Add(fmt.Sprintf("node-%d", i))
+	}
+	const keys = 10000
+	before := make([]string, keys)
+	for i := range before {
+		before[i] = ring.Get(fmt.Sprintf("key-%d", i))
+	}
+
+	// only the keys of the removed node move
+	ring.Remove("node-2")
+	moved := 0
+	for i, owner := range before {
+		now := ring.Get(fmt.Sprintf("key-%d", i))
+		assert.NotEqual(t, "node-2", now)
+		if owner != "node-2" {
+			assert.Equal(t, owner, now)
+		} else {
+			moved++
+		}
+	}
+	assert.InDelta(t, keys/5, moved, keys/5*0.3)
+
+	// adding it back restores the original mapping
+	ring.Add("node-2")
+	for i, owner := range before {
+		assert.Equal(t, owner, ring.Get(fmt.Sprintf("key-%d", i)))
+	}
+}
+
+func TestHashRingConcurrent(t *testing.T) {
+	ring := NewHashRing(10)
+	ring.Add("base")
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node := fmt.Sprintf("node-%d", g)
+			for i := 0; i < 100; i++ {
+				ring.Add(node)
+				assert.NotEmpty(t, ring.Get(fmt.Sprintf("key-%d", i)))
+				ring.Remove(node)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"base"}, ring.Nodes())
+}
@@ -0,0 +1,111 @@
+// Package id generates UUIDs and ULIDs, it has no dependency on other packages of the module
+// so that low level packages such as queue can use it.
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// crockford base32 alphabet used by ULID
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulidState struct {
+	sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+// NewUUID generate a random RFC 4122 version 4 UUID, e.g. "f47ac10b-58cc-4372-a567-0e02b2c3d479"
+func NewUUID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant RFC 4122
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// NewULID generate a 26 character ULID. ULIDs sort lexicographically by creation time,
+// ids generated within the same millisecond are monotonically increasing
+func NewULID() string {
+	ms := uint64(time.Now().UnixMilli())
+
+	ulidState.Lock()
+	if ms <= ulidState.lastMs {
+		// same millisecond (or clock moved backwards): increment the previous entropy
+		ms = ulidState.lastMs
+		for i := len(ulidState.entropy) - 1; i >= 0; i-- {
+			ulidState.entropy[i]++
+			if ulidState.entropy[i] != 0 {
+				break
+			}
+			if i == 0 {
+				// entropy overflowed, borrow the next millisecond
+				ms++
+			}
+		}
+	} else if _, err := rand.Read(ulidState.entropy[:]); err != nil {
+		ulidState.Unlock()
+		panic(err)
+	}
+	ulidState.lastMs = ms
+
+	var id [16]byte
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(id[:6], ts[2:])
+	copy(id[6:], ulidState.entropy[:])
+	ulidState.Unlock()
+
+	return encodeULID(id)
+}
+
+// encodeULID encode 128 bits as 26 crockford base32 characters
+func encodeULID(id [16]byte) string {
+	var dst [26]byte
+	// 10 characters of timestamp
+	dst[0] = ulidEncoding[(id[0]&224)>>5]
+	dst[1] = ulidEncoding[id[0]&31]
+	dst[2] = ulidEncoding[(id[1]&248)>>3]
+	dst[3] = ulidEncoding[((id[1]&7)<<2)|((id[2]&192)>>6)]
+	dst[4] = ulidEncoding[(id[2]&62)>>1]
+	dst[5] = ulidEncoding[((id[2]&1)<<4)|((id[3]&240)>>4)]
+	dst[6] = ulidEncoding[((id[3]&15)<<1)|((id[4]&128)>>7)]
+	dst[7] = ulidEncoding[(id[4]&124)>>2]
+	dst[8] = ulidEncoding[((id[4]&3)<<3)|((id[5]&224)>>5)]
+	dst[9] = ulidEncoding[id[5]&31]
+	// 16 characters of entropy
+	dst[10] = ulidEncoding[(id[6]&248)>>3]
+	dst[11] = ulidEncoding[((id[6]&7)<<2)|((id[7]&192)>>6)]
+	dst[12] = ulidEncoding[(id[7]&62)>>1]
+	dst[13] = ulidEncoding[((id[7]&1)<<4)|((id[8]&240)>>4)]
+	dst[14] = ulidEncoding[((id[8]&15)<<1)|((id[9]&128)>>7)]
+	dst[15] = ulidEncoding[(id[9]&124)>>2]
+	dst[16] = ulidEncoding[((id[9]&3)<<3)|((id[10]&224)>>5)]
+	dst[17] = ulidEncoding[id[10]&31]
+	dst[18] = ulidEncoding[(id[11]&248)>>3]
+	dst[19] = ulidEncoding[((id[11]&7)<<2)|((id[12]&192)>>6)]
+	dst[20] = ulidEncoding[(id[12]&62)>>1]
+	dst[21] = ulidEncoding[((id[12]&1)<<4)|((id[13]&240)>>4)]
+	dst[22] = ulidEncoding[((id[13]&15)<<1)|((id[14]&128)>>7)]
+	dst[23] = ulidEncoding[(id[14]&124)>>2]
+	dst[24] = ulidEncoding[((id[14]&3)<<3)|((id[15]&224)>>5)]
+	dst[25] = ulidEncoding[id[15]&31]
+	return string(dst[:])
+}
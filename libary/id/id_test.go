@@ -0,0 +1,79 @@
+package id
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestNewUUID(t *testing.T) {
+	seen := make(map[string]struct{}, 100000)
+	for i := 0; i < 100000; i++ {
+		id := NewUUID()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("invalid uuid %q", id)
+		}
+		seen[id] = struct{}{}
+	}
+	assert.Len(t, seen, 100000)
+}
+
+func TestNewULID(t *testing.T) {
+	prev := NewULID()
+	seen := map[string]struct{}{prev: {}}
+	for i := 0; i < 100000; i++ {
+		id := NewULID()
+		if !ulidPattern.MatchString(id) {
+			t.Fatalf("invalid ulid %q", id)
+		}
+		if id <= prev {
+			t.Fatalf("ulid not monotonic: %q <= %q", id, prev)
+		}
+		seen[id] = struct{}{}
+		prev = id
+	}
+	assert.Len(t, seen, 100001)
+}
+
+func TestNewULIDTimestamp(t *testing.T) {
+	before := NewULID()
+	time.Sleep(2 * time.Millisecond)
+	after := NewULID()
+	// the first 10 characters encode the millisecond timestamp
+	assert.Less(t, before[:10], after[:10])
+}
+
+func TestNewULIDConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 10000
+	ids := make([][]string, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				ids[g] = append(ids[g], NewULID())
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	seen := make(map[string]struct{}, goroutines*perGoroutine)
+	for _, list := range ids {
+		for i, id := range list {
+			if i > 0 {
+				assert.Less(t, list[i-1], id)
+			}
+			seen[id] = struct{}{}
+		}
+	}
+	assert.Len(t, seen, goroutines*perGoroutine)
+}
@@ -0,0 +1,170 @@
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultIncreaseStep   = 1
+	defaultDecreaseFactor = 0.5
+)
+
+// AdaptiveOption 自适应限流器的选项
+type AdaptiveOption func(l *AdaptiveLimiter)
+
+// WithIncreaseStep 设置每次成功反馈后速率的加性增量
+func WithIncreaseStep(step float64) AdaptiveOption {
+	return func(l *AdaptiveLimiter) {
+		if step > 0 {
+			l.increaseStep = step
+		}
+	}
+}
+
+// WithDecreaseFactor 设置每次失败反馈后速率的乘性衰减因子，取值范围 (0, 1)
+func WithDecreaseFactor(factor float64) AdaptiveOption {
+	return func(l *AdaptiveLimiter) {
+		if factor > 0 && factor < 1 {
+			l.decreaseFactor = factor
+		}
+	}
+}
+
+// WithInitialTokens 设置初始的令牌数量，默认为桶容量（一秒的速率）。
+// 设置为0时限流器冷启动，启动时不放行突发请求，之后按速率逐步积累令牌
+func WithInitialTokens(n float64) AdaptiveOption {
+	return func(l *AdaptiveLimiter) {
+		if n >= 0 {
+			l.initialTokens = &n
+		}
+	}
+}
+
+// AdaptiveLimiter 自适应限流器，按照 AIMD（加性增、乘性减）根据下游反馈调整允许的速率：
+// 失败时速率乘以衰减因子，成功时速率加上固定增量，速率始终限制在 [minRate, maxRate] 之间。
+// 放行请求时按当前速率以令牌桶方式计算，桶容量为一秒的速率。
+type AdaptiveLimiter struct {
+	allowStats
+
+	mu sync.Mutex
+
+	rate           float64 // 当前每秒允许的请求数
+	minRate        float64
+	maxRate        float64
+	increaseStep   float64
+	decreaseFactor float64
+
+	tokens        float64
+	initialTokens *float64 // 为 nil 时初始令牌为桶容量
+	last          time.Time
+
+	now func() time.Time
+}
+
+// NewAdaptiveLimiter 创建一个初始速率为 rate（每秒请求数）的自适应限流器
+func NewAdaptiveLimiter(rate, minRate, maxRate float64, opts ...AdaptiveOption) *AdaptiveLimiter {
+	if minRate <= 0 {
+		minRate = 1
+	}
+	if maxRate < minRate {
+		maxRate = minRate
+	}
+	l := &AdaptiveLimiter{
+		minRate:        minRate,
+		maxRate:        maxRate,
+		increaseStep:   defaultIncreaseStep,
+		decreaseFactor: defaultDecreaseFactor,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.rate = l.clamp(rate)
+	l.tokens = l.burst()
+	if l.initialTokens != nil && *l.initialTokens < l.tokens {
+		l.tokens = *l.initialTokens
+	}
+	l.last = l.now()
+	return l
+}
+
+// Allow 判断当前请求是否可以放行
+func (l *AdaptiveLimiter) Allow() bool {
+	return l.record(l.allow())
+}
+
+func (l *AdaptiveLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	return false
+}
+
+// Feedback 上报下游的处理结果，用于调整速率
+func (l *AdaptiveLimiter) Feedback(success bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 先按旧速率结算令牌，再调整速率
+	l.refill()
+	if success {
+		l.rate = l.clamp(l.rate + l.increaseStep)
+	} else {
+		l.rate = l.clamp(l.rate * l.decreaseFactor)
+	}
+	if burst := l.burst(); l.tokens > burst {
+		l.tokens = burst
+	}
+}
+
+// Reset 将令牌补满到桶容量，使限流器立即可以放行突发请求，用于手动干预或测试。
+// 当前速率和 Stats 统计不受影响
+func (l *AdaptiveLimiter) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = l.burst()
+	l.last = l.now()
+}
+
+// Rate 返回当前每秒允许的请求数
+func (l *AdaptiveLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+func (l *AdaptiveLimiter) refill() {
+	now := l.now()
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens += elapsed * l.rate
+	if burst := l.burst(); l.tokens > burst {
+		l.tokens = burst
+	}
+}
+
+func (l *AdaptiveLimiter) burst() float64 {
+	if l.rate < 1 {
+		return 1
+	}
+	return l.rate
+}
+
+func (l *AdaptiveLimiter) clamp(rate float64) float64 {
+	if rate < l.minRate {
+		return l.minRate
+	}
+	if rate > l.maxRate {
+		return l.maxRate
+	}
+	return rate
+}
@@ -0,0 +1,124 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// allowedIn 统计在 d 时间内按 step 间隔请求时被放行的数量
+func allowedIn(l *AdaptiveLimiter, clock *fakeClock, d, step time.Duration) int {
+	allowed := 0
+	for elapsed := time.Duration(0); elapsed < d; elapsed += step {
+		clock.Advance(step)
+		if l.Allow() {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(100, 5, 200, WithIncreaseStep(10), WithDecreaseFactor(0.5))
+	l.now = clock.Now
+	l.last = clock.Now()
+
+	// drain the initial burst
+	for l.Allow() {
+	}
+	healthy := allowedIn(l, clock, time.Second, time.Millisecond)
+	is.InDelta(100, healthy, 2)
+
+	// error burst: 100 -> 50 -> 25 -> 12.5 -> 6.25 -> 5 (min)
+	for i := 0; i < 5; i++ {
+		l.Feedback(false)
+	}
+	is.Equal(float64(5), l.Rate())
+	for l.Allow() {
+	}
+	degraded := allowedIn(l, clock, time.Second, time.Millisecond)
+	is.InDelta(5, degraded, 1)
+
+	// recovers additively on success, bounded by max
+	for i := 0; i < 10; i++ {
+		l.Feedback(true)
+	}
+	is.Equal(float64(105), l.Rate())
+	recovered := allowedIn(l, clock, time.Second, time.Millisecond)
+	is.Greater(recovered, degraded)
+	is.InDelta(105, recovered, 10)
+
+	for i := 0; i < 100; i++ {
+		l.Feedback(true)
+	}
+	is.Equal(float64(200), l.Rate())
+}
+
+func TestAdaptiveLimiterStats(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(3, 1, 3)
+	l.now = clock.Now
+	l.last = clock.Now()
+
+	// 初始令牌为3，之后的请求被拒绝
+	for i := 0; i < 5; i++ {
+		l.Allow()
+	}
+	allowed, denied := l.Stats()
+	is.Equal(uint64(3), allowed)
+	is.Equal(uint64(2), denied)
+
+	clock.Advance(time.Second)
+	is.True(l.Allow())
+	allowed, denied = l.Stats()
+	is.Equal(uint64(4), allowed)
+	is.Equal(uint64(2), denied)
+}
+
+func TestAdaptiveLimiterInitialTokens(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(10, 1, 10, WithInitialTokens(0))
+	l.now = clock.Now
+	l.last = clock.Now()
+
+	// 冷启动时不放行任何请求
+	is.False(l.Allow())
+
+	// 按每秒10个的速率积累令牌
+	clock.Advance(100 * time.Millisecond)
+	is.True(l.Allow())
+	is.False(l.Allow())
+
+	// 初始令牌数不超过桶容量
+	l = NewAdaptiveLimiter(2, 1, 2, WithInitialTokens(5))
+	l.now = clock.Now
+	l.last = clock.Now()
+	is.True(l.Allow())
+	is.True(l.Allow())
+	is.False(l.Allow())
+}
+
+func TestAdaptiveLimiterReset(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(3, 1, 3)
+	l.now = clock.Now
+	l.last = clock.Now()
+
+	for l.Allow() {
+	}
+	is.False(l.Allow())
+
+	// 重置后令牌补满，不需要等待积累
+	l.Reset()
+	for i := 0; i < 3; i++ {
+		is.True(l.Allow())
+	}
+	is.False(l.Allow())
+	is.Equal(float64(3), l.Rate())
+}
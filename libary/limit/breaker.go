@@ -0,0 +1,220 @@
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultCooldown         = time.Second * 10
+	defaultWindow           = time.Second * 10
+)
+
+// State 熔断器的状态
+type State int32
+
+const (
+	// StateClosed 关闭状态，请求正常放行
+	StateClosed State = iota
+	// StateOpen 打开状态，请求全部拒绝
+	StateOpen
+	// StateHalfOpen 半开状态，仅放行一个探测请求
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerOption 熔断器的选项
+type BreakerOption func(cb *CircuitBreaker)
+
+// WithConsecutiveFailures 设置连续失败多少次后熔断，小于等于0表示不按连续失败次数熔断
+func WithConsecutiveFailures(n int) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.failureThreshold = n
+	}
+}
+
+// WithFailureRatio 设置统计窗口内失败率达到 ratio 后熔断，窗口内请求数不足 minRequests 时不计算失败率
+func WithFailureRatio(ratio float64, minRequests int) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.failureRatio = ratio
+		cb.minRequests = minRequests
+	}
+}
+
+// WithCooldown 设置熔断打开后进入半开状态前的冷却时间
+func WithCooldown(d time.Duration) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.cooldown = d
+	}
+}
+
+// WithWindow 设置关闭状态下统计失败率的窗口大小
+func WithWindow(d time.Duration) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.window = d
+	}
+}
+
+// CircuitBreaker 熔断器，用于在依赖持续失败时快速拒绝请求，保护下游服务。
+// 关闭状态下统计失败情况，达到阈值后打开；冷却时间过后进入半开状态并放行一个探测请求，
+// 探测成功则关闭，失败则重新打开。
+type CircuitBreaker struct {
+	allowStats
+
+	mu sync.Mutex
+
+	failureThreshold int
+	failureRatio     float64
+	minRequests      int
+	cooldown         time.Duration
+	window           time.Duration
+
+	state               State
+	consecutiveFailures int
+	requests            int
+	failures            int
+	windowStart         time.Time
+	openedAt            time.Time
+	probing             bool
+	probeAt             time.Time
+
+	now func() time.Time
+}
+
+// NewCircuitBreaker 创建一个熔断器，默认连续失败5次熔断，冷却10秒
+func NewCircuitBreaker(opts ...BreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		failureThreshold: defaultFailureThreshold,
+		cooldown:         defaultCooldown,
+		window:           defaultWindow,
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	cb.windowStart = cb.now()
+	return cb
+}
+
+// Allow 判断当前请求是否可以放行
+func (cb *CircuitBreaker) Allow() bool {
+	return cb.record(cb.allow())
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case StateOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		// 冷却结束，进入半开状态并放行探测请求
+		cb.setState(StateHalfOpen)
+		cb.startProbe()
+		return true
+	case StateHalfOpen:
+		// 半开状态下同时只允许一个探测请求，探测请求超过冷却时间仍未上报结果时，
+		// 视为探测丢失并重新放行一个探测请求，避免调用方未上报导致永久拒绝
+		if cb.probing && cb.now().Sub(cb.probeAt) < cb.cooldown {
+			return false
+		}
+		cb.startProbe()
+		return true
+	default:
+		return true
+	}
+}
+
+// Report 上报请求的执行结果
+func (cb *CircuitBreaker) Report(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case StateHalfOpen:
+		if success {
+			cb.setState(StateClosed)
+		} else {
+			cb.setState(StateOpen)
+		}
+	case StateClosed:
+		now := cb.now()
+		if cb.window > 0 && now.Sub(cb.windowStart) >= cb.window {
+			cb.requests, cb.failures = 0, 0
+			cb.windowStart = now
+		}
+		cb.requests++
+		if success {
+			cb.consecutiveFailures = 0
+			return
+		}
+		cb.failures++
+		cb.consecutiveFailures++
+		if cb.shouldTrip() {
+			cb.setState(StateOpen)
+		}
+	}
+}
+
+// Reset 将熔断器恢复为关闭状态并清空失败统计，用于手动干预或测试。
+// Stats 统计不受影响
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.setState(StateClosed)
+}
+
+// State 返回熔断器当前的状态
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	// 冷却结束但还未有请求到来时，对外表现为半开状态
+	if cb.state == StateOpen && cb.now().Sub(cb.openedAt) >= cb.cooldown {
+		return StateHalfOpen
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) shouldTrip() bool {
+	if cb.failureThreshold > 0 && cb.consecutiveFailures >= cb.failureThreshold {
+		return true
+	}
+	if cb.failureRatio > 0 && cb.requests >= cb.minRequests && cb.requests > 0 {
+		return float64(cb.failures)/float64(cb.requests) >= cb.failureRatio
+	}
+	return false
+}
+
+// startProbe 标记探测请求已放行，调用方需持有锁
+func (cb *CircuitBreaker) startProbe() {
+	cb.probing = true
+	cb.probeAt = cb.now()
+}
+
+// setState 切换状态并重置统计信息，调用方需持有锁
+func (cb *CircuitBreaker) setState(state State) {
+	now := cb.now()
+	cb.state = state
+	cb.probing = false
+	cb.consecutiveFailures = 0
+	cb.requests, cb.failures = 0, 0
+	cb.windowStart = now
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+}
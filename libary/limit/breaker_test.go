@@ -0,0 +1,178 @@
+package limit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	cur time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{cur: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cur
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur = c.cur.Add(d)
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	cb := NewCircuitBreaker(WithConsecutiveFailures(3), WithCooldown(time.Second))
+	cb.now = clock.Now
+
+	// closed: a success in between resets the consecutive counter
+	for _, ok := range []bool{false, false, true, false, false} {
+		is.True(cb.Allow())
+		cb.Report(ok)
+	}
+	is.Equal(StateClosed, cb.State())
+
+	is.True(cb.Allow())
+	cb.Report(false)
+	is.Equal(StateOpen, cb.State())
+	is.False(cb.Allow())
+
+	// half-open after the cooldown, only one probe is let through
+	clock.Advance(time.Second)
+	is.Equal(StateHalfOpen, cb.State())
+	is.True(cb.Allow())
+	is.False(cb.Allow())
+
+	// failed probe opens the breaker again
+	cb.Report(false)
+	is.Equal(StateOpen, cb.State())
+	is.False(cb.Allow())
+
+	// successful probe closes the breaker
+	clock.Advance(time.Second)
+	is.True(cb.Allow())
+	cb.Report(true)
+	is.Equal(StateClosed, cb.State())
+	is.True(cb.Allow())
+	is.True(cb.Allow())
+}
+
+func TestCircuitBreakerLostProbe(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	cb := NewCircuitBreaker(WithConsecutiveFailures(1), WithCooldown(time.Second))
+	cb.now = clock.Now
+
+	is.True(cb.Allow())
+	cb.Report(false)
+	clock.Advance(time.Second)
+
+	// the probe is granted but its result is never reported
+	is.True(cb.Allow())
+	is.False(cb.Allow())
+	clock.Advance(time.Second / 2)
+	is.False(cb.Allow())
+
+	// once the cooldown has passed since the probe, a new probe is let through
+	clock.Advance(time.Second / 2)
+	is.True(cb.Allow())
+	is.False(cb.Allow())
+	cb.Report(true)
+	is.Equal(StateClosed, cb.State())
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	cb := NewCircuitBreaker(
+		WithConsecutiveFailures(0),
+		WithFailureRatio(0.5, 4),
+		WithWindow(time.Minute),
+	)
+	cb.now = clock.Now
+
+	// below minRequests the ratio is not evaluated
+	cb.Report(false)
+	cb.Report(false)
+	cb.Report(true)
+	is.Equal(StateClosed, cb.State())
+
+	// a new window drops the previous failures
+	clock.Advance(time.Minute)
+	cb.Report(true)
+	cb.Report(true)
+	cb.Report(true)
+	cb.Report(false)
+	is.Equal(StateClosed, cb.State())
+
+	cb.Report(false)
+	cb.Report(false)
+	is.Equal(StateOpen, cb.State())
+}
+
+func TestCircuitBreakerConcurrent(t *testing.T) {
+	cb := NewCircuitBreaker(WithConsecutiveFailures(10))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if cb.Allow() {
+					cb.Report(j%2 == 0)
+				}
+				_ = cb.State()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCircuitBreakerStats(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	cb := NewCircuitBreaker(WithConsecutiveFailures(1), WithCooldown(time.Second))
+	cb.now = clock.Now
+
+	is.True(cb.Allow())
+	cb.Report(false)
+	is.False(cb.Allow())
+	is.False(cb.Allow())
+	clock.Advance(time.Second)
+	is.True(cb.Allow())
+
+	allowed, denied := cb.Stats()
+	is.Equal(uint64(2), allowed)
+	is.Equal(uint64(2), denied)
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	cb := NewCircuitBreaker(WithConsecutiveFailures(2), WithCooldown(time.Minute))
+	cb.now = clock.Now
+
+	for i := 0; i < 2; i++ {
+		is.True(cb.Allow())
+		cb.Report(false)
+	}
+	is.Equal(StateOpen, cb.State())
+	is.False(cb.Allow())
+
+	// closed without waiting for the cooldown, and the failures before the reset are forgotten
+	cb.Reset()
+	is.Equal(StateClosed, cb.State())
+	is.True(cb.Allow())
+	cb.Report(false)
+	is.Equal(StateClosed, cb.State())
+}
@@ -0,0 +1,38 @@
+package limit
+
+// allLimiter 所有限流器都放行时才放行
+type allLimiter []Limiter
+
+// AllLimiter 组合多个限流器，所有限流器都放行时才放行，例如同时限制每秒和每分钟的请求数。
+// 按顺序检查，某个限流器拒绝后不再检查后面的限流器，避免后面的限流器被无效消耗；
+// 前面已经放行的限流器的消耗无法归还。没有限流器时总是放行
+func AllLimiter(limiters ...Limiter) Limiter {
+	return allLimiter(limiters)
+}
+
+func (limiters allLimiter) Allow() bool {
+	for _, limiter := range limiters {
+		if !limiter.Allow() {
+			return false
+		}
+	}
+	return true
+}
+
+// anyLimiter 任意一个限流器放行即放行
+type anyLimiter []Limiter
+
+// AnyLimiter 组合多个限流器，任意一个限流器放行即放行。
+// 按顺序检查，某个限流器放行后不再检查后面的限流器。没有限流器时总是拒绝
+func AnyLimiter(limiters ...Limiter) Limiter {
+	return anyLimiter(limiters)
+}
+
+func (limiters anyLimiter) Allow() bool {
+	for _, limiter := range limiters {
+		if limiter.Allow() {
+			return true
+		}
+	}
+	return false
+}
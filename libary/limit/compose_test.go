@@ -0,0 +1,59 @@
+package limit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingLimiter 放行前 n 次请求，并记录被调用的次数
+type countingLimiter struct {
+	n     int
+	calls int
+}
+
+func (l *countingLimiter) Allow() bool {
+	l.calls++
+	if l.n > 0 {
+		l.n--
+		return true
+	}
+	return false
+}
+
+func TestAllLimiter(t *testing.T) {
+	is := assert.New(t)
+	perSecond := &countingLimiter{n: 3}
+	perMinute := &countingLimiter{n: 2}
+	l := AllLimiter(perSecond, perMinute)
+
+	is.True(l.Allow())
+	is.True(l.Allow())
+	// perMinute 耗尽
+	is.False(l.Allow())
+	is.Equal(3, perMinute.calls)
+
+	// perSecond 耗尽后不再消耗 perMinute
+	is.False(l.Allow())
+	is.Equal(4, perSecond.calls)
+	is.Equal(3, perMinute.calls)
+
+	is.True(AllLimiter().Allow())
+}
+
+func TestAnyLimiter(t *testing.T) {
+	is := assert.New(t)
+	primary := &countingLimiter{n: 1}
+	fallback := &countingLimiter{n: 1}
+	l := AnyLimiter(primary, fallback)
+
+	// primary 放行时不检查 fallback
+	is.True(l.Allow())
+	is.Equal(0, fallback.calls)
+
+	is.True(l.Allow())
+	is.Equal(1, fallback.calls)
+	is.False(l.Allow())
+
+	is.False(AnyLimiter().Allow())
+}
@@ -0,0 +1,61 @@
+package limit
+
+import "context"
+
+// ConcurrencyLimiter 并发限制器，限制同时执行（在途）的请求数量
+type ConcurrencyLimiter struct {
+	sem chan struct{}
+}
+
+// NewConcurrencyLimiter 创建一个最多允许 max 个请求同时执行的限制器，max 小于1时按1处理
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max < 1 {
+		max = 1
+	}
+	return &ConcurrencyLimiter{
+		sem: make(chan struct{}, max),
+	}
+}
+
+// Acquire 获取一个执行名额，没有空闲名额时阻塞等待，ctx 取消时返回 ctx.Err()
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	// 优先检查 ctx，避免已取消的请求在有空闲名额时仍然获取成功
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryAcquire 非阻塞地获取一个执行名额，获取失败返回false
+func (l *ConcurrencyLimiter) TryAcquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release 归还一个执行名额，必须与成功的 Acquire/TryAcquire 成对调用
+func (l *ConcurrencyLimiter) Release() {
+	select {
+	case <-l.sem:
+	default:
+		panic("limit: Release called without a matching Acquire")
+	}
+}
+
+// InFlight 返回当前正在执行的请求数量
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.sem)
+}
+
+// Cap 返回允许同时执行的最大请求数量
+func (l *ConcurrencyLimiter) Cap() int {
+	return cap(l.sem)
+}
@@ -0,0 +1,75 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiterCap(t *testing.T) {
+	is := assert.New(t)
+	const max = 3
+	l := NewConcurrencyLimiter(max)
+
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			is.NoError(l.Acquire(context.Background()))
+			defer l.Release()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+	is.Equal(int32(max), atomic.LoadInt32(&peak))
+	is.Equal(0, l.InFlight())
+}
+
+func TestConcurrencyLimiterTryAcquire(t *testing.T) {
+	is := assert.New(t)
+	l := NewConcurrencyLimiter(2)
+	is.True(l.TryAcquire())
+	is.True(l.TryAcquire())
+	is.False(l.TryAcquire())
+	is.Equal(2, l.InFlight())
+
+	l.Release()
+	is.True(l.TryAcquire())
+	is.Panics(func() {
+		NewConcurrencyLimiter(1).Release()
+	})
+}
+
+func TestConcurrencyLimiterCancel(t *testing.T) {
+	is := assert.New(t)
+	l := NewConcurrencyLimiter(1)
+	is.NoError(l.Acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	begin := time.Now()
+	err := l.Acquire(ctx)
+	is.ErrorIs(err, context.DeadlineExceeded)
+	is.GreaterOrEqual(time.Since(begin), time.Millisecond*50)
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	l.Release()
+	// a cancelled context never takes the free slot
+	is.ErrorIs(l.Acquire(cancelled), context.Canceled)
+	is.Equal(0, l.InFlight())
+}
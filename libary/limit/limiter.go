@@ -0,0 +1,36 @@
+package limit
+
+import "github.com/longpi1/gopkg/libary/generic"
+
+// Limiter 限流器接口，Allow 返回 false 表示当前请求被拒绝
+type Limiter interface {
+	Allow() bool
+}
+
+var (
+	_ Limiter = (*AdaptiveLimiter)(nil)
+	_ Limiter = (*CircuitBreaker)(nil)
+	_ Limiter = (*FixedWindowCounter)(nil)
+	_ Limiter = (*ShardedFixedWindowCounter)(nil)
+)
+
+// allowStats 统计 Allow 放行和拒绝的次数，嵌入到限流器中提供 Stats 方法
+type allowStats struct {
+	allowed generic.Counter
+	denied  generic.Counter
+}
+
+// record 记录一次 Allow 的结果并原样返回
+func (s *allowStats) record(allowed bool) bool {
+	if allowed {
+		s.allowed.Inc()
+	} else {
+		s.denied.Inc()
+	}
+	return allowed
+}
+
+// Stats 返回 Allow 放行和拒绝的次数
+func (s *allowStats) Stats() (allowed, denied uint64) {
+	return s.allowed.Load(), s.denied.Load()
+}
@@ -0,0 +1,140 @@
+package limit
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FixedWindowCounter 固定窗口计数器，每个长度为 window 的时间窗口内最多放行 limit 个请求，
+// 窗口按 window 对齐，进入新窗口时计数清零。所有请求竞争同一把锁，高并发下可以使用 ShardedFixedWindowCounter
+type FixedWindowCounter struct {
+	allowStats
+
+	mu     sync.Mutex
+	limit  int64
+	window time.Duration
+	epoch  int64 // 当前窗口的序号，即 UnixNano / window
+	count  int64
+
+	now func() time.Time
+}
+
+// NewFixedWindowCounter 创建一个每个窗口最多放行 limit 个请求的计数器，window 不大于0时按1秒处理
+func NewFixedWindowCounter(limit int, window time.Duration) *FixedWindowCounter {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &FixedWindowCounter{
+		limit:  int64(limit),
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Allow 判断当前请求是否可以放行
+func (c *FixedWindowCounter) Allow() bool {
+	return c.record(c.allow())
+}
+
+func (c *FixedWindowCounter) allow() bool {
+	epoch := c.now().UnixNano() / int64(c.window)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.epoch != epoch {
+		c.epoch = epoch
+		c.count = 0
+	}
+	if c.count >= c.limit {
+		return false
+	}
+	c.count++
+	return true
+}
+
+// ShardedFixedWindowCounter 分片的固定窗口计数器，语义与 FixedWindowCounter 相同，
+// 计数分散到多个分片中，每次请求随机选择一个分片加锁，判断是否放行时无锁地汇总所有分片在当前窗口的计数，
+// 避免所有请求竞争同一把锁。
+//
+// 精度的取舍：不同分片上的请求可能同时读到总数 limit-1 并同时放行，
+// 因此一个窗口内放行的请求数最多可能超过 limit 分片数-1 个；请求数远小于 limit 时与单锁的版本一致
+type ShardedFixedWindowCounter struct {
+	shards []windowShard
+	limit  int64
+	window time.Duration
+
+	now func() time.Time
+}
+
+// windowShard 填充到缓存行大小，避免相邻分片伪共享
+type windowShard struct {
+	allowStats
+
+	mu    sync.Mutex
+	epoch atomic.Int64 // 分片计数所属窗口的序号
+	count atomic.Int64
+	_     [24]byte
+}
+
+// NewShardedFixedWindowCounter 创建一个每个窗口最多放行 limit 个请求的分片计数器，
+// shards 不大于0时使用 GOMAXPROCS 个分片，window 不大于0时按1秒处理
+func NewShardedFixedWindowCounter(limit int, window time.Duration, shards int) *ShardedFixedWindowCounter {
+	if window <= 0 {
+		window = time.Second
+	}
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	return &ShardedFixedWindowCounter{
+		shards: make([]windowShard, shards),
+		limit:  int64(limit),
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Allow 判断当前请求是否可以放行
+func (c *ShardedFixedWindowCounter) Allow() bool {
+	shard := &c.shards[rand.IntN(len(c.shards))]
+	return shard.record(c.allow(shard))
+}
+
+func (c *ShardedFixedWindowCounter) allow(shard *windowShard) bool {
+	epoch := c.now().UnixNano() / int64(c.window)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.epoch.Load() != epoch {
+		// 先清零再更新窗口，其它分片汇总时不会把上个窗口的计数算入当前窗口
+		shard.count.Store(0)
+		shard.epoch.Store(epoch)
+	}
+	if c.sum(epoch) >= c.limit {
+		return false
+	}
+	shard.count.Add(1)
+	return true
+}
+
+// sum 汇总所有分片在窗口 epoch 内的计数，尚未进入该窗口的分片计数为0
+func (c *ShardedFixedWindowCounter) sum(epoch int64) int64 {
+	var total int64
+	for i := range c.shards {
+		shard := &c.shards[i]
+		if shard.epoch.Load() == epoch {
+			total += shard.count.Load()
+		}
+	}
+	return total
+}
+
+// Stats 返回 Allow 放行和拒绝的次数，汇总所有分片
+func (c *ShardedFixedWindowCounter) Stats() (allowed, denied uint64) {
+	for i := range c.shards {
+		a, d := c.shards[i].Stats()
+		allowed += a
+		denied += d
+	}
+	return allowed, denied
+}
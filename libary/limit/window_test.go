@@ -0,0 +1,92 @@
+package limit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedWindowCounter(t *testing.T) {
+	is := assert.New(t)
+	clock := newFakeClock()
+	c := NewFixedWindowCounter(3, time.Second)
+	c.now = clock.Now
+
+	for i := 0; i < 3; i++ {
+		is.True(c.Allow())
+	}
+	is.False(c.Allow())
+
+	// the next window starts from zero
+	clock.Advance(time.Second)
+	is.True(c.Allow())
+	allowed, denied := c.Stats()
+	is.Equal(uint64(4), allowed)
+	is.Equal(uint64(1), denied)
+}
+
+func TestShardedFixedWindowCounter(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(uintptr(64), unsafe.Sizeof(windowShard{}))
+
+	clock := newFakeClock()
+	c := NewShardedFixedWindowCounter(100, time.Second, 8)
+	c.now = clock.Now
+
+	// sequential calls are exact
+	for i := 0; i < 100; i++ {
+		is.True(c.Allow())
+	}
+	is.False(c.Allow())
+
+	// shards left over from the previous window are not counted
+	clock.Advance(time.Second)
+	for i := 0; i < 100; i++ {
+		is.True(c.Allow())
+	}
+	is.False(c.Allow())
+	allowed, denied := c.Stats()
+	is.Equal(uint64(200), allowed)
+	is.Equal(uint64(2), denied)
+
+	// concurrent calls overshoot by less than the number of shards
+	clock.Advance(time.Second)
+	var passed int64
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if c.Allow() {
+					atomic.AddInt64(&passed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	is.GreaterOrEqual(passed, int64(100))
+	is.Less(passed, int64(100+8))
+}
+
+func BenchmarkFixedWindowCounter(b *testing.B) {
+	c := NewFixedWindowCounter(1<<62, time.Second)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Allow()
+		}
+	})
+}
+
+func BenchmarkShardedFixedWindowCounter(b *testing.B) {
+	c := NewShardedFixedWindowCounter(1<<62, time.Second, 0)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Allow()
+		}
+	})
+}
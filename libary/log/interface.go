@@ -0,0 +1,42 @@
+package log
+
+// Logger 组件内部诊断日志的最小接口，可注入自定义的结构化日志，*logrus.Logger 即实现了该接口
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// NopLogger 丢弃所有日志，作为组件默认的 Logger
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+
+func (nopLogger) Warnf(format string, args ...interface{}) {}
+
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// StdLogger 将日志输出到 NewLogger 初始化的全局日志，未初始化时丢弃日志
+var StdLogger Logger = stdLogger{}
+
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Debugf(format, args...)
+	}
+}
+
+func (stdLogger) Warnf(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Warnf(format, args...)
+	}
+}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Errorf(format, args...)
+	}
+}
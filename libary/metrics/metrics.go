@@ -0,0 +1,19 @@
+package metrics
+
+// Metrics 组件内部指标的最小接口，可适配到 Prometheus 等指标系统，各组件的指标名称遵循 Prometheus 的命名规范。
+// 同一组件的多个实例需要区分时，由实现方为每个实例附加标签
+type Metrics interface {
+	// IncCounter 计数器指标增加 v
+	IncCounter(name string, v float64)
+	// SetGauge 设置瞬时值指标为 v
+	SetGauge(name string, v float64)
+}
+
+// NopMetrics 丢弃所有指标，作为组件默认的 Metrics
+var NopMetrics Metrics = nopMetrics{}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncCounter(name string, v float64) {}
+
+func (nopMetrics) SetGauge(name string, v float64) {}
@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/hardware"
+)
+
+const (
+	// CPU 使用率低于 scaleUpCPUUsage 时扩容，高于 scaleDownCPUUsage 时缩容，两者之间保持不变
+	scaleUpCPUUsage   = 50.0
+	scaleDownCPUUsage = 80.0
+)
+
+// cpuUsage 返回 CPU 使用率（百分比），测试中可以替换
+var cpuUsage = hardware.GetCPUUsage
+
+// EnableAutoScale 开启按 CPU 使用率自动调整worker数量，适用于批处理等 CPU 密集的场景：
+// 每隔 interval 读取一次 CPU 使用率，低于50%时扩容，高于80%时缩容，每次调整当前容量的1/4（至少为1），
+// 容量始终在 [min, max] 之间。再次调用会替换之前的设置，Release 时自动停止。
+// 预分配worker的池不能调整容量，返回错误
+func (pool *Pool[T]) EnableAutoScale(min, max int, interval time.Duration) error {
+	if pool.opt.preAlloc {
+		return fmt.Errorf("cannot auto scale pre-alloc pool")
+	}
+	if min <= 0 || max < min || interval <= 0 {
+		return fmt.Errorf("invalid auto scale range [%d, %d] or interval %v", min, max, interval)
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	pool.scaleLock.Lock()
+	previous := pool.stopScale
+	pool.stopScale = func() {
+		close(stop)
+		<-done
+	}
+	pool.scaleLock.Unlock()
+	if previous != nil {
+		previous()
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				pool.autoScale(min, max)
+			}
+		}
+	}()
+	return nil
+}
+
+// DisableAutoScale 停止自动调整worker数量，保留当前容量
+func (pool *Pool[T]) DisableAutoScale() {
+	pool.scaleLock.Lock()
+	stop := pool.stopScale
+	pool.stopScale = nil
+	pool.scaleLock.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// autoScale 按当前 CPU 使用率调整一次容量
+func (pool *Pool[T]) autoScale(min, max int) {
+	if pool.inner.IsClosed() {
+		return
+	}
+	usage := cpuUsage()
+	cap := pool.Cap()
+	size := scaleSize(cap, usage, min, max)
+	if size == cap {
+		return
+	}
+	if err := pool.Resize(size); err != nil {
+		pool.opt.logger.Errorf("pool: auto scale to %d failed: %v", size, err)
+		return
+	}
+	pool.opt.logger.Debugf("pool: cpu usage %.1f%%, resized from %d to %d", usage, cap, size)
+}
+
+// scaleSize 根据 CPU 使用率计算新的容量
+func scaleSize(cap int, usage float64, min, max int) int {
+	step := (cap + 3) / 4
+	if step < 1 {
+		step = 1
+	}
+	switch {
+	case usage < scaleUpCPUUsage:
+		cap += step
+	case usage > scaleDownCPUUsage:
+		cap -= step
+	}
+	if cap < min {
+		return min
+	}
+	if cap > max {
+		return max
+	}
+	return cap
+}
@@ -0,0 +1,57 @@
+package pool
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleSize(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(5, scaleSize(4, 10, 1, 16))
+	is.Equal(3, scaleSize(4, 90, 1, 16))
+	is.Equal(4, scaleSize(4, 60, 1, 16))
+	is.Equal(16, scaleSize(15, 10, 1, 16))
+	is.Equal(2, scaleSize(2, 99, 2, 16))
+	is.Equal(2, scaleSize(1, 10, 1, 16))
+}
+
+func TestPoolAutoScale(t *testing.T) {
+	is := assert.New(t)
+	var usage atomic.Uint64
+	setUsage := func(v float64) { usage.Store(math.Float64bits(v)) }
+	old := cpuUsage
+	cpuUsage = func() float64 { return math.Float64frombits(usage.Load()) }
+	defer func() { cpuUsage = old }()
+
+	pool := NewPool[any](4)
+	defer pool.Release()
+
+	// underutilized: grows up to max
+	setUsage(10)
+	is.NoError(pool.EnableAutoScale(2, 10, time.Millisecond))
+	is.Eventually(func() bool { return pool.Cap() == 10 }, time.Second, time.Millisecond)
+
+	// in the middle band: unchanged
+	setUsage(60)
+	time.Sleep(20 * time.Millisecond)
+	is.Equal(10, pool.Cap())
+
+	// under pressure: shrinks down to min
+	setUsage(95)
+	is.Eventually(func() bool { return pool.Cap() == 2 }, time.Second, time.Millisecond)
+
+	// stopped: keeps the current size
+	pool.DisableAutoScale()
+	setUsage(10)
+	time.Sleep(20 * time.Millisecond)
+	is.Equal(2, pool.Cap())
+
+	is.Error(pool.EnableAutoScale(5, 2, time.Millisecond))
+	preAlloc := NewPool[any](2, WithPreAlloc(true))
+	defer preAlloc.Release()
+	is.Error(preAlloc.EnableAutoScale(1, 4, time.Millisecond))
+}
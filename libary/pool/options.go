@@ -19,9 +19,8 @@ package pool
 import (
 	"time"
 
-	"go.uber.org/zap"
-
 	"github.com/longpi1/gopkg/libary/log"
+	"github.com/longpi1/gopkg/libary/metrics"
 	"github.com/panjf2000/ants/v2"
 )
 
@@ -41,6 +40,18 @@ type poolOption struct {
 
 	// preHandler function executed before actual method executed
 	preHandler func()
+
+	// scaleFactor multiplies the detected cpu quota in NewContainerAwarePool
+	scaleFactor float64
+
+	// logger receives submit failures and task panics
+	logger log.Logger
+
+	// max number of callers blocked on submit, 0 means unlimited for Submit
+	maxPendingTasks int
+
+	// metrics receives the submitted counter and the running/free gauges
+	metrics metrics.Metrics
 }
 
 func (opt *poolOption) antsOptions() []ants.Option {
@@ -48,10 +59,11 @@ func (opt *poolOption) antsOptions() []ants.Option {
 	result = append(result, ants.WithPreAlloc(opt.preAlloc))
 	result = append(result, ants.WithNonblocking(opt.nonBlocking))
 	result = append(result, ants.WithDisablePurge(opt.disablePurge))
+	result = append(result, ants.WithMaxBlockingTasks(opt.maxPendingTasks))
 	// ants recovers panic by default
 	// however the error is not returned
 	result = append(result, ants.WithPanicHandler(func(v any) {
-		log.Error("Conc pool panicked", zap.Any("panic", v))
+		opt.logger.Errorf("pool: task panicked: %v", v)
 		if !opt.concealPanic {
 			panic(v)
 		}
@@ -76,6 +88,9 @@ func defaultPoolOption() *poolOption {
 		expiryDuration: 0,
 		disablePurge:   false,
 		concealPanic:   false,
+		scaleFactor:    1,
+		logger:         log.NopLogger,
+		metrics:        metrics.NopMetrics,
 	}
 }
 
@@ -114,3 +129,41 @@ func WithPreHandler(fn func()) PoolOption {
 		opt.preHandler = fn
 	}
 }
+
+// WithMaxPendingTasks bounds the number of tasks waiting for a free worker,
+// Submit beyond the bound fails with ants.ErrPoolOverload and TrySubmit returns false
+func WithMaxPendingTasks(n int) PoolOption {
+	return func(opt *poolOption) {
+		if n >= 0 {
+			opt.maxPendingTasks = n
+		}
+	}
+}
+
+// WithLogger sets the logger receiving submit failures and task panics, defaults to no-op
+func WithLogger(logger log.Logger) PoolOption {
+	return func(opt *poolOption) {
+		if logger != nil {
+			opt.logger = logger
+		}
+	}
+}
+
+// WithMetrics sets the collector receiving MetricSubmitted on each accepted submit,
+// and MetricRunning and MetricFree when a task is submitted or finishes, defaults to no-op
+func WithMetrics(m metrics.Metrics) PoolOption {
+	return func(opt *poolOption) {
+		if m != nil {
+			opt.metrics = m
+		}
+	}
+}
+
+// WithScaleFactor multiplies the detected cpu quota when sizing a NewContainerAwarePool
+func WithScaleFactor(f float64) PoolOption {
+	return func(opt *poolOption) {
+		if f > 0 {
+			opt.scaleFactor = f
+		}
+	}
+}
@@ -17,10 +17,14 @@
 package pool
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	_ "strconv"
 	"sync"
+	"time"
 
 	ants "github.com/panjf2000/ants/v2"
 
@@ -29,10 +33,32 @@ import (
 	"github.com/longpi1/gopkg/libary/hardware"
 )
 
+const (
+	// minSubmitBackoff 和 maxSubmitBackoff 为 SubmitBefore 重试提交的等待间隔范围
+	minSubmitBackoff = 100 * time.Microsecond
+	maxSubmitBackoff = 10 * time.Millisecond
+)
+
+// ErrPoolSaturated 在截止时间前没有空闲worker，SubmitBefore 返回该错误，调用方可以转换为 503 等过载响应
+var ErrPoolSaturated = errors.New("pool: saturated, no free worker before the deadline")
+
+// WithMetrics 上报的指标名称
+const (
+	// MetricSubmitted 成功提交的任务数量，计数器
+	MetricSubmitted = "pool_submitted_total"
+	// MetricRunning 正在运行的工作者数量
+	MetricRunning = "pool_running"
+	// MetricFree 空闲工作者的数量
+	MetricFree = "pool_free"
+)
+
 // A goroutine pool
 type Pool[T any] struct {
 	inner *ants.Pool  // 使用ants包中的Pool来管理协程
 	opt   *poolOption // 池的配置选项
+
+	scaleLock sync.Mutex
+	stopScale func() // 停止自动扩缩容，未开启时为 nil
 }
 
 // NewPool 返回一个新的协程池。
@@ -62,6 +88,22 @@ func NewDefaultPool[T any]() *Pool[T] {
 	return NewPool[T](hardware.GetCPUNum(), WithPreAlloc(true))
 }
 
+// NewContainerAwarePool 返回一个按容器实际CPU配额设置worker数量的池，并且预分配协程。
+// worker数量为 CPU配额 * WithScaleFactor 设置的系数，向上取整且至少为1。
+func NewContainerAwarePool[T any](opts ...PoolOption) *Pool[T] {
+	opt := defaultPoolOption()
+	for _, o := range opts {
+		o(opt)
+	}
+	return NewPool[T](containerAwareCap(hardware.GetContainerCPUQuota(), opt.scaleFactor),
+		append([]PoolOption{WithPreAlloc(true)}, opts...)...)
+}
+
+// containerAwareCap 根据CPU配额和系数计算worker数量
+func containerAwareCap(quota, factor float64) int {
+	return max(int(math.Ceil(quota*factor)), 1)
+}
+
 // Submit 将一个任务提交到池中并异步执行。
 // 如果池的worker数量有限且没有空闲worker，该方法将阻塞。
 // 注意：由于当前Go不支持泛型成员方法，我们使用Future[any]
@@ -69,6 +111,7 @@ func (pool *Pool[T]) Submit(method func() (T, error)) *future.Future[T] {
 	future := future.NewFuture[T]()
 	err := pool.inner.Submit(func() {
 		defer close(future.Ch) // 确保任务完成后关闭通道
+		defer pool.reportWorkers()
 		defer func() {
 			if x := recover(); x != nil {
 				future.Err = fmt.Errorf("panicked with error: %v", x)
@@ -86,13 +129,83 @@ func (pool *Pool[T]) Submit(method func() (T, error)) *future.Future[T] {
 		future.Value = res
 	})
 	if err != nil {
+		pool.opt.logger.Errorf("pool: submit failed: %v", err)
 		future.Err = err
 		close(future.Ch)
+		return future
 	}
+	pool.opt.metrics.IncCounter(MetricSubmitted, 1)
+	pool.reportWorkers()
 
 	return future
 }
 
+// reportWorkers 上报正在运行和空闲的工作者数量
+func (pool *Pool[T]) reportWorkers() {
+	pool.opt.metrics.SetGauge(MetricRunning, float64(pool.inner.Running()))
+	pool.opt.metrics.SetGauge(MetricFree, float64(pool.inner.Free()))
+}
+
+// SubmitAll 按顺序提交所有任务，返回的 Future 与 methods 一一对应，不等待任务完成。
+// 与 Submit 一样，没有空闲worker时会阻塞，直到剩余的任务都提交到池中。
+func (pool *Pool[T]) SubmitAll(methods []func() (T, error)) []*future.Future[T] {
+	futures := make([]*future.Future[T], 0, len(methods))
+	for _, method := range methods {
+		futures = append(futures, pool.Submit(method))
+	}
+	return futures
+}
+
+// TrySubmit 与 Submit 相同，但在没有空闲worker且等待队列已满时立即返回false，而不是阻塞。
+// 等待队列的长度由 WithMaxPendingTasks 设置，默认为0，即没有空闲worker时直接返回false；
+// 进入等待队列的任务与 Submit 一样阻塞到有空闲worker为止。
+func (pool *Pool[T]) TrySubmit(method func() (T, error)) (*future.Future[T], bool) {
+	if !pool.opt.nonBlocking && pool.inner.Free() == 0 && pool.inner.Waiting() >= pool.opt.maxPendingTasks {
+		return nil, false
+	}
+	future := pool.Submit(method)
+	// 非阻塞模式或并发提交时由 ants 判定是否过载
+	if isClosed(future.Inner()) && errors.Is(future.Err, ants.ErrPoolOverload) {
+		return nil, false
+	}
+	return future, true
+}
+
+// SubmitBefore 在截止时间前不断尝试以不阻塞的方式提交任务：有空闲worker时提交，
+// 否则按指数退避等待后重试，截止时间前仍没有空闲worker时返回 ErrPoolSaturated，池已释放时返回 ants.ErrPoolClosed。
+// 与 TrySubmit 不同，任务不会进入等待队列；并发提交时提交前刚被占用的worker仍可能让 Submit 短暂阻塞
+func (pool *Pool[T]) SubmitBefore(deadline time.Time, method func() (T, error)) (*future.Future[T], error) {
+	backoff := minSubmitBackoff
+	for {
+		if pool.inner.IsClosed() {
+			return nil, ants.ErrPoolClosed
+		}
+		if pool.opt.nonBlocking || pool.inner.Free() > 0 {
+			future := pool.Submit(method)
+			// 非阻塞模式下由 ants 判定是否过载
+			if !isClosed(future.Inner()) || !errors.Is(future.Err, ants.ErrPoolOverload) {
+				return future, nil
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrPoolSaturated
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, maxSubmitBackoff)
+	}
+}
+
+// isClosed 非阻塞地判断通道是否已关闭
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
 // Cap 返回工作者的数量
 func (pool *Pool[T]) Cap() int {
 	return pool.inner.Cap()
@@ -110,6 +223,7 @@ func (pool *Pool[T]) Free() int {
 
 // Release 释放池中所有工作者，停止所有的协程。
 func (pool *Pool[T]) Release() {
+	pool.DisableAutoScale()
 	pool.inner.Release()
 }
 
@@ -143,3 +257,63 @@ func WarmupPool[T any](pool *Pool[T], warmup func()) {
 	wg.Wait()
 	close(ch)
 }
+
+// WarmupPoolContext 与 WarmupPool 相同，对池中的每个协程执行一次预热逻辑，但可以通过 ctx 取消。
+// 所有预热完成后返回nil；任意一次预热失败时返回第一个错误；ctx 取消时返回 ctx.Err()。
+// 提前返回时尚未开始的预热不再执行。
+func WarmupPoolContext[T any](pool *Pool[T], ctx context.Context, warmup func() error) error {
+	cap := pool.Cap()
+	release := make(chan struct{})
+	defer close(release) // 释放所有等待中的协程
+	results := make(chan error, cap)
+	go func() {
+		for i := 0; i < cap; i++ {
+			if isClosed(release) {
+				return
+			}
+			future := pool.Submit(func() (T, error) {
+				if isClosed(release) {
+					return generic.Zero[T](), nil
+				}
+				results <- warmup()
+				<-release // 等待，直到所有预热完成，保证每个协程只执行一次预热
+				return generic.Zero[T](), nil
+			})
+			// 提交失败时任务不会执行
+			if isClosed(future.Inner()) && future.Err != nil {
+				results <- future.Err
+			}
+		}
+	}()
+	for i := 0; i < cap; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// MapReduce 使用协程池并发执行 mapper，同时执行的 mapper 数量不超过池的worker数量，
+// 所有 mapper 完成后按 items 的顺序将结果交给 reducer 合并。
+// 任意 mapper 失败时返回按 items 顺序的第一个错误，不再调用 reducer。
+func MapReduce[T, R, O any](pool *Pool[R], items []T, mapper func(T) (R, error), reducer func([]R) (O, error)) (O, error) {
+	futures := make([]*future.Future[R], 0, len(items))
+	for _, item := range items {
+		futures = append(futures, pool.Submit(func() (R, error) {
+			return mapper(item)
+		}))
+	}
+	if err := future.AwaitAll(futures...); err != nil {
+		return generic.Zero[O](), err
+	}
+	results := make([]R, 0, len(futures))
+	for _, f := range futures {
+		results = append(results, f.Value)
+	}
+	return reducer(results)
+}
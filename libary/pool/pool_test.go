@@ -17,11 +17,17 @@
 package pool
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/longpi1/gopkg/libary/future"
 	"github.com/longpi1/gopkg/libary/hardware"
+	ants "github.com/panjf2000/ants/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,3 +93,309 @@ func TestPoolWithPanic(t *testing.T) {
 	_, err := future.Await()
 	assert.Error(t, err)
 }
+
+func TestContainerAwarePool(t *testing.T) {
+	quota := hardware.GetContainerCPUQuota()
+
+	pool := NewContainerAwarePool[any]()
+	defer pool.Release()
+	assert.Equal(t, int(math.Ceil(quota)), pool.Cap())
+
+	scaled := NewContainerAwarePool[any](WithScaleFactor(2.5))
+	defer scaled.Release()
+	assert.Equal(t, int(math.Ceil(quota*2.5)), scaled.Cap())
+
+	assert.Equal(t, 3, containerAwareCap(1.5, 2))
+	assert.Equal(t, 2, containerAwareCap(1.5, 1))
+	assert.Equal(t, 1, containerAwareCap(0.2, 1))
+}
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) { l.record("debug", format, args...) }
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) { l.record("warn", format, args...) }
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) { l.record("error", format, args...) }
+
+func (l *recordLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestPoolWithLogger(t *testing.T) {
+	logger := &recordLogger{}
+	pool := NewPool[any](1, WithLogger(logger))
+	pool.Release()
+
+	_, err := pool.Submit(func() (any, error) { return nil, nil }).Await()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"error pool: submit failed: " + err.Error()}, logger.Lines())
+
+	logger = &recordLogger{}
+	pool = NewPool[any](1, WithLogger(logger), WithConcealPanic(true))
+	defer pool.Release()
+	_, err = pool.Submit(func() (any, error) { panic("boom") }).Await()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"error pool: task panicked: boom"}, logger.Lines())
+}
+
+func TestPoolTrySubmit(t *testing.T) {
+	pool := NewPool[any](2, WithMaxPendingTasks(1))
+	defer pool.Release()
+
+	block := make(chan struct{})
+	task := func() (any, error) {
+		<-block
+		return nil, nil
+	}
+	for i := 0; i < 2; i++ {
+		_, ok := pool.TrySubmit(task)
+		assert.True(t, ok)
+	}
+
+	// the third task waits in the pending queue
+	queued := make(chan *future.Future[any])
+	go func() {
+		f, ok := pool.TrySubmit(task)
+		assert.True(t, ok)
+		queued <- f
+	}()
+	assert.Eventually(t, func() bool { return pool.inner.Waiting() == 1 }, time.Second, time.Millisecond)
+
+	// the pending queue is full
+	f, ok := pool.TrySubmit(task)
+	assert.False(t, ok)
+	assert.Nil(t, f)
+
+	close(block)
+	assert.NoError(t, (<-queued).GetErr())
+	f, ok = pool.TrySubmit(task)
+	assert.True(t, ok)
+	assert.NoError(t, f.GetErr())
+}
+
+func TestPoolTrySubmitNonBlocking(t *testing.T) {
+	pool := NewPool[any](1, WithNonBlocking(true))
+	defer pool.Release()
+
+	block := make(chan struct{})
+	defer close(block)
+	_, ok := pool.TrySubmit(func() (any, error) {
+		<-block
+		return nil, nil
+	})
+	assert.True(t, ok)
+	_, ok = pool.TrySubmit(func() (any, error) { return nil, nil })
+	assert.False(t, ok)
+}
+
+func TestPoolSubmitAll(t *testing.T) {
+	pool := NewPool[int](4)
+	defer pool.Release()
+
+	methods := make([]func() (int, error), 0, 20)
+	for i := 0; i < 20; i++ {
+		methods = append(methods, func() (int, error) {
+			// later tasks finish first
+			time.Sleep(time.Duration(20-i) * time.Millisecond)
+			return i, nil
+		})
+	}
+	futures := pool.SubmitAll(methods)
+	assert.Len(t, futures, 20)
+	assert.NoError(t, future.AwaitAll(futures...))
+	for i, f := range futures {
+		assert.Equal(t, i, f.GetValue())
+	}
+}
+
+func TestWarmupPoolContext(t *testing.T) {
+	pool := NewPool[any](4)
+	defer pool.Release()
+
+	var lock sync.Mutex
+	warmed := 0
+	err := WarmupPoolContext(pool, context.Background(), func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		warmed++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, warmed)
+
+	// the first warmup error is returned
+	errWarmup := errors.New("warmup failed")
+	err = WarmupPoolContext(pool, context.Background(), func() error {
+		return errWarmup
+	})
+	assert.ErrorIs(t, err, errWarmup)
+
+	// a warmup that never finishes is aborted by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	err = WarmupPoolContext(pool, ctx, func() error {
+		<-block
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMapReduce(t *testing.T) {
+	pool := NewPool[int](8)
+	defer pool.Release()
+
+	items := make([]int, 10000)
+	want := 0
+	for i := range items {
+		items[i] = i
+		want += i * i
+	}
+	square := func(i int) (int, error) {
+		return i * i, nil
+	}
+	sum := func(squares []int) (int, error) {
+		total := 0
+		for _, square := range squares {
+			total += square
+		}
+		return total, nil
+	}
+	got, err := MapReduce(pool, items, square, sum)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// the first mapper error is returned and the reducer is skipped
+	errOdd := errors.New("odd")
+	reduced := false
+	_, err = MapReduce(pool, []int{2, 3, 4}, func(i int) (int, error) {
+		if i%2 == 1 {
+			return 0, errOdd
+		}
+		return i, nil
+	}, func(results []int) (int, error) {
+		reduced = true
+		return 0, nil
+	})
+	assert.ErrorIs(t, err, errOdd)
+	assert.False(t, reduced)
+}
+
+// recordMetrics records the last gauge values and the counter sums
+type recordMetrics struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{counters: make(map[string]float64), gauges: make(map[string]float64)}
+}
+
+func (m *recordMetrics) IncCounter(name string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += v
+}
+
+func (m *recordMetrics) SetGauge(name string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = v
+}
+
+func (m *recordMetrics) Counter(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+func (m *recordMetrics) Gauge(name string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.gauges[name]
+	return v, ok
+}
+
+func TestPoolWithMetrics(t *testing.T) {
+	is := assert.New(t)
+	m := newRecordMetrics()
+	pool := NewPool[any](2, WithMetrics(m))
+
+	block := make(chan struct{})
+	var futures []*future.Future[any]
+	for i := 0; i < 2; i++ {
+		futures = append(futures, pool.Submit(func() (any, error) {
+			<-block
+			return nil, nil
+		}))
+	}
+	is.Equal(float64(2), m.Counter(MetricSubmitted))
+	running, ok := m.Gauge(MetricRunning)
+	is.True(ok)
+	is.Equal(float64(2), running)
+	free, ok := m.Gauge(MetricFree)
+	is.True(ok)
+	is.Equal(float64(0), free)
+
+	close(block)
+	for _, f := range futures {
+		_, err := f.Await()
+		is.NoError(err)
+	}
+
+	// rejected submits are not counted
+	pool.Release()
+	_, err := pool.Submit(func() (any, error) { return nil, nil }).Await()
+	is.Error(err)
+	is.Equal(float64(2), m.Counter(MetricSubmitted))
+}
+
+func TestPoolSubmitBefore(t *testing.T) {
+	is := assert.New(t)
+	for _, nonBlocking := range []bool{false, true} {
+		pool := NewPool[int](2, WithNonBlocking(nonBlocking))
+
+		block := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			_, err := pool.SubmitBefore(time.Now().Add(time.Second), func() (int, error) {
+				<-block
+				return 0, nil
+			})
+			is.NoError(err)
+		}
+
+		// saturated until the deadline
+		start := time.Now()
+		f, err := pool.SubmitBefore(start.Add(50*time.Millisecond), func() (int, error) { return 1, nil })
+		is.ErrorIs(err, ErrPoolSaturated)
+		is.Nil(f)
+		is.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+		is.Less(time.Since(start), time.Second)
+
+		// a worker frees up before the deadline
+		time.AfterFunc(20*time.Millisecond, func() { close(block) })
+		f, err = pool.SubmitBefore(time.Now().Add(time.Second), func() (int, error) { return 1, nil })
+		is.NoError(err)
+		v, err := f.Await()
+		is.NoError(err)
+		is.Equal(1, v)
+
+		pool.Release()
+		_, err = pool.SubmitBefore(time.Now().Add(time.Second), func() (int, error) { return 1, nil })
+		is.ErrorIs(err, ants.ErrPoolClosed)
+	}
+}
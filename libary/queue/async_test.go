@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/longpi1/gopkg/libary/future"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendMsgAsyncMemory(t *testing.T) {
+	is := assert.New(t)
+	p, _ := RegisterMemoryProducer()
+	c, _ := RegisterMemoryConsumer()
+
+	topic := uniqueTopic("memory-async")
+	received := make(chan Msg, 10)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { received <- msg }))
+
+	futures := make([]*future.Future[Msg], 0, 10)
+	for i := 0; i < 10; i++ {
+		futures = append(futures, p.SendMsgAsync(context.Background(), topic, fmt.Sprint(i)))
+	}
+	is.NoError(future.AwaitAll(futures...))
+	for i := 0; i < 10; i++ {
+		msg := <-received
+		is.Equal(fmt.Sprint(i), msg.BodyString())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	is.ErrorIs(p.SendMsgAsync(ctx, topic, "canceled").GetErr(), context.Canceled)
+}
+
+func TestSendMsgAsyncKafka(t *testing.T) {
+	is := assert.New(t)
+	conf := sarama.NewConfig()
+	conf.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, conf)
+	errSend := errors.New("send failed")
+	producer.ExpectInputAndSucceed().ExpectInputAndSucceed().ExpectInputAndFail(errSend)
+
+	k := &Kafka{producerIns: producer}
+	go k.dispatchResults()
+
+	futures := []*future.Future[Msg]{
+		k.SendMsgAsync(context.Background(), "topic", "a"),
+		k.SendMsgAsync(context.Background(), "topic", "b"),
+	}
+	is.NoError(future.AwaitAll(futures...))
+	for _, f := range futures {
+		is.Equal("topic", f.GetValue().Topic)
+		is.Equal(SendMsg, f.GetValue().RunType)
+	}
+
+	failed := k.SendMsgAsync(context.Background(), "topic", "c")
+	is.ErrorIs(failed.GetErr(), errSend)
+	is.NoError(producer.Close())
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/longpi1/gopkg/libary/future"
+	"github.com/pierrec/lz4/v4"
+)
+
+// 消息压缩算法
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLz4    = "lz4"
+)
+
+// HeaderContentEncoding 消息体被压缩时记录压缩算法的消息头，消费端据此解压
+const HeaderContentEncoding = "content-encoding"
+
+// validateCompression 校验压缩算法，空字符串等同于 CompressionNone
+func validateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip, CompressionSnappy, CompressionLz4:
+		return nil
+	}
+	return fmt.Errorf("queue compression %q is not support", compression)
+}
+
+// compressBody 按指定算法压缩消息体
+func compressBody(compression string, body []byte) ([]byte, error) {
+	switch compression {
+	case "", CompressionNone:
+		return body, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, body), nil
+	}
+
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionLz4:
+		w = lz4.NewWriter(&buf)
+	default:
+		return nil, validateCompression(compression)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressBody 按指定算法解压消息体
+func decompressBody(compression string, body []byte) ([]byte, error) {
+	switch compression {
+	case "", CompressionNone:
+		return body, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, body)
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionLz4:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(body)))
+	}
+	return nil, validateCompression(compression)
+}
+
+// compressProducer 在应用层压缩消息体，并通过 HeaderContentEncoding 消息头告知消费端，
+// 用于不支持对应压缩算法的驱动。延迟消息无法携带消息头，不做压缩
+type compressProducer struct {
+	Producer
+	compression string
+}
+
+// SendMsg 按字符串类型生产数据
+func (p *compressProducer) SendMsg(topic string, body string) (msg Msg, err error) {
+	return p.SendByteMsg(topic, []byte(body))
+}
+
+// SendByteMsg 生产数据
+func (p *compressProducer) SendByteMsg(topic string, body []byte) (msg Msg, err error) {
+	return p.SendHeaderMsg(topic, body, nil)
+}
+
+// SendMsgAsync 异步生产压缩后的数据
+func (p *compressProducer) SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg] {
+	return future.Go(func() (Msg, error) {
+		if err := ctx.Err(); err != nil {
+			return Msg{}, err
+		}
+		return p.SendMsg(topic, body)
+	})
+}
+
+// SendHeaderMsg 压缩消息体后生产带消息头的数据
+func (p *compressProducer) SendHeaderMsg(topic string, body []byte, headers map[string]string) (msg Msg, err error) {
+	compressed, err := compressBody(p.compression, body)
+	if err != nil {
+		return msg, err
+	}
+	withEncoding := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		withEncoding[key] = value
+	}
+	withEncoding[HeaderContentEncoding] = p.compression
+	return p.Producer.SendHeaderMsg(topic, compressed, withEncoding)
+}
+
+// decompressConsumer 根据 HeaderContentEncoding 消息头透明地解压消息体
+type decompressConsumer struct {
+	Consumer
+}
+
+// ListenReceiveMsgDo 消费数据，回调收到的是解压后的消息
+func (c *decompressConsumer) ListenReceiveMsgDo(topic string, receiveDo func(msg Msg)) (err error) {
+	return c.Consumer.ListenReceiveMsgDo(topic, func(msg Msg) {
+		receiveDo(decompressMsg(msg))
+	})
+}
+
+// ListenReceiveMsgDoContext 消费数据直到 ctx 取消，回调收到的是解压后的消息
+func (c *decompressConsumer) ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(msg Msg)) (done <-chan struct{}, err error) {
+	return c.Consumer.ListenReceiveMsgDoContext(ctx, topic, func(msg Msg) {
+		receiveDo(decompressMsg(msg))
+	})
+}
+
+// decompressMsg 解压消息体并移除 HeaderContentEncoding 消息头，解压失败时原样返回
+func decompressMsg(msg Msg) Msg {
+	compression, ok := msg.Headers[HeaderContentEncoding]
+	if !ok {
+		return msg
+	}
+	body, err := decompressBody(compression, msg.Body)
+	if err != nil {
+		getLogger().Errorf("消费队列：%s 消息解压失败, compression:%s, err:%+v", msg.Topic, compression, err)
+		return msg
+	}
+	headers := make(map[string]string, len(msg.Headers))
+	for key, value := range msg.Headers {
+		if key != HeaderContentEncoding {
+			headers[key] = value
+		}
+	}
+	if len(headers) == 0 {
+		headers = nil
+	}
+	msg.Body = body
+	msg.Headers = headers
+	return msg
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	is := assert.New(t)
+	body := bytes.Repeat([]byte(`{"name":"gopkg","tags":["queue","compression"]}`), 100)
+
+	for _, compression := range []string{CompressionGzip, CompressionSnappy, CompressionLz4} {
+		compressed, err := compressBody(compression, body)
+		is.NoError(err, compression)
+		is.Less(len(compressed), len(body), compression)
+
+		msg := decompressMsg(Msg{
+			Body:    compressed,
+			Headers: map[string]string{HeaderContentEncoding: compression, "trace-id": "abc"},
+		})
+		is.Equal(body, msg.Body, compression)
+		is.Equal(map[string]string{"trace-id": "abc"}, msg.Headers, compression)
+	}
+
+	_, err := compressBody("zip", body)
+	is.Error(err)
+
+	// a message without the header is passed through
+	msg := decompressMsg(Msg{Body: body})
+	is.Equal(body, msg.Body)
+}
+
+func TestCompressionMemoryDriver(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test", Compression: CompressionGzip}
+	p, err := NewProducer(cfg)
+	is.NoError(err)
+	c, err := NewConsumer(cfg)
+	is.NoError(err)
+
+	topic := uniqueTopic("memory-compression")
+	received := make(chan Msg, 1)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { received <- msg }))
+	sent, err := p.SendMsg(topic, "payload")
+	is.NoError(err)
+	is.Equal(CompressionGzip, sent.Headers[HeaderContentEncoding])
+	is.NotEqual("payload", sent.BodyString())
+
+	select {
+	case msg := <-received:
+		is.Equal("payload", msg.BodyString())
+		is.Empty(msg.Headers)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	cfg.Compression = "zip"
+	_, err = NewProducer(cfg)
+	is.Error(err)
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/spf13/viper"
+)
+
+// LoadConfig 从 yaml/json 文件中读取队列配置，文件类型由扩展名决定，读取后校验各驱动的必填项
+func LoadConfig(path string) (cfg Config, err error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err = v.ReadInConfig(); err != nil {
+		return cfg, fmt.Errorf("read queue config %s: %w", path, err)
+	}
+	if err = v.Unmarshal(&cfg); err != nil {
+		return cfg, fmt.Errorf("parse queue config %s: %w", path, err)
+	}
+	if err = cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("queue config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate 校验配置的必填项，返回的错误中列出所有缺失的字段
+func (cfg Config) Validate() error {
+	var missing []string
+	if cfg.Driver == "" {
+		missing = append(missing, "driver")
+	}
+	if cfg.GroupName == "" {
+		missing = append(missing, "groupName")
+	}
+	switch cfg.Driver {
+	case "", constant.MemoryMqName:
+	case constant.RocketMqName:
+		if len(cfg.Rocket.Address) == 0 {
+			missing = append(missing, "rocket.address")
+		}
+	case constant.KafkaMqName:
+		if len(cfg.Kafka.Address) == 0 {
+			missing = append(missing, "kafka.address")
+		}
+	case constant.PulsarMqName:
+		if len(cfg.Pulsar.Address) == 0 {
+			missing = append(missing, "pulsar.address")
+		}
+		if cfg.Pulsar.Topic == "" {
+			missing = append(missing, "pulsar.topic")
+		}
+	default:
+		return fmt.Errorf("queue driver %q is not support", cfg.Driver)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return validateCompression(cfg.Compression)
+}
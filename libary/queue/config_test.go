@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	is := assert.New(t)
+
+	cfg, err := LoadConfig("testdata/kafka.yaml")
+	is.NoError(err)
+	is.Equal(constant.KafkaMqName, cfg.Driver)
+	is.Equal("order", cfg.GroupName)
+	is.Equal(3, cfg.Retry)
+	is.Equal(500*time.Millisecond, cfg.LimitWait)
+	is.Equal(CompressionSnappy, cfg.Compression)
+	is.Equal([]string{"127.0.0.1:9092", "127.0.0.1:9093"}, cfg.Kafka.Address)
+	is.Equal("2.8.0", cfg.Kafka.Version)
+	is.True(cfg.Kafka.RandClient)
+
+	cfg, err = LoadConfig("testdata/rocketmq.yaml")
+	is.NoError(err)
+	is.Equal(constant.RocketMqName, cfg.Driver)
+	is.Equal([]string{"127.0.0.1:9876"}, cfg.Rocket.Address)
+	is.Equal("warn", cfg.Rocket.LogLevel)
+
+	cfg, err = LoadConfig("testdata/pulsar.json")
+	is.NoError(err)
+	is.Equal(constant.PulsarMqName, cfg.Driver)
+	is.Equal([]string{"pulsar://127.0.0.1:6650"}, cfg.Pulsar.Address)
+	is.Equal("orders", cfg.Pulsar.Topic)
+	is.Equal("order-service", cfg.Pulsar.SubscriptionName)
+	is.Equal(1, cfg.Pulsar.Type)
+
+	cfg, err = LoadConfig("testdata/memory.yaml")
+	is.NoError(err)
+	is.Equal(constant.MemoryMqName, cfg.Driver)
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	is := assert.New(t)
+
+	_, err := LoadConfig("testdata/missing.yaml")
+	is.ErrorContains(err, "missing required fields: groupName, pulsar.address, pulsar.topic")
+
+	_, err = LoadConfig("testdata/not-exist.yaml")
+	is.Error(err)
+
+	is.ErrorContains(Config{Driver: "nats", GroupName: "order"}.Validate(), `"nats" is not support`)
+	is.Error(Config{Driver: constant.MemoryMqName, GroupName: "order", Compression: "zip"}.Validate())
+}
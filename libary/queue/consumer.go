@@ -2,9 +2,13 @@ package queue
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/longpi1/gopkg/libary/log"
+	"github.com/longpi1/gopkg/libary/pool"
 )
 
 // ConsumerInterface 消费者接口，实现该接口即可加入到消费队列中
@@ -13,6 +17,12 @@ type ConsumerInterface interface {
 	Handle(ctx context.Context, msg Msg) (err error) // 处理消息的方法
 }
 
+// ConcurrentConsumer 可选的消费者接口，实现后收到的消息会分发到协程池中，最多同时处理 GetConcurrency 条消息
+type ConcurrentConsumer interface {
+	ConsumerInterface
+	GetConcurrency() int // 获取同时处理消息的数量，小于等于1时串行处理
+}
+
 // consumerManager 消费者管理
 type consumerManager struct {
 	sync.Mutex
@@ -29,39 +39,191 @@ func RegisterConsumer(cs ConsumerInterface) {
 	defer consumers.Unlock()
 	topic := cs.GetTopic()
 	if _, ok := consumers.list[topic]; ok {
-		log.Info("queue.RegisterConsumer topic:%v duplicate registration.", topic)
+		getLogger().Warnf("queue.RegisterConsumer topic:%v duplicate registration.", topic)
 		return
 	}
 	consumers.list[topic] = cs
 }
 
-// StartConsumersListener 启动所有已注册的消费者监听
-func StartConsumersListener(ctx context.Context, cfg Config) {
+// 监听意外退出后重启的退避时间，从 minRestartBackoff 开始每次翻倍，最大为 maxRestartBackoff
+var (
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+)
+
+// StartConsumersListener 启动所有已注册的消费者监听。
+// 返回的 done 在 ctx 取消且所有监听的接收循环退出、已收到的消息处理完成后关闭，可用于关闭时等待消费结束
+func StartConsumersListener(ctx context.Context, cfg Config) (done <-chan struct{}) {
+	var wg sync.WaitGroup
 	for _, c := range consumers.list {
+		wg.Add(1)
 		go func(c ConsumerInterface) {
-			consumerListen(ctx, c, cfg)
+			defer wg.Done()
+			superviseListen(ctx, c, cfg)
 		}(c)
 	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	return stopped
 }
 
-// consumerListen 消费者监听
-func consumerListen(ctx context.Context, consumer ConsumerInterface, cfg Config) {
+// superviseListen 启动消费者监听，启动失败、发生 panic 或接收循环在 ctx 结束前退出时按指数退避重启，
+// 直到 ctx 结束且接收循环退出
+func superviseListen(ctx context.Context, consumer ConsumerInterface, cfg Config) {
+	backoff := minRestartBackoff
+	for {
+		done, restart := listenRecovered(ctx, consumer, cfg)
+		if !restart {
+			<-done
+			if ctx.Err() != nil {
+				return
+			}
+			getLogger().Errorf("消费队列接收循环意外退出, 即将重启")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// listenRecovered 启动消费者监听，返回接收循环的 done，启动失败或发生 panic 时记录日志并返回 restart 为true
+func listenRecovered(ctx context.Context, consumer ConsumerInterface, cfg Config) (done <-chan struct{}, restart bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			getLogger().Errorf("消费队列监听 panic, 即将重启: %v\n%s", r, debug.Stack())
+			restart = true
+		}
+	}()
+	done, err := consumerListen(ctx, consumer, cfg)
+	if err != nil {
+		getLogger().Errorf("消费队列监听失败, 即将重启: %+v", err)
+		return nil, true
+	}
+	return done, false
+}
+
+// recoverReceive 捕获驱动接收协程中的 panic 并记录日志，接收循环随之退出，由 superviseListen 重启
+func recoverReceive(topic string) {
+	if r := recover(); r != nil {
+		getLogger().Errorf("消费队列：%s 接收协程 panic, err:%v\n%s", topic, r, debug.Stack())
+	}
+}
+
+// consumerListen 消费者监听，ctx 取消后停止接收消息，创建消费者或监听失败时返回错误。
+// 返回的 done 在接收循环退出且已收到的消息处理完成后关闭
+func consumerListen(ctx context.Context, consumer ConsumerInterface, cfg Config) (done <-chan struct{}, err error) {
 	var (
-		topic  = consumer.GetTopic()
-		c, err = InstanceConsumer(cfg)
+		topic = consumer.GetTopic()
+		c     Consumer
 	)
 
-	if err != nil {
-		log.Fatal(ctx, "InstanceConsumer %s err:%+v", topic, err)
-		return
+	if c, err = InstanceConsumer(cfg); err != nil {
+		return nil, fmt.Errorf("InstanceConsumer %s err:%w", topic, err)
 	}
 
-	if listenErr := c.ListenReceiveMsgDo(topic, func(msg Msg) {
-		err = consumer.Handle(ctx, msg)
-		if err != nil {
-			log.Error("消费队列：%s 处理失败, err:%+v", topic, err)
+	receiveDo := func(msg Msg) {
+		// Handle panic 时只丢弃当前消息，继续消费后续消息
+		defer func() {
+			if r := recover(); r != nil {
+				getLogger().Errorf("消费队列：%s 处理 panic, err:%v\n%s", topic, r, debug.Stack())
+			}
+		}()
+		if err := consumer.Handle(ctx, msg); err != nil {
+			getLogger().Errorf("消费队列：%s 处理失败, err:%+v", topic, err)
 		}
-	}); listenErr != nil {
-		log.Fatal(ctx, "消费队列：%s 监听失败, err:%+v", topic, listenErr)
 	}
+	var dispatcher *concurrentDispatcher
+	if cc, ok := consumer.(ConcurrentConsumer); ok && cc.GetConcurrency() > 1 {
+		dispatcher = newConcurrentDispatcher(ctx, cc.GetConcurrency(), receiveDo)
+		receiveDo = dispatcher.dispatch
+	}
+
+	received, listenErr := c.ListenReceiveMsgDoContext(ctx, topic, receiveDo)
+	if listenErr != nil {
+		return nil, fmt.Errorf("消费队列：%s 监听失败, err:%w", topic, listenErr)
+	}
+	if dispatcher == nil {
+		return received, nil
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-received
+		// 接收循环退出后不会再有新消息，等待协程池中的消息处理完成
+		dispatcher.stop()
+	}()
+	return stopped, nil
+}
+
+// concurrentDispatcher 将收到的消息分发到协程池中处理
+type concurrentDispatcher struct {
+	pool   *pool.Pool[struct{}]
+	handle func(msg Msg)
+
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup // 已提交到协程池但尚未处理完成的消息
+}
+
+// newConcurrentDispatcher 创建分发器，ctx 结束后等待已提交的消息处理完成再释放协程池
+func newConcurrentDispatcher(ctx context.Context, concurrency int, handle func(msg Msg)) *concurrentDispatcher {
+	d := &concurrentDispatcher{
+		pool:   pool.NewPool[struct{}](concurrency),
+		handle: handle,
+	}
+	go func() {
+		<-ctx.Done()
+		d.stop()
+	}()
+	return d
+}
+
+// dispatch 提交消息到协程池，没有空闲协程时阻塞，从而对驱动的消费形成背压
+func (d *concurrentDispatcher) dispatch(msg Msg) {
+	d.mu.RLock()
+	if d.stopped {
+		d.mu.RUnlock()
+		// 协程池已释放，停止后仍收到的消息直接串行处理
+		d.handle(msg)
+		return
+	}
+	d.wg.Add(1)
+	d.mu.RUnlock()
+
+	var started atomic.Bool
+	future := d.pool.Submit(func() (struct{}, error) {
+		started.Store(true)
+		defer d.wg.Done()
+		d.handle(msg)
+		return struct{}{}, nil
+	})
+	select {
+	case <-future.Inner():
+	default:
+		// 消息已进入协程池
+		return
+	}
+	if started.Load() || future.Err == nil {
+		return
+	}
+	// 提交失败（如协程池已被释放）时任务不会执行，串行处理消息，避免 stop 一直等待
+	getLogger().Errorf("消费队列：提交到协程池失败，串行处理消息, err:%+v", future.Err)
+	d.wg.Done()
+	d.handle(msg)
+}
+
+// stop 停止向协程池提交消息，等待已提交的消息处理完成后释放协程池
+func (d *concurrentDispatcher) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	d.pool.Release()
 }
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+type slowConsumer struct {
+	topic       string
+	concurrency int
+	delay       time.Duration
+
+	inFlight    int32
+	maxInFlight int32
+	wg          sync.WaitGroup
+}
+
+func (c *slowConsumer) GetTopic() string {
+	return c.topic
+}
+
+func (c *slowConsumer) GetConcurrency() int {
+	return c.concurrency
+}
+
+func (c *slowConsumer) Handle(ctx context.Context, msg Msg) error {
+	defer c.wg.Done()
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	return nil
+}
+
+func TestConsumerConcurrency(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	cs := &slowConsumer{topic: uniqueTopic("memory-concurrency"), concurrency: 4, delay: 200 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cs.wg.Add(8)
+	consumerListen(ctx, cs, cfg)
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		is.NoError(Push(cs.topic, i, cfg))
+	}
+	cs.wg.Wait()
+
+	// 8 messages with 4 workers take two rounds instead of eight
+	is.Less(time.Since(start), 8*cs.delay)
+	is.Greater(atomic.LoadInt32(&cs.maxInFlight), int32(1))
+	is.LessOrEqual(atomic.LoadInt32(&cs.maxInFlight), int32(4))
+}
+
+func TestConcurrentDispatcherStop(t *testing.T) {
+	is := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled int32
+	d := newConcurrentDispatcher(ctx, 2, func(msg Msg) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&handled, 1)
+	})
+
+	for i := 0; i < 4; i++ {
+		d.dispatch(Msg{})
+	}
+	cancel()
+	// stop waits for the submitted messages before releasing the pool
+	d.stop()
+	is.Equal(int32(4), atomic.LoadInt32(&handled))
+
+	// messages received after stop are handled inline
+	d.dispatch(Msg{})
+	is.Equal(int32(5), atomic.LoadInt32(&handled))
+}
+
+func TestConcurrentDispatcherSubmitFailed(t *testing.T) {
+	is := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled int32
+	d := newConcurrentDispatcher(ctx, 2, func(msg Msg) {
+		atomic.AddInt32(&handled, 1)
+	})
+
+	// a message rejected by the pool is handled inline instead of leaking a pending count
+	d.pool.Release()
+	d.dispatch(Msg{})
+	is.Equal(int32(1), atomic.LoadInt32(&handled))
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		d.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop blocked on a message that was never submitted")
+	}
+}
+
+type panicConsumer struct {
+	topic       string
+	topicPanics int32 // GetTopic panics this many times
+	handled     chan string
+	calls       int32
+}
+
+func (c *panicConsumer) GetTopic() string {
+	if atomic.AddInt32(&c.topicPanics, -1) >= 0 {
+		panic("topic not ready")
+	}
+	return c.topic
+}
+
+func (c *panicConsumer) Handle(ctx context.Context, msg Msg) error {
+	if atomic.AddInt32(&c.calls, 1) == 1 {
+		panic("bad message")
+	}
+	c.handled <- msg.BodyString()
+	return nil
+}
+
+func TestConsumerHandlePanic(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	cs := &panicConsumer{topic: uniqueTopic("memory-panic"), handled: make(chan string, 3)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumerListen(ctx, cs, cfg)
+	for i := 0; i < 3; i++ {
+		is.NoError(Push(cs.topic, i, cfg))
+	}
+	// the first message panics, the others are still consumed
+	for _, want := range []string{"1", "2"} {
+		select {
+		case body := <-cs.handled:
+			is.Equal(want, body)
+		case <-time.After(time.Second):
+			t.Fatal("message not consumed after a panic")
+		}
+	}
+}
+
+func TestSuperviseListenRestart(t *testing.T) {
+	is := assert.New(t)
+	defer func(backoff time.Duration) { minRestartBackoff = backoff }(minRestartBackoff)
+	minRestartBackoff = time.Millisecond
+
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	// the listener panics twice before it starts, the first message is handled and not panicking
+	cs := &panicConsumer{topic: uniqueTopic("memory-supervise"), topicPanics: 2, handled: make(chan string, 1), calls: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go superviseListen(ctx, cs, cfg)
+	is.Eventually(func() bool { return atomic.LoadInt32(&cs.topicPanics) < 0 }, time.Second, time.Millisecond)
+	is.NoError(Push(cs.topic, "after restart", cfg))
+	select {
+	case body := <-cs.handled:
+		is.Equal("after restart", body)
+	case <-time.After(time.Second):
+		t.Fatal("listener not restarted")
+	}
+}
+
+func TestSuperviseListenReceiveLoopRestart(t *testing.T) {
+	is := assert.New(t)
+	defer func(backoff time.Duration) { minRestartBackoff = backoff }(minRestartBackoff)
+	minRestartBackoff = time.Millisecond
+
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	cs := &chanConsumer{topic: uniqueTopic("memory-receive-loop"), received: make(chan Msg, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go superviseListen(ctx, cs, cfg)
+	for i, body := range []string{"before", "after restart"} {
+		if i > 0 {
+			// a value the memory driver can not convert makes its receive goroutine panic after startup
+			defaultMemoryBroker.topic(cs.topic).ch.Input("not a message")
+		}
+		is.NoError(Push(cs.topic, body, cfg))
+		select {
+		case msg := <-cs.received:
+			is.Equal(body, msg.BodyString())
+		case <-time.After(time.Second):
+			t.Fatalf("message %q not handled", body)
+		}
+	}
+}
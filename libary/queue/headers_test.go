@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePulsarMessage only implements the accessors used by pulsarMsg
+type fakePulsarMessage struct {
+	pulsar.Message
+	payload    []byte
+	properties map[string]string
+}
+
+func (m *fakePulsarMessage) Payload() []byte {
+	return m.payload
+}
+
+func (m *fakePulsarMessage) Properties() map[string]string {
+	return m.properties
+}
+
+func TestMsgHeadersRoundTrip(t *testing.T) {
+	is := assert.New(t)
+	headers := map[string]string{"trace-id": "abc", "tenant": "t1"}
+
+	// kafka: record headers set on the producer message come back on the consumer message
+	produced := &sarama.ProducerMessage{Topic: "topic", Headers: kafkaHeaders(headers)}
+	consumed := &sarama.ConsumerMessage{Topic: "topic", Value: []byte("body")}
+	for i := range produced.Headers {
+		consumed.Headers = append(consumed.Headers, &produced.Headers[i])
+	}
+	msg := kafkaMsg(consumed)
+	is.Equal(headers, msg.Headers)
+	is.Equal("body", msg.BodyString())
+	is.Nil(kafkaHeaders(nil))
+	is.Nil(kafkaMsg(&sarama.ConsumerMessage{}).Headers)
+
+	// pulsar: headers are sent as message properties
+	pulsarProduced := &pulsar.ProducerMessage{Payload: []byte("body"), Properties: headers}
+	msg = pulsarMsg("topic", &fakePulsarMessage{payload: pulsarProduced.Payload, properties: pulsarProduced.Properties})
+	is.Equal(headers, msg.Headers)
+	is.Equal("topic", msg.Topic)
+
+	// rocketmq: properties survive the wire encoding
+	rocketProduced := rocketMessage("topic", []byte("body"), headers)
+	ext := &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte("body")}}
+	ext.UnmarshalProperties([]byte(rocketProduced.MarshallProperties()))
+	msg = rocketMsg(ext)
+	is.Equal(headers, msg.Headers)
+	is.Equal(ReceiveMsg, msg.RunType)
+}
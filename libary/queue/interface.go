@@ -1,13 +1,16 @@
 package queue
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/longpi1/gopkg/libary/future"
+	"github.com/longpi1/gopkg/libary/id"
+	"github.com/longpi1/gopkg/libary/limit"
 )
 
 type Queue interface {
@@ -19,11 +22,18 @@ type Queue interface {
 type Producer interface {
 	SendMsg(topic string, body string) (msg Msg, err error)
 	SendByteMsg(topic string, body []byte) (msg Msg, err error)
+	// SendHeaderMsg 生产带消息头的数据，消息头在消费端通过 Msg.Headers 获取
+	SendHeaderMsg(topic string, body []byte, headers map[string]string) (msg Msg, err error)
 	SendDelayMsg(topic string, body string, delaySecond int64) (mqMsg Msg, err error)
+	// SendMsgAsync 异步生产数据，不等待服务端确认，发送结果通过 Future 获取
+	SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg]
 }
 
 type Consumer interface {
 	ListenReceiveMsgDo(topic string, receiveDo func(Msg Msg)) (err error)
+	// ListenReceiveMsgDoContext 消费数据，ctx 取消后停止接收消息。
+	// 返回的 done 在接收循环退出后关闭，此时不会再调用 receiveDo
+	ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(msg Msg)) (done <-chan struct{}, err error)
 }
 
 const (
@@ -40,6 +50,12 @@ type Config struct {
 	Rocket    RocketConf
 	Kafka     KafkaConf
 	Pulsar    PulsarConf
+	// Limiter 生产者限流器，Push/DelayPush 被拒绝时返回 ErrRateLimited，为 nil 时不限流
+	Limiter limit.Limiter `json:"-"`
+	// LimitWait 限流器拒绝时最多等待的时间，为0时直接返回 ErrRateLimited
+	LimitWait time.Duration `json:"limitWait"`
+	// Compression 生产者的消息压缩算法：none/gzip/snappy/lz4，为空时不压缩
+	Compression string `json:"compression"`
 }
 
 type RedisConf struct {
@@ -57,6 +73,8 @@ type PulsarConf struct {
 	URL              string   `json:"url"`
 	Type             int      `json:"type"`
 	SubscriptionName string   `json:"subscriptionName"`
+
+	compression string // 由 Config.Compression 设置
 }
 
 type KafkaConf struct {
@@ -74,6 +92,8 @@ type Msg struct {
 	Partition int32     `json:"partition"`
 	Timestamp time.Time `json:"timestamp"`
 	Body      []byte    `json:"body"`
+	// Headers 消息头，kafka 对应 record headers，pulsar/rocketmq 对应 message properties
+	Headers map[string]string `json:"headers"`
 }
 
 var (
@@ -96,6 +116,11 @@ func NewProducer(cfg Config) (client Producer, err error) {
 		err = fmt.Errorf("mq groupName is empty")
 		return
 	}
+	if err = validateCompression(cfg.Compression); err != nil {
+		return
+	}
+	// kafka 及 pulsar 的 lz4 使用客户端自带的压缩，其余情况在应用层压缩消息体
+	nativeCompression := cfg.Compression == "" || cfg.Compression == CompressionNone
 
 	switch cfg.Driver {
 	case constant.RocketMqName:
@@ -110,16 +135,25 @@ func NewProducer(cfg Config) (client Producer, err error) {
 			return
 		}
 		client, err = RegisterKafkaProducer(KafkaConfig{
-			Brokers: cfg.Kafka.Address,
-			GroupID: cfg.GroupName,
-			Version: cfg.Kafka.Version,
+			Brokers:     cfg.Kafka.Address,
+			GroupID:     cfg.GroupName,
+			Version:     cfg.Kafka.Version,
+			Compression: cfg.Compression,
 		})
+		nativeCompression = true
 	case constant.PulsarMqName:
 		if len(cfg.Pulsar.Address) == 0 {
 			err = fmt.Errorf("queue pulsar address is not support")
 			return
 		}
-		client, err = RegisterPulsarProducer(cfg.Pulsar)
+		pulsarConf := cfg.Pulsar
+		if cfg.Compression == CompressionLz4 {
+			pulsarConf.compression = CompressionLz4
+			nativeCompression = true
+		}
+		client, err = RegisterPulsarProducer(pulsarConf)
+	case constant.MemoryMqName:
+		client, err = RegisterMemoryProducer()
 	default:
 		err = fmt.Errorf("queue driver is not support")
 	}
@@ -127,6 +161,9 @@ func NewProducer(cfg Config) (client Producer, err error) {
 	if err != nil {
 		return
 	}
+	if !nativeCompression {
+		client = &compressProducer{Producer: client, compression: cfg.Compression}
+	}
 
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -177,6 +214,8 @@ func NewConsumer(cfg Config) (client Consumer, err error) {
 			return
 		}
 		client, err = RegisterPulsarConsumer(cfg.Pulsar)
+	case constant.MemoryMqName:
+		client, err = RegisterMemoryConsumer()
 	default:
 		err = fmt.Errorf("queue driver is not support")
 	}
@@ -184,6 +223,7 @@ func NewConsumer(cfg Config) (client Consumer, err error) {
 	if err != nil {
 		return
 	}
+	client = &decompressConsumer{Consumer: client}
 
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -196,8 +236,5 @@ func (m *Msg) BodyString() string {
 }
 
 func getRandMsgId() string {
-	rand.NewSource(time.Now().UnixNano())
-	radium := rand.Intn(999) + 1
-	timeCode := time.Now().UnixNano()
-	return fmt.Sprintf("%d%.4d", timeCode, radium)
+	return id.NewULID()
 }
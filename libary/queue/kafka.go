@@ -3,9 +3,10 @@ package queue
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"time"
 
-	"github.com/longpi1/gopkg/libary/log"
+	"github.com/longpi1/gopkg/libary/future"
 
 	"github.com/IBM/sarama"
 )
@@ -25,6 +26,7 @@ type KafkaConfig struct {
 	Version     string
 	UserName    string
 	Password    string
+	Compression string
 }
 
 // SendMsg 按字符串类型生产数据
@@ -34,38 +36,86 @@ func (r *Kafka) SendMsg(topic string, body string) (msg Msg, err error) {
 
 // SendByteMsg 生产数据
 func (r *Kafka) SendByteMsg(topic string, body []byte) (msg Msg, err error) {
+	return r.SendHeaderMsg(topic, body, nil)
+}
+
+// SendHeaderMsg 生产带消息头的数据
+func (r *Kafka) SendHeaderMsg(topic string, body []byte, headers map[string]string) (msg Msg, err error) {
+	sendCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f := r.sendAsync(sendCtx, topic, body, headers)
+	select {
+	case <-f.Inner():
+		return f.Await()
+	case <-sendCtx.Done():
+		return msg, fmt.Errorf("send mqMst timeout")
+	}
+}
+
+// SendMsgAsync 异步生产数据
+func (r *Kafka) SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg] {
+	return r.sendAsync(ctx, topic, []byte(body), nil)
+}
+
+// kafkaPending 等待发送结果的消息，作为 ProducerMessage 的 Metadata
+type kafkaPending struct {
+	future  *future.Future[Msg]
+	headers map[string]string
+}
+
+func (r *Kafka) sendAsync(ctx context.Context, topic string, body []byte, headers map[string]string) *future.Future[Msg] {
+	f := future.NewFuture[Msg]()
+	if r.producerIns == nil {
+		f.Complete(Msg{}, fmt.Errorf("queue kafka producerIns is nil"))
+		return f
+	}
+
 	producerMessage := &sarama.ProducerMessage{
 		Topic:     topic,
 		Value:     sarama.ByteEncoder(body),
+		Headers:   kafkaHeaders(headers),
 		Timestamp: time.Now(),
+		Metadata:  &kafkaPending{future: f, headers: headers},
 	}
-
-	if r.producerIns == nil {
-		err = fmt.Errorf("queue kafka producerIns is nil")
-		return
+	select {
+	case r.producerIns.Input() <- producerMessage:
+	case <-ctx.Done():
+		f.Complete(Msg{}, ctx.Err())
 	}
+	return f
+}
 
-	r.producerIns.Input() <- producerMessage
-	sendCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	select {
-	case info := <-r.producerIns.Successes():
-		return Msg{
-			RunType:   SendMsg,
-			Topic:     info.Topic,
-			Offset:    info.Offset,
-			Partition: info.Partition,
-			Timestamp: info.Timestamp,
-		}, nil
-	case fail := <-r.producerIns.Errors():
-		if nil != fail {
-			return msg, fail.Err
+// dispatchResults 将异步生产者的发送结果分发给对应消息的 Future，生产者关闭后退出
+func (r *Kafka) dispatchResults() {
+	successes, errs := r.producerIns.Successes(), r.producerIns.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case info, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			if pending, ok := info.Metadata.(*kafkaPending); ok {
+				pending.future.Complete(Msg{
+					RunType:   SendMsg,
+					Topic:     info.Topic,
+					Offset:    info.Offset,
+					Partition: info.Partition,
+					Timestamp: info.Timestamp,
+					Headers:   pending.headers,
+				}, nil)
+			}
+		case fail, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if pending, ok := fail.Msg.Metadata.(*kafkaPending); ok {
+				pending.future.Complete(Msg{}, fail.Err)
+			}
 		}
-	case <-sendCtx.Done():
-		return msg, fmt.Errorf("send mqMst timeout")
 	}
-	return msg, nil
 }
 
 func (r *Kafka) SendDelayMsg(topic string, body string, delaySecond int64) (msg Msg, err error) {
@@ -75,42 +125,53 @@ func (r *Kafka) SendDelayMsg(topic string, body string, delaySecond int64) (msg
 
 // ListenReceiveMsgDo 消费数据
 func (r *Kafka) ListenReceiveMsgDo(topic string, receiveDo func(msg Msg)) (err error) {
+	_, err = r.ListenReceiveMsgDoContext(context.Background(), topic, receiveDo)
+	return err
+}
+
+// ListenReceiveMsgDoContext 消费数据，等待消费者就绪后返回，ctx 取消后停止消费并关闭消费者。
+// 返回的 done 在消费循环退出且消费者关闭后关闭
+func (r *Kafka) ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(msg Msg)) (done <-chan struct{}, err error) {
 	if r.consumerIns == nil {
-		return fmt.Errorf("queue kafka consumer not register")
+		return nil, fmt.Errorf("queue kafka consumer not register")
 	}
 
 	consumer := KaConsumer{
 		ready:        make(chan bool),
 		receiveDoFun: receiveDo,
 	}
-
-	consumerCtx, cancel := context.WithCancel(context.Background())
-	go func(consumerCtx context.Context) {
+	ready := consumer.ready
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer func() {
+			getLogger().Debugf("kafka consumer close...")
+			if err := r.consumerIns.Close(); err != nil {
+				getLogger().Errorf("kafka Error closing client, err:%+v", err)
+			}
+		}()
+		defer recoverReceive(topic)
 		for {
-			if err = r.consumerIns.Consume(consumerCtx, []string{topic}, &consumer); err != nil {
-				log.Error("kafka Error from consumer, err%+v", err)
+			if err := r.consumerIns.Consume(ctx, []string{topic}, &consumer); err != nil {
+				getLogger().Errorf("kafka Error from consumer, err:%+v", err)
 			}
 
-			if consumerCtx.Err() != nil {
-				log.Error(fmt.Sprintf("kafka consoumer stop : %v", consumerCtx.Err()))
+			if ctx.Err() != nil {
+				getLogger().Warnf("kafka consoumer stop : %v", ctx.Err())
 				return
 			}
 			consumer.ready = make(chan bool)
 		}
-	}(consumerCtx)
+	}()
 
 	// await till the consumer has been set up
-	<-consumer.ready
-	log.Debug("kafka consumer up and running!...")
-
-	func(args ...interface{}) {
-		log.Debug("kafka consumer close...")
-		cancel()
-		if err = r.consumerIns.Close(); err != nil {
-			log.Error("kafka Error closing client, err:%+v", err)
-		}
-	}()
-	return
+	select {
+	case <-ready:
+		getLogger().Debugf("kafka consumer up and running!...")
+	case <-stopped:
+	}
+	return stopped, nil
 }
 
 // RegisterKafkaConsumer 注册消费者
@@ -181,7 +242,7 @@ func doRegisterKafkaProducer(connOpt KafkaConfig, mqIns *Kafka) (err error) {
 	conf.Producer.Return.Successes = true
 
 	conf.Producer.Return.Errors = true
-	conf.Producer.Compression = sarama.CompressionNone
+	conf.Producer.Compression = kafkaCompressionCodec(connOpt.Compression)
 	conf.ClientID = connOpt.ClientId
 
 	conf.Version = kfkVersion
@@ -195,14 +256,28 @@ func doRegisterKafkaProducer(connOpt KafkaConfig, mqIns *Kafka) (err error) {
 	if err != nil {
 		return
 	}
+	go mqIns.dispatchResults()
 
 	func(args ...interface{}) {
-		log.Info("kafka producer AsyncClose...")
+		getLogger().Debugf("kafka producer AsyncClose...")
 		mqIns.producerIns.AsyncClose()
 	}()
 	return
 }
 
+// kafkaCompressionCodec 将压缩算法转换为 kafka 的压缩编码
+func kafkaCompressionCodec(compression string) sarama.CompressionCodec {
+	switch compression {
+	case CompressionGzip:
+		return sarama.CompressionGZIP
+	case CompressionSnappy:
+		return sarama.CompressionSnappy
+	case CompressionLz4:
+		return sarama.CompressionLZ4
+	}
+	return sarama.CompressionNone
+}
+
 // validateVersion 验证版本是否有效
 func validateVersion(version sarama.KafkaVersion) bool {
 	for _, item := range sarama.SupportedVersions {
@@ -231,22 +306,55 @@ func (consumer *KaConsumer) Cleanup(sarama.ConsumerGroupSession) error {
 }
 
 // ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
-func (consumer *KaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+func (consumer *KaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) (err error) {
+	// panic 时结束当前 claim 并将错误返回给 sarama，避免进程崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			getLogger().Errorf("消费队列：%s 接收协程 panic, err:%v\n%s", claim.Topic(), r, debug.Stack())
+			err = fmt.Errorf("kafka consume claim of %s panic: %v", claim.Topic(), r)
+		}
+	}()
 	// NOTE:
 	// Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/Shopify/sarama/blob/master/consumer_group.go#L27-L29
 	// `ConsumeClaim` 方法已经是 goroutine 调用 不要在该方法内进行 goroutine
 	for message := range claim.Messages() {
-		consumer.receiveDoFun(Msg{
-			RunType:   ReceiveMsg,
-			Topic:     message.Topic,
-			Body:      message.Value,
-			Offset:    message.Offset,
-			Timestamp: message.Timestamp,
-			Partition: message.Partition,
-		})
+		consumer.receiveDoFun(kafkaMsg(message))
 		session.MarkMessage(message, "")
 	}
 	return nil
 }
+
+// kafkaHeaders 将消息头转换为 kafka record headers
+func kafkaHeaders(headers map[string]string) []sarama.RecordHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for key, value := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return recordHeaders
+}
+
+// kafkaMsg 将消费到的 kafka 消息转换为 Msg
+func kafkaMsg(message *sarama.ConsumerMessage) Msg {
+	msg := Msg{
+		RunType:   ReceiveMsg,
+		Topic:     message.Topic,
+		Body:      message.Value,
+		Offset:    message.Offset,
+		Timestamp: message.Timestamp,
+		Partition: message.Partition,
+	}
+	if len(message.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			if header != nil {
+				msg.Headers[string(header.Key)] = string(header.Value)
+			}
+		}
+	}
+	return msg
+}
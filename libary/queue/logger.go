@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"sync/atomic"
+
+	"github.com/longpi1/gopkg/libary/log"
+)
+
+// loggerHolder 包装 log.Logger，保证 atomic.Value 中存储的类型一致
+type loggerHolder struct {
+	log.Logger
+}
+
+var queueLogger atomic.Value
+
+func init() {
+	queueLogger.Store(loggerHolder{log.StdLogger})
+}
+
+// SetLogger 设置队列内部使用的日志，默认输出到全局日志，为 nil 时不输出日志
+func SetLogger(logger log.Logger) {
+	if logger == nil {
+		logger = log.NopLogger
+	}
+	queueLogger.Store(loggerHolder{logger})
+}
+
+// getLogger 返回队列内部使用的日志
+func getLogger() log.Logger {
+	return queueLogger.Load().(loggerHolder).Logger
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/longpi1/gopkg/libary/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) { l.record("debug", format, args...) }
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) { l.record("warn", format, args...) }
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) { l.record("error", format, args...) }
+
+func (l *recordLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestFailingConsumerDoesNotExit(t *testing.T) {
+	is := assert.New(t)
+	logger := &recordLogger{}
+	SetLogger(logger)
+	defer SetLogger(log.StdLogger)
+	defer func(backoff time.Duration) { minRestartBackoff = backoff }(minRestartBackoff)
+	minRestartBackoff = time.Millisecond
+
+	// no group name, the consumer can not be created
+	cs := &slowConsumer{topic: "bad-consumer"}
+	_, err := consumerListen(context.Background(), cs, Config{Driver: constant.MemoryMqName})
+	is.ErrorContains(err, "groupName is empty")
+
+	// the supervisor logs the failure and keeps retrying instead of exiting the process
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		superviseListen(ctx, cs, Config{Driver: constant.MemoryMqName})
+		close(done)
+	}()
+	is.Eventually(func() bool { return len(logger.Lines()) >= 3 }, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop after cancel")
+	}
+	is.True(strings.HasPrefix(logger.Lines()[0], "error 消费队列监听失败"))
+}
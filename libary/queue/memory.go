@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/channel"
+	"github.com/longpi1/gopkg/libary/future"
+)
+
+// Memory 进程内的内存队列，不依赖外部服务，主要用于单元测试
+// 同一主题的消息会被该主题的某一个监听者消费，没有监听者时消息会保留到有监听者为止
+type Memory struct {
+	broker *memoryBroker
+}
+
+// memoryBroker 维护所有主题的消息队列
+type memoryBroker struct {
+	sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	ch     channel.Channel
+	offset int64
+}
+
+var defaultMemoryBroker = &memoryBroker{
+	topics: make(map[string]*memoryTopic),
+}
+
+// RegisterMemoryProducer 注册内存队列生产者
+func RegisterMemoryProducer() (client Producer, err error) {
+	return &Memory{broker: defaultMemoryBroker}, nil
+}
+
+// RegisterMemoryConsumer 注册内存队列消费者
+func RegisterMemoryConsumer() (client Consumer, err error) {
+	return &Memory{broker: defaultMemoryBroker}, nil
+}
+
+// topic 获取主题的消息队列，不存在时创建
+func (b *memoryBroker) topic(name string) *memoryTopic {
+	b.Lock()
+	defer b.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		// 非阻塞模式下缓冲区无上限，生产者不会因为没有消费者而阻塞
+		t = &memoryTopic{ch: channel.New(channel.WithNonBlock())}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// SendMsg 按字符串类型生产数据
+func (m *Memory) SendMsg(topic string, body string) (msg Msg, err error) {
+	return m.SendByteMsg(topic, []byte(body))
+}
+
+// SendByteMsg 生产数据
+func (m *Memory) SendByteMsg(topic string, body []byte) (msg Msg, err error) {
+	return m.SendHeaderMsg(topic, body, nil)
+}
+
+// SendHeaderMsg 生产带消息头的数据
+func (m *Memory) SendHeaderMsg(topic string, body []byte, headers map[string]string) (msg Msg, err error) {
+	msg = m.newMsg(topic, body, headers)
+	m.broker.topic(topic).ch.Input(msg)
+	return msg, nil
+}
+
+// SendMsgAsync 异步生产数据，内存队列的发送不会阻塞，返回的 Future 已经完成
+func (m *Memory) SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg] {
+	f := future.NewFuture[Msg]()
+	if err := ctx.Err(); err != nil {
+		f.Complete(Msg{}, err)
+		return f
+	}
+	f.Complete(m.SendMsg(topic, body))
+	return f
+}
+
+// SendDelayMsg 生产延迟数据，消息在 delaySecond 秒后才能被消费
+func (m *Memory) SendDelayMsg(topic string, body string, delaySecond int64) (msg Msg, err error) {
+	if delaySecond < 0 {
+		return msg, fmt.Errorf("queue memory delaySecond must not be negative")
+	}
+	msg = m.newMsg(topic, []byte(body), nil)
+	t := m.broker.topic(topic)
+	time.AfterFunc(time.Duration(delaySecond)*time.Second, func() {
+		t.ch.Input(msg)
+	})
+	return msg, nil
+}
+
+// ListenReceiveMsgDo 消费数据
+func (m *Memory) ListenReceiveMsgDo(topic string, receiveDo func(msg Msg)) (err error) {
+	_, err = m.ListenReceiveMsgDoContext(context.Background(), topic, receiveDo)
+	return err
+}
+
+// ListenReceiveMsgDoContext 消费数据，ctx 取消后停止接收消息，未接收的消息留给该主题的其他监听者。
+// 返回的 done 在接收循环退出后关闭
+func (m *Memory) ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(msg Msg)) (done <-chan struct{}, err error) {
+	t := m.broker.topic(topic)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer recoverReceive(topic)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-t.ch.Output():
+				if !ok {
+					return
+				}
+				msg := v.(Msg)
+				msg.RunType = ReceiveMsg
+				receiveDo(msg)
+			}
+		}
+	}()
+	return stopped, nil
+}
+
+func (m *Memory) newMsg(topic string, body []byte, headers map[string]string) Msg {
+	t := m.broker.topic(topic)
+	msg := NewMsg(topic, body, headers)
+	msg.Offset = atomic.AddInt64(&t.offset, 1) - 1
+	return msg
+}
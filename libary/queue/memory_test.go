@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+type chanConsumer struct {
+	topic    string
+	received chan Msg
+}
+
+func (c *chanConsumer) GetTopic() string {
+	return c.topic
+}
+
+func (c *chanConsumer) Handle(ctx context.Context, msg Msg) error {
+	c.received <- msg
+	return nil
+}
+
+// uniqueTopic keeps listeners left over from a previous -count run off this run's messages
+func uniqueTopic(name string) string {
+	return name + "-" + getRandMsgId()
+}
+
+func TestMemoryConsumersListener(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	cs := &chanConsumer{topic: uniqueTopic("memory-listener"), received: make(chan Msg, 10)}
+	RegisterConsumer(cs)
+
+	// messages pushed before the listener starts are kept
+	is.NoError(Push(cs.topic, "first", cfg))
+	StartConsumersListener(context.Background(), cfg)
+	is.NoError(Push(cs.topic, "second", cfg))
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-cs.received:
+			is.Equal(want, msg.BodyString())
+			is.Equal(ReceiveMsg, msg.RunType)
+			is.Equal(cs.topic, msg.Topic)
+		case <-time.After(time.Second):
+			t.Fatalf("message %q not handled", want)
+		}
+	}
+}
+
+func TestMemoryDelayMsg(t *testing.T) {
+	is := assert.New(t)
+	p, err := RegisterMemoryProducer()
+	is.NoError(err)
+	c, err := RegisterMemoryConsumer()
+	is.NoError(err)
+
+	topic := uniqueTopic("memory-delay")
+	received := make(chan Msg, 1)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { received <- msg }))
+
+	start := time.Now()
+	_, err = p.SendDelayMsg(topic, "later", 1)
+	is.NoError(err)
+	select {
+	case msg := <-received:
+		is.Equal("later", msg.BodyString())
+		is.GreaterOrEqual(time.Since(start), time.Second)
+	case <-time.After(3 * time.Second):
+		t.Fatal("delayed message not delivered")
+	}
+
+	_, err = p.SendDelayMsg(topic, "bad", -1)
+	is.Error(err)
+}
+
+func TestMemoryHeaders(t *testing.T) {
+	is := assert.New(t)
+	p, _ := RegisterMemoryProducer()
+	c, _ := RegisterMemoryConsumer()
+
+	topic := uniqueTopic("memory-headers")
+	received := make(chan Msg, 1)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { received <- msg }))
+	sent, err := p.SendHeaderMsg(topic, []byte("body"), map[string]string{"trace-id": "abc"})
+	is.NoError(err)
+
+	msg := <-received
+	is.Equal(sent.MsgId, msg.MsgId)
+	is.Equal("abc", msg.Headers["trace-id"])
+}
+
+func TestNewConsumerListenContext(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	c, err := NewConsumer(cfg)
+	is.NoError(err)
+
+	topic := uniqueTopic("memory-listen-context")
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan Msg, 1)
+	done, err := c.ListenReceiveMsgDoContext(ctx, topic, func(msg Msg) { received <- msg })
+	is.NoError(err)
+
+	is.NoError(Push(topic, "first", cfg))
+	select {
+	case msg := <-received:
+		is.Equal("first", msg.BodyString())
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("receive loop did not exit")
+	}
+
+	// messages sent after the loop exited are left for the next listener
+	is.NoError(Push(topic, "second", cfg))
+	next := make(chan Msg, 1)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { next <- msg }))
+	select {
+	case msg := <-next:
+		is.Equal("second", msg.BodyString())
+	case <-time.After(time.Second):
+		t.Fatal("message not left for the next listener")
+	}
+	is.Empty(received)
+}
+
+func TestStartConsumersListenerDone(t *testing.T) {
+	is := assert.New(t)
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	cs := &slowConsumer{topic: uniqueTopic("memory-listener-done"), concurrency: 2, delay: 100 * time.Millisecond}
+	RegisterConsumer(cs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := StartConsumersListener(ctx, cfg)
+	cs.wg.Add(2)
+	for i := 0; i < 2; i++ {
+		is.NoError(Push(cs.topic, i, cfg))
+	}
+	is.Eventually(func() bool { return atomic.LoadInt32(&cs.inFlight) > 0 }, time.Second, time.Millisecond)
+
+	// done waits for the messages being handled when the listener is stopped
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("listeners did not stop")
+	}
+	is.Equal(int32(0), atomic.LoadInt32(&cs.inFlight))
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// bodyEncodingBase64 消息体不是合法的 UTF-8 文本时，JSON 中的 body 使用 base64 编码
+const bodyEncodingBase64 = "base64"
+
+// NewMsg 创建一条待发送的消息，生成消息 ID 并以当前时间作为时间戳，headers 会被复制
+func NewMsg(topic string, body []byte, headers map[string]string) Msg {
+	msg := Msg{
+		RunType:   SendMsg,
+		Topic:     topic,
+		MsgId:     getRandMsgId(),
+		Timestamp: time.Now(),
+		Body:      body,
+	}
+	if len(headers) > 0 {
+		msg.Headers = make(map[string]string, len(headers))
+		for key, value := range headers {
+			msg.Headers[key] = value
+		}
+	}
+	return msg
+}
+
+// msgAlias 与 Msg 字段相同但没有 JSON 方法，避免递归调用
+type msgAlias Msg
+
+// msgJSON Msg 的 JSON 格式，覆盖 msgAlias 中的 Timestamp 和 Body
+type msgJSON struct {
+	*msgAlias
+	Timestamp    int64  `json:"timestamp"`               // Unix 毫秒时间戳，零值时间为0
+	Body         string `json:"body"`                    // 合法的 UTF-8 文本原样输出，否则为 base64
+	BodyEncoding string `json:"body_encoding,omitempty"` // body 为 base64 时为 "base64"
+}
+
+// MarshalJSON 将消息编码为便于其他语言消费的 JSON：timestamp 为 Unix 毫秒，
+// body 为合法的 UTF-8 文本时原样输出，否则使用 base64 编码并设置 body_encoding 为 "base64"
+func (m Msg) MarshalJSON() ([]byte, error) {
+	alias := msgAlias(m)
+	data := msgJSON{msgAlias: &alias}
+	if !m.Timestamp.IsZero() {
+		data.Timestamp = m.Timestamp.UnixMilli()
+	}
+	if utf8.Valid(m.Body) {
+		data.Body = string(m.Body)
+	} else {
+		data.Body = base64.StdEncoding.EncodeToString(m.Body)
+		data.BodyEncoding = bodyEncodingBase64
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON 解码 MarshalJSON 生成的 JSON
+func (m *Msg) UnmarshalJSON(b []byte) error {
+	data := msgJSON{msgAlias: (*msgAlias)(m)}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	m.Timestamp = time.Time{}
+	if data.Timestamp != 0 {
+		m.Timestamp = time.UnixMilli(data.Timestamp)
+	}
+	m.Body = nil
+	switch data.BodyEncoding {
+	case "":
+		if data.Body != "" {
+			m.Body = []byte(data.Body)
+		}
+	case bodyEncodingBase64:
+		body, err := base64.StdEncoding.DecodeString(data.Body)
+		if err != nil {
+			return fmt.Errorf("queue: decode msg body: %w", err)
+		}
+		m.Body = body
+	default:
+		return fmt.Errorf("queue: unsupported msg body_encoding %q", data.BodyEncoding)
+	}
+	return nil
+}
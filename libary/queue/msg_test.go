@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMsg(t *testing.T) {
+	is := assert.New(t)
+	headers := map[string]string{"trace-id": "abc"}
+	msg := NewMsg("topic", []byte("body"), headers)
+	is.Equal(SendMsg, msg.RunType)
+	is.Equal("topic", msg.Topic)
+	is.NotEmpty(msg.MsgId)
+	is.WithinDuration(time.Now(), msg.Timestamp, time.Second)
+	is.Equal(headers, msg.Headers)
+
+	// headers are copied
+	headers["trace-id"] = "changed"
+	is.Equal("abc", msg.Headers["trace-id"])
+	is.Nil(NewMsg("topic", nil, nil).Headers)
+}
+
+func TestMsgJSONRoundTrip(t *testing.T) {
+	is := assert.New(t)
+	timestamp := time.UnixMilli(1700000000123)
+
+	for name, tc := range map[string]struct {
+		body     []byte
+		wantBody interface{}
+		encoding interface{}
+	}{
+		"text":   {body: []byte("héllo"), wantBody: "héllo"},
+		"binary": {body: []byte{0xff, 0x00, 0xfe}, wantBody: "/wD+", encoding: "base64"},
+		"empty":  {body: nil, wantBody: ""},
+	} {
+		msg := NewMsg("topic", tc.body, map[string]string{"tenant": "t1"})
+		msg.Timestamp = timestamp
+		msg.Offset = 7
+
+		data, err := json.Marshal(msg)
+		is.NoError(err, name)
+		var fields map[string]interface{}
+		is.NoError(json.Unmarshal(data, &fields), name)
+		is.Equal(float64(1700000000123), fields["timestamp"], name)
+		is.Equal(tc.wantBody, fields["body"], name)
+		is.Equal(tc.encoding, fields["body_encoding"], name)
+		is.Equal("topic", fields["topic"], name)
+
+		var decoded Msg
+		is.NoError(json.Unmarshal(data, &decoded), name)
+		is.True(timestamp.Equal(decoded.Timestamp), name)
+		decoded.Timestamp = msg.Timestamp
+		is.Equal(msg, decoded, name)
+	}
+
+	// the zero time is encoded as 0
+	data, err := json.Marshal(Msg{})
+	is.NoError(err)
+	var decoded Msg
+	is.NoError(json.Unmarshal(data, &decoded))
+	is.True(decoded.Timestamp.IsZero())
+
+	is.Error(json.Unmarshal([]byte(`{"body":"x","body_encoding":"hex"}`), &decoded))
+	is.Error(json.Unmarshal([]byte(`{"body":"!","body_encoding":"base64"}`), &decoded))
+}
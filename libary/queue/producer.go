@@ -6,32 +6,91 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/gogf/gf/v2/util/gconv"
-	"github.com/longpi1/gopkg/libary/log"
 )
 
+// limitPollInterval 等待限流器放行时的轮询间隔
+const limitPollInterval = 10 * time.Millisecond
+
+// ErrRateLimited 生产者被限流
+var ErrRateLimited = errors.New("queue producer is rate limited")
+
+// ErrDuplicate 相同幂等键的消息已经推送过
+var ErrDuplicate = errors.New("queue message is duplicate")
+
+// idempotencyKeyPrefix 幂等键在 redis 中的前缀
+const idempotencyKeyPrefix = "queue:idempotency:"
+
+// IdempotencyStore 记录幂等键的存储，redis.Cache 满足该接口
+type IdempotencyStore interface {
+	SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
 // Push 推送队列
 func Push(topic string, data interface{}, cfg Config) (err error) {
+	if err = waitLimiter(cfg); err != nil {
+		return
+	}
 	q, err := InstanceProducer(cfg)
 	if err != nil {
 		return
 	}
 	msg, err := q.SendMsg(topic, gconv.String(data))
 	if err != nil {
-		log.Error("生产队列：%s 发送失败, err:%+v， msg：%+v", topic, err, msg)
+		getLogger().Errorf("生产队列：%s 发送失败, err:%+v， msg：%+v", topic, err, msg)
+	}
+	return
+}
+
+// PushIdempotent 使用 store 的 SetNX（通常为 redis）记录幂等键，只有幂等键在 ttl 内第一次出现时才推送消息，否则返回 ErrDuplicate。
+// 推送失败时删除幂等键，以便重试
+func PushIdempotent(ctx context.Context, topic string, data interface{}, idempotencyKey string, store IdempotencyStore, ttl time.Duration, cfg Config) (err error) {
+	key := idempotencyKeyPrefix + topic + ":" + idempotencyKey
+	ok, err := store.SetNX(ctx, key, time.Now().Unix(), ttl)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return ErrDuplicate
+	}
+	if err = Push(topic, data, cfg); err != nil {
+		_ = store.Delete(ctx, key)
 	}
 	return
 }
 
 // DelayPush 推送延迟队列
 func DelayPush(topic string, data interface{}, second int64, cfg Config) (err error) {
+	if err = waitLimiter(cfg); err != nil {
+		return
+	}
 	q, err := InstanceProducer(cfg)
 	if err != nil {
 		return
 	}
 	msg, err := q.SendDelayMsg(topic, gconv.String(data), second)
 	if err != nil {
-		log.Error("生产队列：%s 延迟发送失败, err:%+v， msg：%+v", topic, err, msg)
+		getLogger().Errorf("生产队列：%s 延迟发送失败, err:%+v， msg：%+v", topic, err, msg)
 	}
 	return
 }
+
+// waitLimiter 等待限流器放行，超过 cfg.LimitWait 仍未放行时返回 ErrRateLimited
+func waitLimiter(cfg Config) error {
+	if cfg.Limiter == nil || cfg.Limiter.Allow() {
+		return nil
+	}
+	deadline := time.Now().Add(cfg.LimitWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(limitPollInterval)
+		if cfg.Limiter.Allow() {
+			return nil
+		}
+	}
+	return ErrRateLimited
+}
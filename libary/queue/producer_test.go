@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longpi1/gopkg/libary/constant"
+	"github.com/longpi1/gopkg/libary/limit"
+	"github.com/stretchr/testify/assert"
+)
+
+// countLimiter allows the first n calls
+type countLimiter struct {
+	n int32
+}
+
+func (l *countLimiter) Allow() bool {
+	return atomic.AddInt32(&l.n, -1) >= 0
+}
+
+func TestPushRateLimited(t *testing.T) {
+	is := assert.New(t)
+	// no group name: an allowed push fails when creating the producer, not on the limiter
+	cfg := Config{Limiter: &countLimiter{n: 2}}
+
+	for i := 0; i < 2; i++ {
+		err := Push("topic", "data", cfg)
+		is.Error(err)
+		is.NotErrorIs(err, ErrRateLimited)
+	}
+	for i := 0; i < 3; i++ {
+		is.ErrorIs(Push("topic", "data", cfg), ErrRateLimited)
+		is.ErrorIs(DelayPush("topic", "data", 10, cfg), ErrRateLimited)
+	}
+}
+
+func TestPushRateLimitWait(t *testing.T) {
+	is := assert.New(t)
+	// one token per second with a burst of 1
+	limiter := limit.NewAdaptiveLimiter(1, 1, 1)
+	cfg := Config{Limiter: limiter, LimitWait: 2 * time.Second}
+
+	is.NotErrorIs(Push("topic", "data", cfg), ErrRateLimited)
+	start := time.Now()
+	is.NotErrorIs(Push("topic", "data", cfg), ErrRateLimited)
+	is.GreaterOrEqual(time.Since(start), 500*time.Millisecond)
+
+	cfg.LimitWait = 50 * time.Millisecond
+	is.ErrorIs(Push("topic", "data", cfg), ErrRateLimited)
+}
+
+// memoryStore is an IdempotencyStore ignoring ttl
+type memoryStore struct {
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, val interface{}, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	s.keys[key] = val
+	return true, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func TestPushIdempotent(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	store := &memoryStore{keys: make(map[string]interface{})}
+
+	cfg := Config{Driver: constant.MemoryMqName, GroupName: "test"}
+	topic := uniqueTopic("memory-idempotent")
+	c, err := NewConsumer(cfg)
+	is.NoError(err)
+	received := make(chan Msg, 10)
+	is.NoError(c.ListenReceiveMsgDo(topic, func(msg Msg) { received <- msg }))
+
+	is.NoError(PushIdempotent(ctx, topic, "order-1", "req-1", store, time.Minute, cfg))
+	is.ErrorIs(PushIdempotent(ctx, topic, "order-1", "req-1", store, time.Minute, cfg), ErrDuplicate)
+	is.NoError(PushIdempotent(ctx, topic, "order-2", "req-2", store, time.Minute, cfg))
+
+	for _, want := range []string{"order-1", "order-2"} {
+		select {
+		case msg := <-received:
+			is.Equal(want, msg.BodyString())
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("duplicate message delivered: %s", msg.BodyString())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the key is released when the push fails so the retry can publish
+	is.Error(PushIdempotent(ctx, topic, "order-3", "req-3", store, time.Minute, Config{}))
+	is.NoError(PushIdempotent(ctx, topic, "order-3", "req-3", store, time.Minute, cfg))
+}
@@ -3,10 +3,10 @@ package queue
 import (
 	"context"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/longpi1/gopkg/libary/future"
 )
 
 type Pulsar struct {
@@ -46,7 +46,8 @@ func RegisterPulsarConsumer(config PulsarConf) (client Consumer, err error) {
 func RegisterPulsarProducer(config PulsarConf) (client Producer, err error) {
 	p := Pulsar{}
 	producer, err := p.Client.CreateProducer(pulsar.ProducerOptions{
-		Topic: config.Topic,
+		Topic:           config.Topic,
+		CompressionType: pulsarCompressionType(config.compression),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not create producer: %v", err)
@@ -62,12 +63,18 @@ func (p *Pulsar) SendMsg(topic string, body string) (msg Msg, err error) {
 
 // SendByteMsg 生产数据
 func (p *Pulsar) SendByteMsg(topic string, body []byte) (msg Msg, err error) {
+	return p.SendHeaderMsg(topic, body, nil)
+}
+
+// SendHeaderMsg 生产带消息头的数据，消息头以 message properties 的形式发送
+func (p *Pulsar) SendHeaderMsg(topic string, body []byte, headers map[string]string) (msg Msg, err error) {
 	if p.Producer == nil {
 		return msg, fmt.Errorf("producer is not set")
 	}
 
 	messageID, err := p.Producer.Send(context.Background(), &pulsar.ProducerMessage{
-		Payload: body,
+		Payload:    body,
+		Properties: headers,
 	})
 	if err != nil {
 		return msg, fmt.Errorf("could not send event: %d, %v", messageID, err)
@@ -79,11 +86,38 @@ func (p *Pulsar) SendByteMsg(topic string, body []byte) (msg Msg, err error) {
 		MsgId:     messageID.String(),
 		Body:      body,
 		Timestamp: time.Now(),
+		Headers:   headers,
 	}
 
 	return msg, err
 }
 
+// SendMsgAsync 异步生产数据
+func (p *Pulsar) SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg] {
+	f := future.NewFuture[Msg]()
+	if p.Producer == nil {
+		f.Complete(Msg{}, fmt.Errorf("producer is not set"))
+		return f
+	}
+
+	p.Producer.SendAsync(ctx, &pulsar.ProducerMessage{
+		Payload: []byte(body),
+	}, func(messageID pulsar.MessageID, message *pulsar.ProducerMessage, err error) {
+		if err != nil {
+			f.Complete(Msg{}, fmt.Errorf("could not send event: %v", err))
+			return
+		}
+		f.Complete(Msg{
+			RunType:   SendMsg,
+			Topic:     topic,
+			MsgId:     messageID.String(),
+			Body:      message.Payload,
+			Timestamp: time.Now(),
+		}, nil)
+	})
+	return f
+}
+
 func (p *Pulsar) SendDelayMsg(topic string, body string, delaySecond int64) (msg Msg, err error) {
 
 	return
@@ -91,39 +125,64 @@ func (p *Pulsar) SendDelayMsg(topic string, body string, delaySecond int64) (msg
 
 // ListenReceiveMsgDo 消费数据
 func (p *Pulsar) ListenReceiveMsgDo(topic string, receiveDo func(msg Msg)) (err error) {
+	_, err = p.ListenReceiveMsgDoContext(context.Background(), topic, receiveDo)
+	return err
+}
+
+// ListenReceiveMsgDoContext 消费数据，ctx 取消后停止接收消息。
+// 返回的 done 在接收循环完全退出后关闭，此时不会再调用 receiveDo，可用于关闭时等待消费结束
+func (p *Pulsar) ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(msg Msg)) (done <-chan struct{}, err error) {
 	if p.Consumer == nil {
-		return fmt.Errorf("consumer is not set")
+		return nil, fmt.Errorf("consumer is not set")
 	}
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
+		defer recoverReceive(topic)
 		for {
-			data, err := p.Consumer.Receive(context.Background())
+			data, err := p.Consumer.Receive(ctx)
+			if ctx.Err() != nil {
+				// 已接收但未处理的消息不确认，由服务端重新投递
+				getLogger().Debugf("pulsar consumer of %s stopped: %v", topic, ctx.Err())
+				return
+			}
 			if err != nil {
-				log.Printf("Error receiving event: %v", err)
+				getLogger().Errorf("Error receiving event: %v", err)
 				continue
 			}
-			msg := Msg{
-				RunType:   SendMsg,
-				Topic:     topic,
-				MsgId:     getRandMsgId(),
-				Body:      data.Payload(),
-				Timestamp: time.Now(),
-			}
 			// 回调方法进行处理
-			receiveDo(msg)
-			if err != nil {
-				log.Printf("Error handling event: %v", err)
-				// Consider what to do with the event: Ack/Nack
+			receiveDo(pulsarMsg(topic, data))
+			if err = p.Consumer.Ack(data); err != nil {
+				getLogger().Errorf("Error acking event: %v", err)
 				p.Consumer.Nack(data)
-			} else {
-				err = p.Consumer.Ack(data)
-				if err != nil {
-					p.Consumer.Nack(data)
-				}
 			}
 		}
 	}()
 
-	return nil
+	return stopped, nil
+}
+
+// pulsarCompressionType 将压缩算法转换为 pulsar 的压缩类型，pulsar 仅支持 lz4
+func pulsarCompressionType(compression string) pulsar.CompressionType {
+	if compression == CompressionLz4 {
+		return pulsar.LZ4
+	}
+	return pulsar.NoCompression
+}
+
+// pulsarMsg 将消费到的 pulsar 消息转换为 Msg
+func pulsarMsg(topic string, data pulsar.Message) Msg {
+	msg := Msg{
+		RunType:   SendMsg,
+		Topic:     topic,
+		MsgId:     getRandMsgId(),
+		Body:      data.Payload(),
+		Timestamp: time.Now(),
+	}
+	if properties := data.Properties(); len(properties) > 0 {
+		msg.Headers = properties
+	}
+	return msg
 }
 
 // Close closes the client and releases all resources.
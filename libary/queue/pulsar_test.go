@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePulsarConsumer delivers the messages sent to its channel
+type fakePulsarConsumer struct {
+	pulsar.Consumer
+	messages chan pulsar.Message
+	acked    int32
+}
+
+func (c *fakePulsarConsumer) Receive(ctx context.Context) (pulsar.Message, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakePulsarConsumer) Ack(pulsar.Message) error {
+	atomic.AddInt32(&c.acked, 1)
+	return nil
+}
+
+func (c *fakePulsarConsumer) Nack(pulsar.Message) {}
+
+func TestPulsarListenReceiveMsgDoContext(t *testing.T) {
+	is := assert.New(t)
+	consumer := &fakePulsarConsumer{messages: make(chan pulsar.Message)}
+	// wrapped the way NewConsumer does
+	var c Consumer = &decompressConsumer{Consumer: &Pulsar{Consumer: consumer}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan Msg, 1)
+	done, err := c.ListenReceiveMsgDoContext(ctx, "topic", func(msg Msg) {
+		received <- msg
+	})
+	is.NoError(err)
+
+	consumer.messages <- &fakePulsarMessage{payload: []byte("hello")}
+	msg := <-received
+	is.Equal("topic", msg.Topic)
+	is.Equal("hello", msg.BodyString())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("receive loop did not exit")
+	}
+	is.Equal(int32(1), atomic.LoadInt32(&consumer.acked))
+
+	_, err = (&Pulsar{}).ListenReceiveMsgDoContext(context.Background(), "topic", func(Msg) {})
+	is.Error(err)
+}
@@ -3,11 +3,13 @@ package queue
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/producer"
+	"github.com/longpi1/gopkg/libary/future"
 )
 
 type RocketMq struct {
@@ -41,14 +43,16 @@ func (r *RocketMq) SendMsg(topic string, body string) (mqMsg Msg, err error) {
 
 // SendByteMsg 生产数据
 func (r *RocketMq) SendByteMsg(topic string, body []byte) (mqMsg Msg, err error) {
+	return r.SendHeaderMsg(topic, body, nil)
+}
+
+// SendHeaderMsg 生产带消息头的数据，消息头以 message properties 的形式发送
+func (r *RocketMq) SendHeaderMsg(topic string, body []byte, headers map[string]string) (mqMsg Msg, err error) {
 	if r.producerIns == nil {
 		return mqMsg, fmt.Errorf("rocketMq producer not register")
 	}
 
-	result, err := r.producerIns.SendSync(context.Background(), &primitive.Message{
-		Topic: topic,
-		Body:  body,
-	})
+	result, err := r.producerIns.SendSync(context.Background(), rocketMessage(topic, body, headers))
 
 	if err != nil {
 		return
@@ -62,10 +66,42 @@ func (r *RocketMq) SendByteMsg(topic string, body []byte) (mqMsg Msg, err error)
 		Topic:   topic,
 		MsgId:   result.MsgID,
 		Body:    body,
+		Headers: headers,
 	}
 	return mqMsg, nil
 }
 
+// SendMsgAsync 异步生产数据
+func (r *RocketMq) SendMsgAsync(ctx context.Context, topic string, body string) *future.Future[Msg] {
+	f := future.NewFuture[Msg]()
+	if r.producerIns == nil {
+		f.Complete(Msg{}, fmt.Errorf("rocketMq producer not register"))
+		return f
+	}
+
+	err := r.producerIns.SendAsync(ctx, func(ctx context.Context, result *primitive.SendResult, err error) {
+		if err != nil {
+			f.Complete(Msg{}, err)
+			return
+		}
+		if result.Status != primitive.SendOK {
+			f.Complete(Msg{}, fmt.Errorf("rocketMq producer send msg error status:%v", result.Status))
+			return
+		}
+		f.Complete(Msg{
+			RunType: SendMsg,
+			Topic:   topic,
+			MsgId:   result.MsgID,
+			Body:    []byte(body),
+		}, nil)
+	}, rocketMessage(topic, []byte(body), nil))
+	// 发送失败时回调不会被调用
+	if err != nil {
+		f.Complete(Msg{}, err)
+	}
+	return f
+}
+
 func (r *RocketMq) SendDelayMsg(topic string, body string, delaySecond int64) (mqMsg Msg, err error) {
 	err = fmt.Errorf("implement me")
 	return
@@ -73,31 +109,85 @@ func (r *RocketMq) SendDelayMsg(topic string, body string, delaySecond int64) (m
 
 // ListenReceiveMsgDo 消费数据
 func (r *RocketMq) ListenReceiveMsgDo(topic string, receiveDo func(mqMsg Msg)) (err error) {
+	_, err = r.ListenReceiveMsgDoContext(context.Background(), topic, receiveDo)
+	return err
+}
+
+// ListenReceiveMsgDoContext 消费数据，ctx 取消后关闭消费者。
+// 返回的 done 在消费者关闭且已收到的消息处理完成后关闭
+func (r *RocketMq) ListenReceiveMsgDoContext(ctx context.Context, topic string, receiveDo func(mqMsg Msg)) (done <-chan struct{}, err error) {
 	if r.consumerIns == nil {
-		return fmt.Errorf("rocketMq consumer not register")
+		return nil, fmt.Errorf("rocketMq consumer not register")
 	}
 
-	err = r.consumerIns.Subscribe(topic, consumer.MessageSelector{}, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	var (
+		mu       sync.RWMutex
+		stopping bool
+		wg       sync.WaitGroup // 已收到但尚未处理完成的消息
+	)
+	err = r.consumerIns.Subscribe(topic, consumer.MessageSelector{}, func(_ context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		mu.RLock()
+		defer mu.RUnlock()
+		if stopping {
+			// 关闭过程中收到的消息由服务端稍后重新投递
+			return consumer.ConsumeRetryLater, nil
+		}
 		for _, item := range msgs {
-			go receiveDo(Msg{
-				RunType: ReceiveMsg,
-				Topic:   item.Topic,
-				MsgId:   item.MsgId,
-				Body:    item.Body,
-			})
+			wg.Add(1)
+			go func(msg Msg) {
+				defer wg.Done()
+				defer recoverReceive(topic)
+				receiveDo(msg)
+			}(rocketMsg(item))
 		}
 		return consumer.ConsumeSuccess, nil
 	})
 
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	if err = r.consumerIns.Start(); err != nil {
 		_ = r.consumerIns.Unsubscribe(topic)
-		return
+		return nil, err
 	}
-	return
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		mu.Lock()
+		stopping = true
+		mu.Unlock()
+		if err := r.consumerIns.Shutdown(); err != nil {
+			getLogger().Errorf("rocketMq consumer of %s shutdown err:%+v", topic, err)
+		}
+		wg.Wait()
+	}()
+	return stopped, nil
+}
+
+// rocketMessage 创建 rocketmq 消息，消息头写入 message properties
+func rocketMessage(topic string, body []byte, headers map[string]string) *primitive.Message {
+	message := primitive.NewMessage(topic, body)
+	for key, value := range headers {
+		message.WithProperty(key, value)
+	}
+	return message
+}
+
+// rocketMsg 将消费到的 rocketmq 消息转换为 Msg，消息头中包含 rocketmq 的系统属性
+func rocketMsg(item *primitive.MessageExt) Msg {
+	msg := Msg{
+		RunType: ReceiveMsg,
+		Topic:   item.Topic,
+		MsgId:   item.MsgId,
+		Body:    item.Body,
+	}
+	if properties := item.GetProperties(); len(properties) > 0 {
+		msg.Headers = properties
+	}
+	return msg
 }
 
 // RegisterRocketMqProducer 注册rocketmq生产者
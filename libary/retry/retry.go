@@ -0,0 +1,69 @@
+// Package retry retries a function with a fixed backoff until it succeeds or the context is done.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Option customize the behavior of Retry
+type Option func(*retryOptions)
+
+type retryOptions struct {
+	isRetryable func(err error) bool
+}
+
+// WithIsRetryable set a predicate deciding whether an error should be retried,
+// errors for which it returns false fail fast
+func WithIsRetryable(fn func(err error) bool) Option {
+	return func(o *retryOptions) {
+		o.isRetryable = fn
+	}
+}
+
+// Retry call fn up to attempts times, sleeping backoff between failed calls.
+// It stops early when ctx is done or fn returns a non-retryable error,
+// the returned error wraps the last error of fn together with the attempt count.
+func Retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error, opts ...Option) error {
+	o := &retryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return retryCanceled(i-1, ctxErr, err)
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		if o.isRetryable != nil && !o.isRetryable(err) {
+			return fmt.Errorf("non-retryable error after %d attempts: %w", i, err)
+		}
+		if i == attempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return retryCanceled(i, ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+
+	return fmt.Errorf("retry failed after %d attempts: %w", attempts, err)
+}
+
+func retryCanceled(attempts int, ctxErr, lastErr error) error {
+	if lastErr == nil {
+		return fmt.Errorf("retry canceled after %d attempts: %w", attempts, ctxErr)
+	}
+	return fmt.Errorf("retry canceled after %d attempts: %w, last error: %w", attempts, ctxErr, lastErr)
+}
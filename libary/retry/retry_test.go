@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrySuccessOnThirdTry(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), 5, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryExhausted(t *testing.T) {
+	errTemp := errors.New("temporary")
+	calls := 0
+	err := Retry(context.Background(), 3, time.Millisecond, func() error {
+		calls++
+		return errTemp
+	})
+	assert.ErrorIs(t, err, errTemp)
+	assert.Contains(t, err.Error(), "3 attempts")
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	errFatal := errors.New("fatal")
+	calls := 0
+	err := Retry(context.Background(), 5, time.Millisecond, func() error {
+		calls++
+		return errFatal
+	}, WithIsRetryable(func(err error) bool {
+		return !errors.Is(err, errFatal)
+	}))
+	assert.ErrorIs(t, err, errFatal)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryContextCancel(t *testing.T) {
+	errTemp := errors.New("temporary")
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+	err := Retry(ctx, 10, time.Hour, func() error {
+		calls++
+		cancel()
+		return errTemp
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errTemp)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), time.Second)
+
+	calls = 0
+	err = Retry(ctx, 10, time.Millisecond, func() error {
+		calls++
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, calls)
+}
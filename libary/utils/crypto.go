@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
@@ -52,8 +53,81 @@ func Base64Encode(pwd string) string {
 	return base64.StdEncoding.EncodeToString([]byte(pwd))
 }
 
+// Base64URLEncode encode with the URL-safe alphabet, safe to embed in URLs and filenames
+func Base64URLEncode(s string) string {
+	return base64.URLEncoding.EncodeToString([]byte(s))
+}
+
+// Base64URLDecode decode a string produced by Base64URLEncode
+func Base64URLDecode(s string) (string, error) {
+	bytes, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), err
+}
+
+// Base64RawURLEncode encode with the URL-safe alphabet and without padding, as used by JWT
+func Base64RawURLEncode(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// Base64RawURLDecode decode a string produced by Base64RawURLEncode
+func Base64RawURLDecode(s string) (string, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), err
+}
+
 func MD5(str string) string {
 	// #nosec
 	data := md5.Sum([]byte(str))
 	return hex.EncodeToString(data[:])[8:24]
 }
+
+const alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// RandomString generate a random alphanumeric string of length n backed by crypto/rand,
+// suitable for API keys and nonces
+func RandomString(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	// reject bytes >= 248 so that every character is equally likely
+	const maxByte = 256 - 256%len(alphanumeric)
+	result := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(result) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			if int(b) >= maxByte {
+				continue
+			}
+			result = append(result, alphanumeric[int(b)%len(alphanumeric)])
+			if len(result) == n {
+				break
+			}
+		}
+	}
+
+	return string(result)
+}
+
+// RandomToken generate a token from the given number of crypto/rand bytes, encoded as unpadded URL-safe base64
+func RandomToken(bytes int) string {
+	if bytes <= 0 {
+		return ""
+	}
+	buf := make([]byte, bytes)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +47,59 @@ func TestBcryptCost(t *testing.T) {
 func TestMD5(t *testing.T) {
 	assert.Equal(t, "67f48520697662a2", MD5("These pretzels are making me thirsty."))
 }
+
+func TestBase64URL(t *testing.T) {
+	// "\xfb\xff\xbf" encodes to "+/+/" with the standard alphabet
+	src := "\xfb\xff\xbf?>"
+	assert.Equal(t, "+/+/Pz4=", Base64Encode(src))
+
+	encoded := Base64URLEncode(src)
+	assert.Equal(t, "-_-_Pz4=", encoded)
+	decoded, err := Base64URLDecode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, src, decoded)
+
+	raw := Base64RawURLEncode(src)
+	assert.Equal(t, "-_-_Pz4", raw)
+	decoded, err = Base64RawURLDecode(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, src, decoded)
+
+	_, err = Base64URLDecode("+/+/Pz4=")
+	assert.Error(t, err)
+	_, err = Base64RawURLDecode("-_-_Pz4=")
+	assert.Error(t, err)
+}
+
+func TestRandomString(t *testing.T) {
+	assert.Equal(t, "", RandomString(0))
+
+	seen := make(map[string]struct{}, 10000)
+	for i := 0; i < 10000; i++ {
+		s := RandomString(32)
+		assert.Len(t, s, 32)
+		for _, c := range s {
+			assert.True(t, strings.ContainsRune(alphanumeric, c), "unexpected char %q", c)
+		}
+		seen[s] = struct{}{}
+	}
+	assert.Len(t, seen, 10000)
+}
+
+func TestRandomToken(t *testing.T) {
+	assert.Equal(t, "", RandomToken(0))
+
+	seen := make(map[string]struct{}, 10000)
+	for i := 0; i < 10000; i++ {
+		token := RandomToken(32)
+		assert.Len(t, token, base64.RawURLEncoding.EncodedLen(32))
+		assert.NotContains(t, token, "+")
+		assert.NotContains(t, token, "/")
+		assert.NotContains(t, token, "=")
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		assert.NoError(t, err)
+		assert.Len(t, raw, 32)
+		seen[token] = struct{}{}
+	}
+	assert.Len(t, seen, 10000)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Debounce return a function that delays calling fn until d has elapsed since its last call,
+// a burst of calls results in a single call of fn after the burst is quiet for d.
+// fn runs in its own goroutine, the returned function is safe for concurrent use.
+func Debounce(d time.Duration, fn func()) func() {
+	var (
+		lock  sync.Mutex
+		timer *time.Timer
+	)
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(d, fn)
+	}
+}
+
+// Throttle return a function that calls fn at most once per d, calls within d of the last call
+// of fn are dropped. fn runs synchronously in the caller, the returned function is safe for concurrent use.
+func Throttle(d time.Duration, fn func()) func() {
+	var (
+		lock sync.Mutex
+		last time.Time
+	)
+	return func() {
+		lock.Lock()
+		now := time.Now()
+		if !last.IsZero() && now.Sub(last) < d {
+			lock.Unlock()
+			return
+		}
+		last = now
+		lock.Unlock()
+		fn()
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebounce(t *testing.T) {
+	var calls int32
+	debounced := Debounce(50*time.Millisecond, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	// a burst from several goroutines is collapsed into one call
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				debounced()
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+
+	// a new burst after the quiet period calls fn again
+	debounced()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestThrottle(t *testing.T) {
+	var calls int32
+	throttled := Throttle(50*time.Millisecond, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	// the first call runs right away, the rest of the burst is dropped
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				throttled()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	time.Sleep(60 * time.Millisecond)
+	throttled()
+	throttled()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -6,8 +6,20 @@ import (
 	"time"
 )
 
+// DefaultExpirationJitter 默认的过期时间随机偏移范围，单位为秒
+const DefaultExpirationJitter = 10
+
 func GetRandomExpiration(expiration int) time.Duration {
-	return time.Duration(int64(expiration)+rand.Int63n(10)) * time.Second
+	return GetJitteredExpiration(expiration, DefaultExpirationJitter)
+}
+
+// GetJitteredExpiration 返回 [expiration, expiration+jitter) 秒内的随机过期时间，避免大量 key 同时过期，
+// jitter 小于等于0时不做偏移
+func GetJitteredExpiration(expiration, jitter int) time.Duration {
+	if jitter <= 0 {
+		return time.Duration(expiration) * time.Second
+	}
+	return time.Duration(int64(expiration)+rand.Int63n(int64(jitter))) * time.Second
 }
 
 func GetServerAdders(adders string) []string {